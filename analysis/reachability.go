@@ -0,0 +1,226 @@
+package analysis
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+)
+
+// Reachability is the result of exploring a scenario from its starting locations.
+type Reachability struct {
+	ReachableLocations   []int64           `json:"reachable_locations"`
+	ReachableCards       []int64           `json:"reachable_cards"`
+	UnreachableLocations []*LocationReport `json:"unreachable_locations"`
+	LockedCards          []*LockedCard     `json:"locked_cards"`
+	UngrantedTokens      []*TokenReport    `json:"ungranted_tokens"`
+	UnconsumedTokens     []*TokenReport    `json:"unconsumed_tokens"`
+}
+
+type LocationReport struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// LockedCard is a card in a reachable location that can never be accessed,
+// because some of the state tokens it requires can never be obtained,
+// or its requirement can never be met.
+type LockedCard struct {
+	ID               int64   `json:"id"`
+	Description      string  `json:"description"`
+	IDLocation       int64   `json:"id_location"`
+	MissingTokens    []int64 `json:"missing_tokens"`
+	UnmetRequirement bool    `json:"unmet_requirement"`
+}
+
+type TokenReport struct {
+	ID        int64   `json:"id"`
+	ShortName string  `json:"short_name"`
+	Cards     []int64 `json:"cards"` // Cards requiring (ungranted) or granting (unconsumed) the token
+}
+
+// Compute the reachability of a scenario's locations and cards.
+func ScenarioReachability(db gorp.SqlExecutor, scenar *models.Scenario) (*Reachability, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to compute reachability")
+	}
+
+	locs, combs, err := models.LocationGraph(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := models.ListStateTokens(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	r := ComputeReachability(locs, combs)
+
+	names := make(map[int64]string)
+	for _, tk := range tokens {
+		names[tk.ID] = tk.ShortName
+	}
+	for _, tr := range append(r.UngrantedTokens, r.UnconsumedTokens...) {
+		tr.ShortName = names[tr.ID]
+	}
+
+	return r, nil
+}
+
+// Explore a location graph, starting from the non-hidden locations.
+// A card can be visited once its location is revealed, all the state tokens it requires
+// have been obtained, and its requirement can be met (see RequirementExpr.Possible).
+// Visiting a card reveals locations and grants state tokens and elements,
+// which can in turn give access to more cards: this is iterated until nothing changes.
+// An element combination grants what it gives once all of its input elements are obtained.
+func ComputeReachability(locs []*models.LocGraph, combs []*models.CombGraph) *Reachability {
+
+	revealed := make(map[int64]bool)
+	visited := make(map[int64]bool)
+	combined := make(map[int64]bool)
+	obtained := make(map[int64]bool)
+	elements := make(map[int64]bool)
+
+	// Tokens granted and required anywhere, by cards
+	granted := make(map[int64][]int64)
+	required := make(map[int64][]int64)
+	// Tokens referenced by requirements: they are consumed, but may not be needed
+	referenced := make(map[int64]bool)
+
+	for _, loc := range locs {
+		if !loc.Hidden {
+			revealed[loc.ID] = true
+		}
+		for _, c := range loc.Cards {
+			for _, tk := range c.UnlockStateTokens {
+				granted[tk] = append(granted[tk], c.ID)
+			}
+			for _, tk := range c.IsUnlockedStateTokens {
+				required[tk] = append(required[tk], c.ID)
+			}
+			if c.Requirement != nil {
+				for _, tk := range c.Requirement.StateTokens() {
+					referenced[tk] = true
+				}
+			}
+		}
+	}
+
+	locked := func(c *models.CardGraph) bool {
+		return len(missingTokens(c, obtained)) > 0 || !requirementPossible(c, obtained, elements)
+	}
+
+	grant := func(c *models.CardGraph) {
+		for _, l := range c.Reveals {
+			revealed[l] = true
+		}
+		for _, tk := range c.UnlockStateTokens {
+			obtained[tk] = true
+		}
+		for _, e := range c.GivesElements {
+			elements[e] = true
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, loc := range locs {
+			if !revealed[loc.ID] {
+				continue
+			}
+			for _, c := range loc.Cards {
+				if visited[c.ID] || locked(c) {
+					continue
+				}
+				visited[c.ID] = true
+				changed = true
+				grant(c)
+			}
+		}
+		for _, cb := range combs {
+			if combined[cb.ID] || !holdsAll(elements, cb.Inputs) {
+				continue
+			}
+			combined[cb.ID] = true
+			changed = true
+			grant(&cb.CardGraph)
+		}
+	}
+
+	r := &Reachability{
+		ReachableLocations:   []int64{},
+		ReachableCards:       []int64{},
+		UnreachableLocations: []*LocationReport{},
+		LockedCards:          []*LockedCard{},
+		UngrantedTokens:      []*TokenReport{},
+		UnconsumedTokens:     []*TokenReport{},
+	}
+
+	for _, loc := range locs {
+		if !revealed[loc.ID] {
+			r.UnreachableLocations = append(r.UnreachableLocations, &LocationReport{ID: loc.ID, Name: loc.Name})
+			continue
+		}
+		r.ReachableLocations = append(r.ReachableLocations, loc.ID)
+		for _, c := range loc.Cards {
+			if visited[c.ID] {
+				r.ReachableCards = append(r.ReachableCards, c.ID)
+				continue
+			}
+			r.LockedCards = append(r.LockedCards, &LockedCard{
+				ID:               c.ID,
+				Description:      c.Description,
+				IDLocation:       loc.ID,
+				MissingTokens:    missingTokens(c, obtained),
+				UnmetRequirement: !requirementPossible(c, obtained, elements),
+			})
+		}
+	}
+
+	for _, tk := range sortedKeys(required) {
+		if !obtained[tk] {
+			r.UngrantedTokens = append(r.UngrantedTokens, &TokenReport{ID: tk, Cards: required[tk]})
+		}
+	}
+	for _, tk := range sortedKeys(granted) {
+		if _, ok := required[tk]; !ok && !referenced[tk] {
+			r.UnconsumedTokens = append(r.UnconsumedTokens, &TokenReport{ID: tk, Cards: granted[tk]})
+		}
+	}
+
+	return r
+}
+
+func missingTokens(c *models.CardGraph, obtained map[int64]bool) []int64 {
+	missing := []int64{}
+	for _, tk := range c.IsUnlockedStateTokens {
+		if !obtained[tk] {
+			missing = append(missing, tk)
+		}
+	}
+	return missing
+}
+
+func holdsAll(held map[int64]bool, IDs []int64) bool {
+	for _, ID := range IDs {
+		if !held[ID] {
+			return false
+		}
+	}
+	return true
+}
+
+func requirementPossible(c *models.CardGraph, obtained, elements map[int64]bool) bool {
+	return c.Requirement == nil || c.Requirement.Possible(obtained, elements)
+}
+
+func sortedKeys(m map[int64][]int64) []int64 {
+	keys := make([]int64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,133 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/loopfz/scecret/models"
+)
+
+func TestComputeReachability(t *testing.T) {
+	tests := []struct {
+		name       string
+		edit       func(locs []*models.LocGraph)
+		reachable  []int64
+		locked     []int64
+		unconsumed []int64
+	}{
+		{
+			name:      "token unlocking a card",
+			reachable: []int64{1, 2, 4, 5, 3},
+			locked:    []int64{},
+		},
+		{
+			name:       "token never required",
+			edit:       func(locs []*models.LocGraph) { locs[1].Cards[0].IsUnlockedStateTokens = nil },
+			reachable:  []int64{1, 2, 4, 5, 3},
+			locked:     []int64{},
+			unconsumed: []int64{1},
+		},
+		{
+			name: "requirement met by a token",
+			edit: func(locs []*models.LocGraph) {
+				locs[1].Cards[0].IsUnlockedStateTokens = nil
+				locs[1].Cards[0].Requirement = orRequirement(1, 8)
+			},
+			reachable: []int64{1, 2, 4, 5, 3},
+			locked:    []int64{},
+		},
+		{
+			name: "requirement met by an element",
+			edit: func(locs []*models.LocGraph) {
+				locs[0].Cards[1].UnlockStateTokens = nil
+				locs[0].Cards[3].GivesElements = []int64{8}
+				locs[1].Cards[0].IsUnlockedStateTokens = nil
+				locs[1].Cards[0].Requirement = orRequirement(1, 8)
+			},
+			reachable: []int64{1, 2, 4, 5, 3},
+			locked:    []int64{},
+		},
+		{
+			name: "requirement never met",
+			edit: func(locs []*models.LocGraph) {
+				locs[0].Cards[1].UnlockStateTokens = nil
+				locs[1].Cards[0].IsUnlockedStateTokens = nil
+				locs[1].Cards[0].Requirement = orRequirement(1, 8)
+			},
+			reachable: []int64{1, 2, 4, 5},
+			locked:    []int64{3},
+		},
+		{
+			name: "negation never blocks",
+			edit: func(locs []*models.LocGraph) {
+				locs[1].Cards[0].IsUnlockedStateTokens = nil
+				locs[1].Cards[0].Requirement = &models.RequirementExpr{Op: models.RequirementNot, Operands: []*models.RequirementExpr{
+					{Op: models.RequirementToken, IDStateToken: 1},
+				}}
+			},
+			reachable: []int64{1, 2, 4, 5, 3},
+			locked:    []int64{},
+		},
+		{
+			name: "combination with all inputs given",
+			edit: func(locs []*models.LocGraph) {
+				locs[0].Cards[2].GivesElements = []int64{6}
+				locs[0].Cards[3].GivesElements = []int64{7}
+				locs[0].Cards[1].Requirement = &models.RequirementExpr{Op: models.RequirementElement, IDElement: 8}
+			},
+			reachable: []int64{1, 2, 4, 5, 3},
+			locked:    []int64{},
+		},
+		{
+			name: "combination with one input given",
+			edit: func(locs []*models.LocGraph) {
+				locs[0].Cards[3].GivesElements = []int64{6}
+				locs[1].Cards[0].IsUnlockedStateTokens = []int64{9}
+				locs[1].Cards[0].GivesElements = []int64{7}
+				locs[0].Cards[1].Requirement = &models.RequirementExpr{Op: models.RequirementElement, IDElement: 8}
+			},
+			reachable:  []int64{1, 4, 5},
+			locked:     []int64{2, 3},
+			unconsumed: []int64{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locs := testLocs()
+			if tt.edit != nil {
+				tt.edit(locs)
+			}
+			r := ComputeReachability(locs, testCombs())
+
+			reachable := make(map[int64]bool)
+			for _, ID := range r.ReachableCards {
+				reachable[ID] = true
+			}
+			for _, ID := range tt.reachable {
+				if !reachable[ID] {
+					t.Errorf("card %d not reachable: %v", ID, r.ReachableCards)
+				}
+			}
+			if len(r.ReachableCards) != len(tt.reachable) {
+				t.Errorf("got reachable cards %v, expected %v", r.ReachableCards, tt.reachable)
+			}
+
+			locked := []int64{}
+			for _, lc := range r.LockedCards {
+				locked = append(locked, lc.ID)
+			}
+			if !reflect.DeepEqual(locked, tt.locked) {
+				t.Errorf("got locked cards %v, expected %v", locked, tt.locked)
+			}
+
+			var unconsumed []int64
+			for _, tr := range r.UnconsumedTokens {
+				unconsumed = append(unconsumed, tr.ID)
+			}
+			if !reflect.DeepEqual(unconsumed, tt.unconsumed) {
+				t.Errorf("got unconsumed tokens %v, expected %v", unconsumed, tt.unconsumed)
+			}
+		})
+	}
+}
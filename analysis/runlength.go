@@ -0,0 +1,431 @@
+package analysis
+
+import (
+	"container/heap"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+)
+
+const (
+	DEFAULT_TU_PER_RUN = 25 // Time Units available for a run, when not given
+
+	// Probability of passing a round of skill test, used for expected Time Units.
+	// This is a rough constant: the stat values of the characters attempting the tests are
+	// not known when estimating a run. See ComputeSkillTestOdds for the odds of a given stat value.
+	SKILL_TEST_SUCCESS = 0.5
+
+	// Bound of the search for the best run, beyond which the scenario is too large to estimate
+	MAX_SEARCH_STATES = 100000
+)
+
+var (
+	ErrTargetNotFound = errors.New("Target is not a location card, nor obtained through one or unlocked by state tokens and elements")
+	ErrTooComplex     = errors.New("Scenario too complex to estimate run length")
+)
+
+// RunTarget is the card a run has to reach. Location cards are reached by visiting them.
+// Element cards are reached as soon as the run holds their element.
+// Mission success and codex cards are reached as soon as the run holds the state tokens unlocking them
+// and the elements used on them, and meets their requirement.
+type RunTarget struct {
+	IDCard      int64
+	Tokens      []int64
+	Elements    []int64
+	Requirement *models.RequirementExpr
+}
+
+// Whether the target is reached by holding tokens and elements, rather than by visiting a card.
+func (t *RunTarget) conditional() bool {
+	return len(t.Tokens) > 0 || len(t.Elements) > 0 || t.Requirement != nil
+}
+
+// Whether a run holds what the target needs.
+func (t *RunTarget) met(s *runState) bool {
+	for _, tk := range t.Tokens {
+		if !s.tokens[tk] {
+			return false
+		}
+	}
+	for _, e := range t.Elements {
+		if !s.elements[e] {
+			return false
+		}
+	}
+	return t.Requirement == nil || t.Requirement.Eval(s.tokens, s.elements)
+}
+
+// RunEstimate is the number of Time Units needed to reach a target card, e.g. the mission success.
+// The minimal TU is the cost of the best run when all skill tests are passed at the first round.
+// The expected TU is the cost of the best run when each round of skill test
+// is passed with probability SKILL_TEST_SUCCESS.
+// Runs is the number of runs worth of expected TU: once a run is lost, the players restart
+// knowing the way, so a scenario is winnable in about that many runs if its minimal TU fits in one.
+type RunEstimate struct {
+	IDTarget   int64   `json:"id_target"`
+	Reachable  bool    `json:"reachable"`
+	MinTU      uint    `json:"min_tu"`
+	ExpectedTU float64 `json:"expected_tu"`
+	Path       []int64 `json:"path"` // Cards visited by the minimal run, in order
+	TUPerRun   uint    `json:"tu_per_run"`
+	Winnable   bool    `json:"winnable"` // The minimal run fits in a run
+	Runs       int     `json:"runs"`
+}
+
+// Estimate the Time Units needed to reach a card of a scenario.
+func ScenarioRunEstimate(db gorp.SqlExecutor, scenar *models.Scenario, target *models.Card, TUPerRun uint) (*RunEstimate, error) {
+	if db == nil || scenar == nil || target == nil {
+		return nil, errors.New("Missing parameters to estimate run length")
+	}
+
+	locs, combs, err := models.LocationGraph(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &RunTarget{IDCard: target.ID}
+
+	switch target.CardType {
+	case models.CardTypeElement:
+		err = loadTargetElement(db, scenar, target, t)
+	case models.CardTypeMissionSuccess, models.CardTypeCodex:
+		err = loadTargetConditions(db, scenar, target, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return EstimateRun(locs, combs, t, TUPerRun)
+}
+
+// Fill the element of an element card: it is obtained from any card giving it,
+// or once all the inputs of a combination giving it are held.
+func loadTargetElement(db gorp.SqlExecutor, scenar *models.Scenario, card *models.Card, t *RunTarget) error {
+
+	elems, err := models.ListElements(db, scenar)
+	if err != nil {
+		return err
+	}
+	for _, e := range elems {
+		if e.IDCard == card.ID {
+			t.Elements = append(t.Elements, e.ID)
+		}
+	}
+
+	return nil
+}
+
+// Fill the state tokens, elements and requirement needed to reach a card.
+func loadTargetConditions(db gorp.SqlExecutor, scenar *models.Scenario, card *models.Card, t *RunTarget) error {
+
+	tkLinks, err := models.ListStateTokenLinks(db, scenar, card, nil)
+	if err != nil {
+		return err
+	}
+	for _, tl := range tkLinks {
+		if !tl.UnlocksUnlocked {
+			t.Tokens = append(t.Tokens, tl.IDStateToken)
+		}
+	}
+
+	elemLinks, err := models.ListElementLinks(db, scenar, card, nil)
+	if err != nil {
+		return err
+	}
+	for _, el := range elemLinks {
+		if !el.GivesUses {
+			t.Elements = append(t.Elements, el.IDElement)
+		}
+	}
+
+	req, err := models.LoadRequirementFromCard(db, card)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if req != nil {
+		t.Requirement = req.Expression
+	}
+
+	return nil
+}
+
+// Estimate the Time Units needed to reach a card along a location graph.
+// Runs start in any of the non-hidden locations. A run visits cards, paying their TU cost,
+// and the travel cost of each revealed location the first time it enters it
+// (the cheapest of the links revealing it). Travelling back to a location is free.
+// Cards are locked by their state tokens and their requirement.
+// Element combinations are free: a run gets what they give as soon as it holds all of their inputs.
+// Only cards that bring something new (locations, state tokens, elements) are considered:
+// exploring the other cards is not part of the estimate.
+func EstimateRun(locs []*models.LocGraph, combs []*models.CombGraph, target *RunTarget, TUPerRun uint) (*RunEstimate, error) {
+
+	g := newRunGraph(locs, combs)
+
+	// Location card reaching the target
+	targets := make(map[int64]bool)
+	if _, ok := g.cardLoc[target.IDCard]; ok {
+		targets[target.IDCard] = true
+	}
+	if len(targets) == 0 && !target.conditional() {
+		return nil, ErrTargetNotFound
+	}
+
+	est := &RunEstimate{
+		IDTarget: target.IDCard,
+		Path:     []int64{},
+		TUPerRun: TUPerRun,
+	}
+
+	minCost := func(c *models.CardGraph) float64 {
+		return float64(c.TUCost)
+	}
+	expectedCost := func(c *models.CardGraph) float64 {
+		// Each failed round of skill test costs the card's TU again
+		rounds := 1 + float64(len(c.SkillTests))*(1/SKILL_TEST_SUCCESS-1)
+		return float64(c.TUCost) * rounds
+	}
+
+	best, err := g.search(target, targets, minCost)
+	if err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return est, nil
+	}
+	expected, err := g.search(target, targets, expectedCost)
+	if err != nil {
+		return nil, err
+	}
+
+	est.Reachable = true
+	est.MinTU = uint(best.cost)
+	est.ExpectedTU = expected.cost
+	est.Path = best.path
+	est.Winnable = TUPerRun > 0 && est.MinTU <= TUPerRun
+	if TUPerRun > 0 {
+		est.Runs = int(math.Ceil(est.ExpectedTU / float64(TUPerRun)))
+		if est.Runs < 1 {
+			est.Runs = 1
+		}
+	}
+
+	return est, nil
+}
+
+type runGraph struct {
+	cards   []*models.CardGraph
+	combs   []*models.CombGraph
+	cardLoc map[int64]int64
+	start   map[int64]bool // Non-hidden locations
+	travel  map[int64]uint // Cheapest travel to hidden locations
+}
+
+func newRunGraph(locs []*models.LocGraph, combs []*models.CombGraph) *runGraph {
+	g := &runGraph{
+		combs:   combs,
+		cardLoc: make(map[int64]int64),
+		start:   make(map[int64]bool),
+		travel:  make(map[int64]uint),
+	}
+
+	for _, loc := range locs {
+		if !loc.Hidden {
+			g.start[loc.ID] = true
+		}
+		for _, c := range loc.Cards {
+			g.cards = append(g.cards, c)
+			g.cardLoc[c.ID] = loc.ID
+		}
+	}
+
+	travelCosts := make([]map[int64]uint, 0, len(g.cards)+len(combs))
+	for _, c := range g.cards {
+		travelCosts = append(travelCosts, c.TravelTUCosts)
+	}
+	for _, cb := range combs {
+		travelCosts = append(travelCosts, cb.TravelTUCosts)
+	}
+	for _, costs := range travelCosts {
+		for IDLoc, cost := range costs {
+			if prev, ok := g.travel[IDLoc]; !ok || cost < prev {
+				g.travel[IDLoc] = cost
+			}
+		}
+	}
+
+	return g
+}
+
+// runState is what a run has achieved so far.
+type runState struct {
+	revealed map[int64]bool
+	entered  map[int64]bool
+	tokens   map[int64]bool
+	elements map[int64]bool
+	combined map[int64]bool
+	done     bool // Target reached
+	cost     float64
+	path     []int64
+}
+
+func (s *runState) key() string {
+	return fmt.Sprint(sortedSet(s.revealed), sortedSet(s.entered), sortedSet(s.tokens), sortedSet(s.elements), s.done)
+}
+
+// Uniform-cost search of the cheapest run reaching the target, by visiting any of the target cards
+// or meeting its conditions. Returns nil if it cannot be reached.
+func (g *runGraph) search(target *RunTarget, targets map[int64]bool, cardCost func(*models.CardGraph) float64) (*runState, error) {
+
+	init := &runState{
+		revealed: copySet(g.start),
+		entered:  make(map[int64]bool),
+		tokens:   make(map[int64]bool),
+		elements: make(map[int64]bool),
+		combined: make(map[int64]bool),
+		path:     []int64{},
+	}
+	init.done = target.conditional() && target.met(init)
+
+	queue := &runQueue{init}
+	closed := make(map[string]bool)
+
+	for queue.Len() > 0 {
+		s := heap.Pop(queue).(*runState)
+		if s.done {
+			return s, nil
+		}
+		k := s.key()
+		if closed[k] {
+			continue
+		}
+		closed[k] = true
+		if len(closed) > MAX_SEARCH_STATES {
+			return nil, ErrTooComplex
+		}
+
+		for _, c := range g.cards {
+			next := g.visit(s, c, target, targets, cardCost)
+			if next != nil && !closed[next.key()] {
+				heap.Push(queue, next)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// State after visiting a card, nil if the card cannot be visited or brings nothing new.
+func (g *runGraph) visit(s *runState, c *models.CardGraph, target *RunTarget, targets map[int64]bool, cardCost func(*models.CardGraph) float64) *runState {
+	IDLoc := g.cardLoc[c.ID]
+	if !s.revealed[IDLoc] {
+		return nil
+	}
+	for _, tk := range c.IsUnlockedStateTokens {
+		if !s.tokens[tk] {
+			return nil
+		}
+	}
+	if c.Requirement != nil && !c.Requirement.Eval(s.tokens, s.elements) {
+		return nil
+	}
+
+	useful := targets[c.ID]
+	for _, l := range c.Reveals {
+		useful = useful || !s.revealed[l]
+	}
+	for _, tk := range c.UnlockStateTokens {
+		useful = useful || !s.tokens[tk]
+	}
+	for _, e := range c.GivesElements {
+		useful = useful || !s.elements[e]
+	}
+	if !useful {
+		return nil
+	}
+
+	next := &runState{
+		revealed: copySet(s.revealed),
+		entered:  copySet(s.entered),
+		tokens:   copySet(s.tokens),
+		elements: copySet(s.elements),
+		combined: copySet(s.combined),
+		done:     targets[c.ID],
+		cost:     s.cost + cardCost(c),
+		path:     append(s.path[:len(s.path):len(s.path)], c.ID),
+	}
+	if !s.entered[IDLoc] {
+		next.entered[IDLoc] = true
+		if !g.start[IDLoc] {
+			next.cost += float64(g.travel[IDLoc])
+		}
+	}
+	next.gain(c)
+	g.combine(next)
+	next.done = next.done || (target.conditional() && target.met(next))
+
+	return next
+}
+
+// Gain what a card or combination gives.
+func (s *runState) gain(c *models.CardGraph) {
+	for _, l := range c.Reveals {
+		s.revealed[l] = true
+	}
+	for _, tk := range c.UnlockStateTokens {
+		s.tokens[tk] = true
+	}
+	for _, e := range c.GivesElements {
+		s.elements[e] = true
+	}
+}
+
+// Apply the combinations whose input elements are all held, until none is left.
+func (g *runGraph) combine(s *runState) {
+	for changed := true; changed; {
+		changed = false
+		for _, cb := range g.combs {
+			if s.combined[cb.ID] || !holdsAll(s.elements, cb.Inputs) {
+				continue
+			}
+			s.combined[cb.ID] = true
+			changed = true
+			s.gain(&cb.CardGraph)
+		}
+	}
+}
+
+// runQueue is a priority queue of run states, cheapest first.
+type runQueue []*runState
+
+func (q runQueue) Len() int            { return len(q) }
+func (q runQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q runQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *runQueue) Push(x interface{}) { *q = append(*q, x.(*runState)) }
+func (q *runQueue) Pop() interface{} {
+	old := *q
+	s := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return s
+}
+
+func copySet(m map[int64]bool) map[int64]bool {
+	ret := make(map[int64]bool, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
+
+func sortedSet(m map[int64]bool) []int64 {
+	keys := make([]int64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,190 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/loopfz/scecret/models"
+)
+
+// L1 (start): c1 reveals L2 (travel 2), c2 gives token 1 after a skill test, c4 reveals L2 (travel 5),
+// c5 gives nothing. L2 (hidden): c3 is unlocked by token 1.
+func testLocs() []*models.LocGraph {
+	return []*models.LocGraph{
+		{ID: 1, Cards: []*models.CardGraph{
+			{ID: 1, TUCost: 1, Reveals: []int64{2}, TravelTUCosts: map[int64]uint{2: 2}},
+			{ID: 2, TUCost: 3, UnlockStateTokens: []int64{1}, SkillTests: []int64{9}},
+			{ID: 4, TUCost: 1, Reveals: []int64{2}, TravelTUCosts: map[int64]uint{2: 5}},
+			{ID: 5, TUCost: 1},
+		}},
+		{ID: 2, Hidden: true, Cards: []*models.CardGraph{
+			{ID: 3, TUCost: 1, IsUnlockedStateTokens: []int64{1}},
+		}},
+	}
+}
+
+// Token 1 or element 8.
+func orRequirement(IDToken, IDElement int64) *models.RequirementExpr {
+	return &models.RequirementExpr{Op: models.RequirementOr, Operands: []*models.RequirementExpr{
+		{Op: models.RequirementToken, IDStateToken: IDToken},
+		{Op: models.RequirementElement, IDElement: IDElement},
+	}}
+}
+
+// Combining elements 6 and 7 gives element 8.
+func testCombs() []*models.CombGraph {
+	return []*models.CombGraph{
+		{CardGraph: models.CardGraph{ID: 1, GivesElements: []int64{8}}, Inputs: []int64{6, 7}},
+	}
+}
+
+func TestEstimateRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		edit       func(locs []*models.LocGraph)
+		target     *RunTarget
+		err        error
+		reachable  bool
+		minTU      uint
+		expectedTU float64
+		path       []int64 // Not checked if nil, when visiting order is not fixed
+	}{
+		{
+			name:       "locked card behind a revealed location",
+			target:     &RunTarget{IDCard: 3},
+			reachable:  true,
+			minTU:      7, // 1 + 3 + 2 + 1
+			expectedTU: 10,
+			path:       []int64{1, 2, 3},
+		},
+		{
+			name:       "card of a start location",
+			target:     &RunTarget{IDCard: 5},
+			reachable:  true,
+			minTU:      1,
+			expectedTU: 1,
+			path:       []int64{5},
+		},
+		{
+			name:   "unlocking token never given",
+			edit:   func(locs []*models.LocGraph) { locs[1].Cards[0].IsUnlockedStateTokens = []int64{7} },
+			target: &RunTarget{IDCard: 3},
+			path:   []int64{},
+		},
+		{
+			name:   "not a location card",
+			target: &RunTarget{IDCard: 42},
+			err:    ErrTargetNotFound,
+		},
+		{
+			name: "element card given by several location cards",
+			edit: func(locs []*models.LocGraph) {
+				locs[1].Cards[0].GivesElements = []int64{8}
+				locs[0].Cards[3].GivesElements = []int64{8}
+			},
+			target:     &RunTarget{IDCard: 42, Elements: []int64{8}},
+			reachable:  true,
+			minTU:      1,
+			expectedTU: 1,
+			path:       []int64{5},
+		},
+		{
+			name: "combined element card with both inputs given",
+			edit: func(locs []*models.LocGraph) {
+				locs[0].Cards[2].GivesElements = []int64{6}
+				locs[0].Cards[3].GivesElements = []int64{7}
+			},
+			target:     &RunTarget{IDCard: 42, Elements: []int64{8}},
+			reachable:  true,
+			minTU:      2,
+			expectedTU: 2,
+		},
+		{
+			name:   "combined element card with one input given",
+			edit:   func(locs []*models.LocGraph) { locs[0].Cards[3].GivesElements = []int64{6} },
+			target: &RunTarget{IDCard: 42, Elements: []int64{8}},
+			path:   []int64{},
+		},
+		{
+			name: "card using a combined element with one input given",
+			edit: func(locs []*models.LocGraph) {
+				locs[0].Cards[3].GivesElements = []int64{6}
+				locs[1].Cards[0].IsUnlockedStateTokens = nil
+				locs[1].Cards[0].Requirement = &models.RequirementExpr{Op: models.RequirementElement, IDElement: 8}
+			},
+			target: &RunTarget{IDCard: 3},
+			path:   []int64{},
+		},
+		{
+			name:       "mission success unlocked by a token",
+			target:     &RunTarget{IDCard: 42, Tokens: []int64{1}},
+			reachable:  true,
+			minTU:      3,
+			expectedTU: 6,
+			path:       []int64{2},
+		},
+		{
+			name:       "mission success using an element",
+			edit:       func(locs []*models.LocGraph) { locs[1].Cards[0].GivesElements = []int64{8} },
+			target:     &RunTarget{IDCard: 42, Elements: []int64{8}},
+			reachable:  true,
+			minTU:      7,
+			expectedTU: 10,
+			path:       []int64{1, 2, 3},
+		},
+		{
+			name:   "mission success using an element never given",
+			target: &RunTarget{IDCard: 42, Elements: []int64{8}},
+			path:   []int64{},
+		},
+		{
+			name:       "codex with a requirement",
+			edit:       func(locs []*models.LocGraph) { locs[0].Cards[3].GivesElements = []int64{8} },
+			target:     &RunTarget{IDCard: 42, Requirement: orRequirement(1, 8)},
+			reachable:  true,
+			minTU:      1,
+			expectedTU: 1,
+			path:       []int64{5},
+		},
+		{
+			name: "card locked by a requirement",
+			edit: func(locs []*models.LocGraph) {
+				locs[1].Cards[0].IsUnlockedStateTokens = nil
+				locs[1].Cards[0].Requirement = orRequirement(1, 8)
+			},
+			target:     &RunTarget{IDCard: 3},
+			reachable:  true,
+			minTU:      7,
+			expectedTU: 10,
+			path:       []int64{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locs := testLocs()
+			if tt.edit != nil {
+				tt.edit(locs)
+			}
+			est, err := EstimateRun(locs, testCombs(), tt.target, 6)
+			if err != tt.err {
+				t.Fatalf("got error %v, expected %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if est.IDTarget != tt.target.IDCard {
+				t.Errorf("got target %d, expected %d", est.IDTarget, tt.target.IDCard)
+			}
+			if est.Reachable != tt.reachable {
+				t.Fatalf("got reachable %v, expected %v", est.Reachable, tt.reachable)
+			}
+			if est.MinTU != tt.minTU || est.ExpectedTU != tt.expectedTU {
+				t.Errorf("got %d/%v TU, expected %d/%v", est.MinTU, est.ExpectedTU, tt.minTU, tt.expectedTU)
+			}
+			if tt.path != nil && !reflect.DeepEqual(est.Path, tt.path) {
+				t.Errorf("got path %v, expected %v", est.Path, tt.path)
+			}
+		})
+	}
+}
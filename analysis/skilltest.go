@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"errors"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+)
+
+// Skill tests are played in rounds: the character rolls as many skill dice as its stat value,
+// and removes shields with the results. Removed shields stay removed, the test goes on until
+// all shields are removed. Each round costs the Time Units of the card.
+// The calculator models the shields as follows:
+//   - stars remove heart, UT, normal and special shields, one star each, in that order
+//   - skulls remove skull shields, one skull each. A skull with no skull shield left to remove
+//     deals 1 damage to the character
+//   - each heart shield left at the end of a round deals 1 damage
+//   - each UT shield left at the end of a round costs 1 more Time Unit
+
+const (
+	MAX_ROUNDS         = 10 // Rounds detailed in the odds
+	MAX_STAT_VALUE     = 6  // Default range of stat values in difficulty tables
+	DEFAULT_ROUND_COST = 1  // Time Units of a round, for cards without a cost
+
+	// Highest stat value the calculator accepts, as a die is rolled per point
+	MAX_DICE = models.MAX_STAT_VALUE
+)
+
+// DieFace is a face of a skill die.
+type DieFace struct {
+	Stars  uint `json:"stars"`
+	Skulls uint `json:"skulls"`
+}
+
+// Faces of a base game skill die.
+var DieFaces = []DieFace{
+	{Stars: 0}, {Stars: 0},
+	{Stars: 1}, {Stars: 1},
+	{Stars: 2},
+	{Skulls: 1},
+}
+
+// SkillTestOdds is the outcome of a skill test for a stat value.
+// Expected values are counted until the test is cleared.
+type SkillTestOdds struct {
+	StatValue      uint      `json:"stat_value"`
+	Clearable      bool      `json:"clearable"`
+	ByRound        []float64 `json:"by_round"` // Probability of having cleared the test after each round
+	ExpectedRounds float64   `json:"expected_rounds"`
+	ExpectedTU     float64   `json:"expected_tu"`
+	ExpectedDamage float64   `json:"expected_damage"`
+}
+
+// Compute the odds of a skill test for a stat value, with rounds costing roundTU Time Units.
+func ComputeSkillTestOdds(st *models.SkillTest, statValue uint, roundTU uint) *SkillTestOdds {
+
+	t := newTestChain(st, statValue, roundTU)
+
+	odds := &SkillTestOdds{
+		StatValue: statValue,
+		ByRound:   t.byRound(MAX_ROUNDS),
+	}
+
+	if t.stars == 0 && t.skulls == 0 {
+		odds.Clearable = true
+		return odds
+	}
+	if statValue == 0 {
+		return odds
+	}
+
+	odds.Clearable = true
+	odds.ExpectedRounds, odds.ExpectedTU, odds.ExpectedDamage = t.expected()
+
+	return odds
+}
+
+// DifficultyRow gives the odds of a skill test for a range of stat values,
+// and for each receptacle of the scenario.
+type DifficultyRow struct {
+	SkillTest   *models.SkillTest `json:"skill_test"`
+	Card        string            `json:"card"`
+	Stat        string            `json:"stat"`
+	Odds        []*SkillTestOdds  `json:"odds"` // By stat value, from 1
+	Receptacles []*ReceptacleOdds `json:"receptacles"`
+}
+
+// ReceptacleOdds gives the odds of a skill test for a receptacle's value of its stat.
+type ReceptacleOdds struct {
+	IDReceptacle int64          `json:"id_receptacle"`
+	Name         string         `json:"name"`
+	Odds         *SkillTestOdds `json:"odds"`
+}
+
+// Difficulty table of all the skill tests of a scenario, for stat values from 1 to maxStatValue.
+func ScenarioDifficulty(db gorp.SqlExecutor, scenar *models.Scenario, maxStatValue uint) ([]*DifficultyRow, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to compute scenario difficulty")
+	}
+
+	tests, err := models.ListSkillTests(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	receptacles, err := models.ListReceptacles(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := make(map[int64]*models.Card)
+	stats := make(map[int64]*models.Stat)
+
+	rows := []*DifficultyRow{}
+
+	for _, st := range tests {
+		card, ok := cards[st.IDCard]
+		if !ok {
+			card, err = models.LoadCardFromID(db, scenar, st.IDCard)
+			if err != nil {
+				return nil, err
+			}
+			cards[card.ID] = card
+		}
+		stat, ok := stats[st.IDStat]
+		if !ok {
+			stat, err = models.LoadStatFromID(db, scenar, st.IDStat)
+			if err != nil {
+				return nil, err
+			}
+			stats[stat.ID] = stat
+		}
+
+		row := &DifficultyRow{
+			SkillTest: st,
+			Card:      card.Description,
+			Stat:      stat.Name,
+		}
+		for v := uint(1); v <= maxStatValue; v++ {
+			row.Odds = append(row.Odds, ComputeSkillTestOdds(st, v, RoundCost(card)))
+		}
+		row.Receptacles = []*ReceptacleOdds{}
+		for _, r := range receptacles {
+			row.Receptacles = append(row.Receptacles, &ReceptacleOdds{
+				IDReceptacle: r.ID,
+				Name:         r.Name,
+				Odds:         ComputeSkillTestOdds(st, r.StatValue(st.IDStat), RoundCost(card)),
+			})
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Time Units of a round of skill test on a card.
+func RoundCost(card *models.Card) uint {
+	if card.TUCost == 0 {
+		return DEFAULT_ROUND_COST
+	}
+	return card.TUCost
+}
+
+// testChain is the Markov chain of a skill test. Stars remove shields in a fixed order,
+// so a state is the number of shields left that stars can remove, and the number of
+// skull shields left.
+type testChain struct {
+	hearts, uts, stars uint // Star shields: hearts first, then UT, then the others
+	skulls             uint
+	roundTU            uint
+	rolls              []roll
+}
+
+// roll is a result of a round, with its probability.
+type roll struct {
+	stars, skulls uint
+	p             float64
+}
+
+func newTestChain(st *models.SkillTest, statValue uint, roundTU uint) *testChain {
+	return &testChain{
+		hearts:  st.HeartShields,
+		uts:     st.UTShields,
+		stars:   st.HeartShields + st.UTShields + st.NormalShields + st.SpecialShields,
+		skulls:  st.SkullShields,
+		roundTU: roundTU,
+		rolls:   rollDistribution(statValue),
+	}
+}
+
+// Distribution of the results of rolling n dice.
+func rollDistribution(n uint) []roll {
+	dist := map[DieFace]float64{{}: 1}
+	for i := uint(0); i < n; i++ {
+		next := make(map[DieFace]float64)
+		for r, p := range dist {
+			for _, f := range DieFaces {
+				next[DieFace{Stars: r.Stars + f.Stars, Skulls: r.Skulls + f.Skulls}] += p / float64(len(DieFaces))
+			}
+		}
+		dist = next
+	}
+
+	rolls := make([]roll, 0, len(dist))
+	for r, p := range dist {
+		rolls = append(rolls, roll{stars: r.Stars, skulls: r.Skulls, p: p})
+	}
+	return rolls
+}
+
+// Apply a roll to a state: the state after the round, and the Time Units and damage of the round.
+func (t *testChain) step(stars, skulls uint, r roll) (uint, uint, float64, float64) {
+	nextStars := sub(stars, r.stars)
+	nextSkulls := sub(skulls, r.skulls)
+
+	// Star shields left, among hearts and UT (removed first)
+	removed := t.stars - nextStars
+	heartsLeft := sub(t.hearts, removed)
+	utsLeft := sub(t.uts, sub(removed, t.hearts))
+
+	damage := float64(sub(r.skulls, skulls) + heartsLeft)
+	tu := float64(t.roundTU + utsLeft)
+
+	return nextStars, nextSkulls, tu, damage
+}
+
+// Probability of having cleared the test after each round.
+func (t *testChain) byRound(rounds int) []float64 {
+	type state struct{ stars, skulls uint }
+
+	dist := map[state]float64{{t.stars, t.skulls}: 1}
+	ret := make([]float64, rounds)
+
+	for i := range ret {
+		next := make(map[state]float64)
+		for s, p := range dist {
+			if s.stars == 0 && s.skulls == 0 {
+				next[s] += p
+				continue
+			}
+			for _, r := range t.rolls {
+				stars, skulls, _, _ := t.step(s.stars, s.skulls, r)
+				next[state{stars, skulls}] += p * r.p
+			}
+		}
+		dist = next
+		ret[i] = dist[state{}]
+	}
+
+	return ret
+}
+
+// Expected rounds, Time Units and damage until the test is cleared.
+// States are solved from the cleared state up: a roll can only remove shields.
+func (t *testChain) expected() (float64, float64, float64) {
+
+	type value struct{ rounds, tu, damage float64 }
+	values := make([][]value, t.stars+1)
+
+	for stars := uint(0); stars <= t.stars; stars++ {
+		values[stars] = make([]value, t.skulls+1)
+		for skulls := uint(0); skulls <= t.skulls; skulls++ {
+			if stars == 0 && skulls == 0 {
+				continue
+			}
+			var v value
+			var stay float64
+			for _, r := range t.rolls {
+				s, k, tu, damage := t.step(stars, skulls, r)
+				v.rounds += r.p
+				v.tu += r.p * tu
+				v.damage += r.p * damage
+				if s == stars && k == skulls {
+					stay += r.p
+					continue
+				}
+				v.rounds += r.p * values[s][k].rounds
+				v.tu += r.p * values[s][k].tu
+				v.damage += r.p * values[s][k].damage
+			}
+			// Rounds without progress are repeated
+			values[stars][skulls] = value{v.rounds / (1 - stay), v.tu / (1 - stay), v.damage / (1 - stay)}
+		}
+	}
+
+	v := values[t.stars][t.skulls]
+	return v.rounds, v.tu, v.damage
+}
+
+func sub(a, b uint) uint {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
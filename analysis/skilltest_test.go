@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+
+	"github.com/loopfz/scecret/models"
+)
+
+func TestTestChainExpected(t *testing.T) {
+	tests := []struct {
+		name      string
+		st        models.SkillTest
+		statValue uint
+		roundTU   uint
+		rounds    float64
+		tu        float64
+		damage    float64
+	}{
+		{
+			// Half of the faces have a star, the skull face deals damage
+			name:      "normal shield",
+			st:        models.SkillTest{NormalShields: 1},
+			statValue: 1,
+			roundTU:   1,
+			rounds:    2,
+			tu:        2,
+			damage:    1. / 3,
+		},
+		{
+			name:      "normal shield, costly rounds",
+			st:        models.SkillTest{NormalShields: 1},
+			statValue: 1,
+			roundTU:   3,
+			rounds:    2,
+			tu:        6,
+			damage:    1. / 3,
+		},
+		{
+			name:      "skull shield",
+			st:        models.SkillTest{SkullShields: 1},
+			statValue: 1,
+			roundTU:   1,
+			rounds:    6,
+			tu:        6,
+			damage:    0,
+		},
+		{
+			// The heart shield deals 1 damage on each failed round
+			name:      "heart shield",
+			st:        models.SkillTest{HeartShields: 1},
+			statValue: 1,
+			roundTU:   1,
+			rounds:    2,
+			tu:        2,
+			damage:    4. / 3,
+		},
+		{
+			// The UT shield costs 1 more TU on each failed round
+			name:      "UT shield",
+			st:        models.SkillTest{UTShields: 1},
+			statValue: 1,
+			roundTU:   1,
+			rounds:    2,
+			tu:        3,
+			damage:    1. / 3,
+		},
+		{
+			// A skull removing the skull shield deals no damage, the star shield is then cleared in 2 rounds
+			name:      "normal and skull shields",
+			st:        models.SkillTest{NormalShields: 1, SkullShields: 1},
+			statValue: 1,
+			roundTU:   1,
+			rounds:    6.5,
+			tu:        6.5,
+			damage:    1. / 12,
+		},
+		{
+			// Each die clears the shield with probability 1/2
+			name:      "normal shield, two dice",
+			st:        models.SkillTest{NormalShields: 1},
+			statValue: 2,
+			roundTU:   1,
+			rounds:    4. / 3,
+			tu:        4. / 3,
+			damage:    4. / 9, // 1/3 skull per round
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rounds, tu, damage := newTestChain(&tt.st, tt.statValue, tt.roundTU).expected()
+			for _, v := range []struct {
+				name          string
+				got, expected float64
+			}{{"rounds", rounds, tt.rounds}, {"TU", tu, tt.tu}, {"damage", damage, tt.damage}} {
+				if math.Abs(v.got-v.expected) > 1e-9 {
+					t.Errorf("%s: got %v, expected %v", v.name, v.got, v.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeSkillTestOdds(t *testing.T) {
+	tests := []struct {
+		name      string
+		st        models.SkillTest
+		statValue uint
+		clearable bool
+		byRound   []float64 // First rounds
+	}{
+		{
+			name:      "no shield",
+			st:        models.SkillTest{},
+			statValue: 0,
+			clearable: true,
+			byRound:   []float64{1, 1},
+		},
+		{
+			name:      "no dice",
+			st:        models.SkillTest{NormalShields: 1},
+			statValue: 0,
+			clearable: false,
+			byRound:   []float64{0, 0},
+		},
+		{
+			name:      "normal shield",
+			st:        models.SkillTest{NormalShields: 1},
+			statValue: 1,
+			clearable: true,
+			byRound:   []float64{0.5, 0.75, 0.875},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			odds := ComputeSkillTestOdds(&tt.st, tt.statValue, 1)
+			if odds.Clearable != tt.clearable {
+				t.Errorf("got clearable %v, expected %v", odds.Clearable, tt.clearable)
+			}
+			if len(odds.ByRound) != MAX_ROUNDS {
+				t.Fatalf("got %d rounds, expected %d", len(odds.ByRound), MAX_ROUNDS)
+			}
+			for i, p := range tt.byRound {
+				if math.Abs(odds.ByRound[i]-p) > 1e-9 {
+					t.Errorf("round %d: got %v, expected %v", i+1, odds.ByRound[i], p)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/analysis"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type GetReachabilityIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func GetReachability(c *gin.Context, in *GetReachabilityIn) (*analysis.Reachability, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return analysis.ScenarioReachability(db, sc)
+}
+
+type GetRunEstimateIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDTarget   int64 `query:"target, required"` // Card to reach, e.g. the mission success
+	TUPerRun   *uint `query:"tu_per_run"`       // Default: DEFAULT_TU_PER_RUN
+}
+
+// Estimate the Time Units and number of runs needed to reach a card.
+func GetRunEstimate(c *gin.Context, in *GetRunEstimateIn) (*analysis.RunEstimate, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := models.LoadCardFromID(db, sc, in.IDTarget)
+	if err != nil {
+		return nil, errors.NewNotFound(err, "No such target card")
+	}
+
+	var TUPerRun uint = analysis.DEFAULT_TU_PER_RUN
+	if in.TUPerRun != nil {
+		TUPerRun = *in.TUPerRun
+	}
+
+	est, err := analysis.ScenarioRunEstimate(db, sc, target, TUPerRun)
+	if err == analysis.ErrTargetNotFound {
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+	return est, err
+}
+
+type GetSkillTestOddsIn struct {
+	IDScenario   int64  `path:"scenario, required"`
+	IDSkillTest  int64  `path:"skilltest, required"`
+	StatValue    *uint  `query:"stat_value"`
+	IDReceptacle *int64 `query:"receptacle"` // Use the receptacle's value for the stat of the test
+}
+
+// Odds of clearing a skill test for a stat value, with the expected Time Units and damage.
+// The stat value is either given, or read from a receptacle.
+func GetSkillTestOdds(c *gin.Context, in *GetSkillTestOddsIn) (*analysis.SkillTestOdds, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := models.LoadSkillTestFromID(db, sc, in.IDSkillTest)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := models.LoadCardFromID(db, sc, st.IDCard)
+	if err != nil {
+		return nil, err
+	}
+
+	var value uint
+	switch {
+	case in.StatValue != nil:
+		value = *in.StatValue
+	case in.IDReceptacle != nil:
+		r, err := models.LoadReceptacleFromID(db, sc, *in.IDReceptacle)
+		if err != nil {
+			return nil, err
+		}
+		value = r.StatValue(st.IDStat)
+	default:
+		return nil, errors.NewBadRequest(nil, "Missing stat_value or receptacle")
+	}
+	if value > analysis.MAX_DICE {
+		return nil, errors.NewBadRequest(nil, fmt.Sprintf("Stat value cannot exceed %d", analysis.MAX_DICE))
+	}
+
+	return analysis.ComputeSkillTestOdds(st, value, analysis.RoundCost(card)), nil
+}
+
+type GetDifficultyIn struct {
+	IDScenario   int64 `path:"scenario, required"`
+	MaxStatValue *uint `query:"max_stat_value"` // Default: MAX_STAT_VALUE
+}
+
+// Difficulty table of all the skill tests of a scenario, with the odds of each receptacle.
+func GetDifficulty(c *gin.Context, in *GetDifficultyIn) ([]*analysis.DifficultyRow, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	var max uint = analysis.MAX_STAT_VALUE
+	if in.MaxStatValue != nil {
+		max = *in.MaxStatValue
+	}
+	if max > analysis.MAX_DICE {
+		return nil, errors.NewBadRequest(nil, fmt.Sprintf("max_stat_value cannot exceed %d", analysis.MAX_DICE))
+	}
+
+	return analysis.ScenarioDifficulty(db, sc, max)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/archive"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+const (
+	MAX_ARCHIVE_SIZE = 200 << 20 // In bytes
+)
+
+// Export a scenario as a ZIP archive, including the icon and background images.
+func ExportArchive(c *gin.Context) {
+
+	db := getDB(c)
+
+	IDScenario, err := int64Param(c, "scenario")
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	sc, err := auth.RetrieveTokenScenario(db, c, IDScenario, models.RoleViewer)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	b, err := archive.Dump(db, sc)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = b.WriteZip(&buf)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="scenario_%d.zip"`, sc.ID))
+	c.Data(200, "application/zip", buf.Bytes())
+}
+
+// Import a ZIP archive (raw request body) as a new scenario belonging to the current user.
+// Query parameters:
+//
+//	name: name of the new scenario, defaults to the name stored in the archive
+func ImportArchive(c *gin.Context) {
+
+	db := getDB(c)
+
+	u, err := auth.RetrieveTokenUser(db, c)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, MAX_ARCHIVE_SIZE+1))
+	if err != nil {
+		renderError(c, errors.NewBadRequest(err, "Could not read archive"))
+		return
+	}
+	if len(data) > MAX_ARCHIVE_SIZE {
+		renderError(c, errors.NewBadRequest(nil, "Archive too big"))
+		return
+	}
+
+	b, err := archive.ReadZip(data)
+	if err != nil {
+		renderError(c, errors.NewBadRequest(err, err.Error()))
+		return
+	}
+
+	sc, err := archive.Restore(db, b, u, c.Query("name"))
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	c.JSON(201, sc)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/gadgeto/tonic/jujuerrhook"
+	"github.com/loopfz/scecret/models"
+)
+
+// Handlers serving non-JSON content (PDF, images, ...) cannot go through tonic.
+// These helpers give them the same parameter parsing and error output.
+
+func int64Param(c *gin.Context, name string) (int64, error) {
+	i, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil {
+		return 0, errors.NewBadRequest(err, fmt.Sprintf("Invalid %s parameter", name))
+	}
+	return i, nil
+}
+
+func renderError(c *gin.Context, err error) {
+	code, resp := jujuerrhook.ErrHook(err)
+	c.JSON(code, resp)
+}
+
+// Serve an uploaded image. Uploaded SVG documents are not sanitized: they are served
+// as attachments, with a CSP forbidding scripts, so that they cannot run in the API origin
+// when opened directly. They still display in <img> tags.
+func renderImage(c *gin.Context, img *models.Image) {
+	data, err := img.Content()
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	if img.Format == models.ImageFormatSVG {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="image_%d.svg"`, img.ID))
+	}
+
+	c.Data(200, img.ContentType(), data)
+}
@@ -1,23 +1,47 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"github.com/loopfz/scecret/auth"
 	"github.com/loopfz/scecret/models"
+	"github.com/loopfz/scecret/render"
 )
 
 type ListCardsIn struct {
-	IDScenario int64 `path:"scenario, required"`
+	IDScenario int64  `path:"scenario, required"`
+	CardType   string `query:"type"` // Optional filter on card type
 }
 
 func ListCards(c *gin.Context, in *ListCardsIn) ([]*models.Card, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	cards, err := models.ListCards(db, sc)
 	if err != nil {
 		return nil, err
 	}
 
-	return models.ListCards(db, sc)
+	if in.CardType == "" {
+		return cards, nil
+	}
+
+	ret := []*models.Card{}
+	for _, card := range cards {
+		if card.CardType == in.CardType {
+			ret = append(ret, card)
+		}
+	}
+
+	return ret, nil
 }
 
 type GetCardIn struct {
@@ -27,7 +51,9 @@ type GetCardIn struct {
 
 func GetCard(c *gin.Context, in *GetCardIn) (*models.Card, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -42,11 +68,14 @@ type UpdateCardIn struct {
 	Description string           `json:"description" binding:"required"`
 	Front       *models.CardFace `json:"front" binding:"required"`
 	Back        *models.CardFace `json:"back" binding:"required"`
+	TUCost      *uint            `json:"tu_cost"` // Unchanged if omitted
 }
 
 func UpdateCard(c *gin.Context, in *UpdateCardIn) (*models.Card, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +85,12 @@ func UpdateCard(c *gin.Context, in *UpdateCardIn) (*models.Card, error) {
 		return nil, err
 	}
 
-	err = card.Update(db, in.Number, in.Description, in.Front, in.Back)
+	TUCost := card.TUCost
+	if in.TUCost != nil {
+		TUCost = *in.TUCost
+	}
+
+	err = card.Update(db, in.Number, in.Description, in.Front, in.Back, TUCost)
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +98,78 @@ func UpdateCard(c *gin.Context, in *UpdateCardIn) (*models.Card, error) {
 	return card, nil
 }
 
+// Render one face of a card as an image.
+// Query parameters:
+//
+//	face: "front" (default) or "back"
+//	format: "png" (default) or "svg"
+func RenderCard(c *gin.Context) {
+
+	db := getDB(c)
+
+	IDScenario, err := int64Param(c, "scenario")
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+	IDCard, err := int64Param(c, "card")
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	var front bool
+	switch face := c.DefaultQuery("face", "front"); face {
+	case "front":
+		front = true
+	case "back":
+		front = false
+	default:
+		renderError(c, errors.NewBadRequest(nil, fmt.Sprintf("Unknown face: %s", face)))
+		return
+	}
+
+	format := c.DefaultQuery("format", "png")
+	if format != "png" && format != "svg" {
+		renderError(c, errors.NewBadRequest(nil, fmt.Sprintf("Unknown format: %s", format)))
+		return
+	}
+
+	sc, err := auth.RetrieveTokenScenario(db, c, IDScenario, models.RoleViewer)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	card, err := models.LoadCardFromID(db, sc, IDCard)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	deck, dc, err := render.LoadDeckCard(db, sc, card)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	if format == "svg" {
+		contentType = "image/svg+xml"
+		err = deck.WriteSVG(&buf, dc, front)
+	} else {
+		contentType = "image/png"
+		err = deck.WritePNG(&buf, dc, front)
+	}
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	c.Data(200, contentType, buf.Bytes())
+}
+
 type NewCardIconIn struct {
 	IDScenario     int64  `path:"scenario, required"`
 	IDCard         int64  `path:"card, required"`
@@ -79,7 +185,9 @@ type NewCardIconIn struct {
 
 func NewCardIcon(c *gin.Context, in *NewCardIconIn) (*models.CardIcon, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +203,7 @@ func NewCardIcon(c *gin.Context, in *NewCardIconIn) (*models.CardIcon, error) {
 	}
 
 	return card.CreateCardIcon(db, ico, in.FrontBack, in.X, in.Y, in.SizeX, in.SizeY,
-		in.Annotation, in.AnnotationType, nil, nil)
+		in.Annotation, in.AnnotationType, nil, nil, nil, nil)
 }
 
 type ListCardIconsIn struct {
@@ -105,7 +213,9 @@ type ListCardIconsIn struct {
 
 func ListCardIcons(c *gin.Context, in *ListCardIconsIn) ([]*models.CardIcon, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -115,7 +225,7 @@ func ListCardIcons(c *gin.Context, in *ListCardIconsIn) ([]*models.CardIcon, err
 		return nil, err
 	}
 
-	return card.ListCardIcons(db, nil, nil)
+	return card.ListCardIcons(db, nil, nil, nil, nil)
 }
 
 type GetCardIconIn struct {
@@ -126,7 +236,9 @@ type GetCardIconIn struct {
 
 func GetCardIcon(c *gin.Context, in *GetCardIconIn) (*models.CardIcon, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -155,7 +267,9 @@ type UpdateCardIconIn struct {
 
 func UpdateCardIcon(c *gin.Context, in *UpdateCardIconIn) (*models.CardIcon, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +306,9 @@ type DeleteCardIconIn struct {
 
 func DeleteCardIcon(c *gin.Context, in *DeleteCardIconIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
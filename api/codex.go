@@ -0,0 +1,109 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type NewCodexIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	Number     int    `json:"number" binding:"required"`
+	Entry      string `json:"entry"`
+}
+
+func NewCodex(c *gin.Context, in *NewCodexIn) (*models.Codex, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.CreateCodex(db, sc, in.Number, in.Entry)
+}
+
+type ListCodicesIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func ListCodices(c *gin.Context, in *ListCodicesIn) ([]*models.Codex, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListCodices(db, sc)
+}
+
+type GetCodexIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDCodex    int64 `path:"codex, required"`
+}
+
+func GetCodex(c *gin.Context, in *GetCodexIn) (*models.Codex, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.LoadCodexFromID(db, sc, in.IDCodex)
+}
+
+type UpdateCodexIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	IDCodex    int64  `path:"codex, required"`
+	Number     int    `json:"number" binding:"required"`
+	Entry      string `json:"entry"`
+}
+
+func UpdateCodex(c *gin.Context, in *UpdateCodexIn) (*models.Codex, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	cx, err := models.LoadCodexFromID(db, sc, in.IDCodex)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cx.Update(db, in.Number, in.Entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return cx, nil
+}
+
+type DeleteCodexIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDCodex    int64 `path:"codex, required"`
+}
+
+func DeleteCodex(c *gin.Context, in *DeleteCodexIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	cx, err := models.LoadCodexFromID(db, sc, in.IDCodex)
+	if err != nil {
+		return err
+	}
+
+	return cx.Delete(db)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/archive"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/diff"
+	"github.com/loopfz/scecret/models"
+)
+
+type DiffScenariosIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDOther    int64 `path:"other, required"`
+}
+
+// Changes to go from a scenario to another.
+func DiffScenarios(c *gin.Context, in *DiffScenariosIn) ([]*diff.Change, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	other, err := auth.RetrieveTokenScenario(db, c, in.IDOther, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := archive.DumpRows(db, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := archive.DumpRows(db, other)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff.Compare(db, from, to)
+}
+
+type DiffRevisionsIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDRevision int64 `path:"revision, required"`
+	To         int64 `query:"to"` // Revision to compare to, current state if empty
+}
+
+// Changes made to a scenario since a revision (or between two revisions).
+func DiffRevisions(c *gin.Context, in *DiffRevisionsIn) ([]*diff.Change, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := models.LoadRevisionFromID(db, sc, in.IDRevision)
+	if err != nil {
+		return nil, errors.NewNotFound(err, "No such revision")
+	}
+
+	from, err := archive.DumpRevision(db, sc, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var to *archive.Bundle
+
+	if in.To != 0 {
+		toRev, err := models.LoadRevisionFromID(db, sc, in.To)
+		if err != nil {
+			return nil, errors.NewNotFound(err, "No such revision")
+		}
+		to, err = archive.DumpRevision(db, sc, toRev)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		to, err = archive.DumpRows(db, sc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return diff.Compare(db, from, to)
+}
@@ -14,7 +14,9 @@ type NewElementIn struct {
 
 func NewElement(c *gin.Context, in *NewElementIn) (*models.Element, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +30,9 @@ type ListElementsIn struct {
 
 func ListElements(c *gin.Context, in *ListElementsIn) ([]*models.Element, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +47,9 @@ type GetElementIn struct {
 
 func GetElement(c *gin.Context, in *GetElementIn) (*models.Element, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +67,9 @@ type UpdateElementIn struct {
 
 func UpdateElement(c *gin.Context, in *UpdateElementIn) (*models.Element, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +94,9 @@ type DeleteElementIn struct {
 
 func DeleteElement(c *gin.Context, in *DeleteElementIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type NewElementCombinationIn struct {
+	IDScenario int64   `path:"scenario, required"`
+	IDElem     int64   `json:"id_element" binding:"required"`
+	Inputs     []int64 `json:"inputs" binding:"required"` // Element IDs
+}
+
+func NewElementCombination(c *gin.Context, in *NewElementCombinationIn) (*models.ElementCombination, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	elem, err := models.LoadElementFromID(db, sc, in.IDElem)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := loadElements(db, sc, in.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.CreateElementCombination(db, sc, elem, inputs)
+}
+
+func loadElements(db gorp.SqlExecutor, sc *models.Scenario, IDs []int64) ([]*models.Element, error) {
+	elems := []*models.Element{}
+	for _, ID := range IDs {
+		elem, err := models.LoadElementFromID(db, sc, ID)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+type ListElementCombinationsIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	IDElem     *int64 `query:"id_element"`
+}
+
+func ListElementCombinations(c *gin.Context, in *ListElementCombinationsIn) ([]*models.ElementCombination, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	var elem *models.Element
+	if in.IDElem != nil {
+		elem, err = models.LoadElementFromID(db, sc, *in.IDElem)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return models.ListElementCombinations(db, sc, elem)
+}
+
+type GetElementCombinationIn struct {
+	IDScenario    int64 `path:"scenario, required"`
+	IDCombination int64 `path:"elementcombination, required"`
+}
+
+func GetElementCombination(c *gin.Context, in *GetElementCombinationIn) (*models.ElementCombination, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.LoadElementCombinationFromID(db, sc, in.IDCombination)
+}
+
+type UpdateElementCombinationIn struct {
+	IDScenario    int64   `path:"scenario, required"`
+	IDCombination int64   `path:"elementcombination, required"`
+	IDElem        int64   `json:"id_element" binding:"required"`
+	Inputs        []int64 `json:"inputs" binding:"required"`
+}
+
+func UpdateElementCombination(c *gin.Context, in *UpdateElementCombinationIn) (*models.ElementCombination, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	ec, err := models.LoadElementCombinationFromID(db, sc, in.IDCombination)
+	if err != nil {
+		return nil, err
+	}
+
+	elem, err := models.LoadElementFromID(db, sc, in.IDElem)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := loadElements(db, sc, in.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ec.Update(db, elem, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec, nil
+}
+
+type DeleteElementCombinationIn struct {
+	IDScenario    int64 `path:"scenario, required"`
+	IDCombination int64 `path:"elementcombination, required"`
+}
+
+func DeleteElementCombination(c *gin.Context, in *DeleteElementCombinationIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	ec, err := models.LoadElementCombinationFromID(db, sc, in.IDCombination)
+	if err != nil {
+		return err
+	}
+
+	return ec.Delete(db)
+}
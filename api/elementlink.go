@@ -15,7 +15,9 @@ type NewElementLinkIn struct {
 
 func NewElementLink(c *gin.Context, in *NewElementLinkIn) (*models.ElementLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +43,9 @@ type ListElementLinksIn struct {
 
 func ListElementLinks(c *gin.Context, in *ListElementLinksIn) ([]*models.ElementLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -72,7 +76,9 @@ type GetElementLinkIn struct {
 
 func GetElementLink(c *gin.Context, in *GetElementLinkIn) (*models.ElementLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +93,9 @@ type DeleteElementLinkIn struct {
 
 func DeleteElementLink(c *gin.Context, in *DeleteElementLinkIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
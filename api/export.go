@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+	"github.com/loopfz/scecret/render"
+)
+
+const (
+	EXPORT_LAYOUT_CARDS  = "cards"
+	EXPORT_LAYOUT_SHEETS = "sheets"
+)
+
+// Export all the cards of a scenario as a PDF document.
+// Query parameters:
+//
+//	layout: "cards" (default, one page per card face) or "sheets" (print-and-play)
+//	paper, margin, bleed, backs: sheet options, only used by the "sheets" layout
+func ExportPDF(c *gin.Context) {
+
+	db := getDB(c)
+
+	IDScenario, err := int64Param(c, "scenario")
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	layout := c.DefaultQuery("layout", EXPORT_LAYOUT_CARDS)
+
+	var opts *render.SheetOptions
+	switch layout {
+	case EXPORT_LAYOUT_CARDS:
+	case EXPORT_LAYOUT_SHEETS:
+		opts, err = sheetOptions(c)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+	default:
+		renderError(c, errors.NewBadRequest(nil, fmt.Sprintf("Unknown layout: %s", layout)))
+		return
+	}
+
+	sc, err := auth.RetrieveTokenScenario(db, c, IDScenario, models.RoleViewer)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	deck, err := render.LoadDeck(db, sc)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if opts != nil {
+		err = deck.WriteSheetsPDF(&buf, opts)
+	} else {
+		err = deck.WritePDF(&buf)
+	}
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="scenario_%d.pdf"`, sc.ID))
+	c.Data(200, "application/pdf", buf.Bytes())
+}
+
+func sheetOptions(c *gin.Context) (*render.SheetOptions, error) {
+
+	margin, err := strconv.ParseFloat(c.DefaultQuery("margin", "5"), 64)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, "Invalid margin parameter")
+	}
+	bleed, err := strconv.ParseFloat(c.DefaultQuery("bleed", "0"), 64)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, "Invalid bleed parameter")
+	}
+	backs, err := strconv.ParseBool(c.DefaultQuery("backs", "true"))
+	if err != nil {
+		return nil, errors.NewBadRequest(err, "Invalid backs parameter")
+	}
+
+	opts := &render.SheetOptions{
+		Paper:      c.DefaultQuery("paper", render.PAPER_A4),
+		MarginMM:   margin,
+		BleedMM:    bleed,
+		PrintBacks: backs,
+	}
+
+	err = opts.Valid()
+	if err != nil {
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type ListHistoryIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func ListHistory(c *gin.Context, in *ListHistoryIn) ([]*models.Revision, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListRevisions(db, sc, "", 0)
+}
+
+type ListObjectHistoryIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	ObjectType string `path:"object_type, required"`
+	IDObject   int64  `path:"object, required"`
+}
+
+func ListObjectHistory(c *gin.Context, in *ListObjectHistoryIn) ([]*models.Revision, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListRevisions(db, sc, in.ObjectType, in.IDObject)
+}
+
+type RestoreRevisionIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDRevision int64 `path:"revision, required"`
+}
+
+// Restore a scenario to its state right after a revision.
+// The restoration is itself recorded in the history.
+func RestoreRevision(c *gin.Context, in *RestoreRevisionIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	rev, err := models.LoadRevisionFromID(db, sc, in.IDRevision)
+	if err != nil {
+		return errors.NewNotFound(err, "No such revision")
+	}
+
+	return models.RestoreRevision(db, sc, rev)
+}
@@ -1,27 +1,31 @@
 package main
 
 import (
+	"io"
+	"io/ioutil"
+
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"github.com/loopfz/scecret/auth"
 	"github.com/loopfz/scecret/models"
 )
 
 type NewIconIn struct {
-	IDScenario int64 `path:"scenario, required"`
-	// TODO icon data
+	IDScenario int64  `path:"scenario, required"`
+	ShortName  string `json:"short_name" binding:"required"`
+	URL        string `json:"url"`
 }
 
 func NewIcon(c *gin.Context, in *NewIconIn) (*models.Icon, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO resize
-	// TODO upload icon data to cloud storage
-
-	return models.CreateIcon(db, sc, "", "")
+	return models.CreateIcon(db, sc, in.ShortName, in.URL)
 }
 
 type ListIconsIn struct {
@@ -30,7 +34,9 @@ type ListIconsIn struct {
 
 func ListIcons(c *gin.Context, in *ListIconsIn) ([]*models.Icon, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +51,9 @@ type GetIconIn struct {
 
 func GetIcon(c *gin.Context, in *GetIconIn) (*models.Icon, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -54,14 +62,17 @@ func GetIcon(c *gin.Context, in *GetIconIn) (*models.Icon, error) {
 }
 
 type UpdateIconIn struct {
-	IDScenario int64 `path:"scenario, required"`
-	IDIcon     int64 `path:"icon, required"`
-	// TODO icon data
+	IDScenario int64  `path:"scenario, required"`
+	IDIcon     int64  `path:"icon, required"`
+	ShortName  string `json:"short_name" binding:"required"`
+	URL        string `json:"url"`
 }
 
 func UpdateIcon(c *gin.Context, in *UpdateIconIn) (*models.Icon, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -71,11 +82,7 @@ func UpdateIcon(c *gin.Context, in *UpdateIconIn) (*models.Icon, error) {
 		return nil, err
 	}
 
-	// TODO delete icon data from cloud storage
-	// TODO resize
-	// TODO upload new icon data to cloud storage
-
-	err = ico.Update(db, "", "")
+	err = ico.Update(db, in.ShortName, in.URL)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +97,9 @@ type DeleteIconIn struct {
 
 func DeleteIcon(c *gin.Context, in *DeleteIconIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
@@ -100,7 +109,93 @@ func DeleteIcon(c *gin.Context, in *DeleteIconIn) error {
 		return err
 	}
 
-	// TODO delete icon data from cloud storage
-
 	return ico.Delete(db)
 }
+
+// Upload the image of an icon (raw PNG/SVG request body).
+// Base game icons cannot be modified.
+func SetIconImage(c *gin.Context) {
+
+	db := getDB(c)
+
+	ico, sc, err := iconFromParams(c, models.RoleEditor)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	if ico.IDScenario == nil {
+		renderError(c, errors.NewForbidden(nil, "Cannot modify base game icon"))
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, models.MAX_IMAGE_SIZE+1))
+	if err != nil {
+		renderError(c, errors.NewBadRequest(err, "Could not read image data"))
+		return
+	}
+
+	img, err := models.CreateIconImage(db, sc, data)
+	if err != nil {
+		renderError(c, errors.NewBadRequest(err, err.Error()))
+		return
+	}
+
+	err = ico.SetImage(db, img)
+	if err != nil {
+		renderError(c, errors.NewBadRequest(err, err.Error()))
+		return
+	}
+
+	c.JSON(200, ico)
+}
+
+// Serve the uploaded image of an icon.
+func GetIconImage(c *gin.Context) {
+
+	db := getDB(c)
+
+	ico, _, err := iconFromParams(c, models.RoleViewer)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	img, err := ico.LoadImage(db)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+	if img == nil {
+		renderError(c, errors.NewNotFound(nil, "No image for this icon"))
+		return
+	}
+
+	renderImage(c, img)
+}
+
+func iconFromParams(c *gin.Context, role string) (*models.Icon, *models.Scenario, error) {
+
+	db := getDB(c)
+
+	IDScenario, err := int64Param(c, "scenario")
+	if err != nil {
+		return nil, nil, err
+	}
+	IDIcon, err := int64Param(c, "icon")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sc, err := auth.RetrieveTokenScenario(db, c, IDScenario, role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ico, err := models.LoadIconFromID(db, sc, IDIcon)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ico, sc, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/lint"
+	"github.com/loopfz/scecret/models"
+)
+
+type LintScenarioIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	Checks     string `query:"checks"` // Comma-separated check names, all checks if empty
+}
+
+func LintScenario(c *gin.Context, in *LintScenarioIn) ([]*lint.Warning, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, n := range strings.Split(in.Checks, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if lint.CheckByName(n) == nil {
+			return nil, errors.NewBadRequest(nil, "Unknown check: "+n)
+		}
+		names = append(names, n)
+	}
+
+	return lint.Run(db, sc, names...)
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"io"
+	"io/ioutil"
+
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"github.com/loopfz/scecret/auth"
 	"github.com/loopfz/scecret/models"
 )
@@ -14,7 +18,9 @@ type NewLocationIn struct {
 
 func NewLocation(c *gin.Context, in *NewLocationIn) (*models.Location, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +34,9 @@ type ListLocationsIn struct {
 
 func ListLocations(c *gin.Context, in *ListLocationsIn) ([]*models.Location, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +51,9 @@ type GetLocationIn struct {
 
 func GetLocation(c *gin.Context, in *GetLocationIn) (*models.Location, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +71,9 @@ type UpdateLocationIn struct {
 
 func UpdateLocation(c *gin.Context, in *UpdateLocationIn) (*models.Location, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +98,9 @@ type DeleteLocationIn struct {
 
 func DeleteLocation(c *gin.Context, in *DeleteLocationIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
@@ -99,6 +113,111 @@ func DeleteLocation(c *gin.Context, in *DeleteLocationIn) error {
 	return loc.Delete(db)
 }
 
+// Upload the background panorama of a location (raw PNG/JPEG request body).
+// It is sliced across the backs of the location cards when rendering.
+func SetLocationBackground(c *gin.Context) {
+
+	db := getDB(c)
+
+	loc, sc, err := locationFromParams(c, models.RoleEditor)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, models.MAX_IMAGE_SIZE+1))
+	if err != nil {
+		renderError(c, errors.NewBadRequest(err, "Could not read image data"))
+		return
+	}
+
+	img, err := models.CreateBackgroundImage(db, sc, data)
+	if err != nil {
+		renderError(c, errors.NewBadRequest(err, err.Error()))
+		return
+	}
+
+	err = loc.SetBackground(db, img)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	c.JSON(200, loc)
+}
+
+// Serve the background panorama of a location.
+func GetLocationBackground(c *gin.Context) {
+
+	db := getDB(c)
+
+	loc, _, err := locationFromParams(c, models.RoleViewer)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	img, err := loc.LoadBackground(db)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+	if img == nil {
+		renderError(c, errors.NewNotFound(nil, "No background for this location"))
+		return
+	}
+
+	renderImage(c, img)
+}
+
+func locationFromParams(c *gin.Context, role string) (*models.Location, *models.Scenario, error) {
+
+	db := getDB(c)
+
+	IDScenario, err := int64Param(c, "scenario")
+	if err != nil {
+		return nil, nil, err
+	}
+	IDLoc, err := int64Param(c, "location")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sc, err := auth.RetrieveTokenScenario(db, c, IDScenario, role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loc, err := models.LoadLocationFromID(db, sc, IDLoc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return loc, sc, nil
+}
+
+type DeleteLocationBackgroundIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDLoc      int64 `path:"location, required"`
+}
+
+func DeleteLocationBackground(c *gin.Context, in *DeleteLocationBackgroundIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	loc, err := models.LoadLocationFromID(db, sc, in.IDLoc)
+	if err != nil {
+		return err
+	}
+
+	return loc.SetBackground(db, nil)
+}
+
 type NewLocationCardIn struct {
 	IDScenario int64  `path:"scenario, required"`
 	IDLoc      int64  `path:"location, required"`
@@ -107,7 +226,9 @@ type NewLocationCardIn struct {
 
 func NewLocationCard(c *gin.Context, in *NewLocationCardIn) (*models.LocationCard, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +248,9 @@ type ListLocationCardsIn struct {
 
 func ListLocationCards(c *gin.Context, in *ListLocationCardsIn) ([]*models.LocationCard, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -148,7 +271,9 @@ type GetLocationCardIn struct {
 
 func GetLocationCard(c *gin.Context, in *GetLocationCardIn) (*models.LocationCard, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -170,7 +295,9 @@ type UpdateLocationCardIn struct {
 
 func UpdateLocationCard(c *gin.Context, in *UpdateLocationCardIn) (*models.LocationCard, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -201,7 +328,9 @@ type DeleteLocationCardIn struct {
 
 func DeleteLocationCard(c *gin.Context, in *DeleteLocationCardIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
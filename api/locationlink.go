@@ -12,11 +12,14 @@ type NewLocationLinkIn struct {
 	IDScenario int64 `path:"scenario, required"`
 	IDLoc      int64 `json:"id_location" binding:"required"`
 	IDCard     int64 `json:"id_card" binding:"required"`
+	TUCost     *uint `json:"tu_cost"` // Default: DEFAULT_TRAVEL_TU_COST
 }
 
 func NewLocationLink(c *gin.Context, in *NewLocationLinkIn) (*models.LocationLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +34,12 @@ func NewLocationLink(c *gin.Context, in *NewLocationLinkIn) (*models.LocationLin
 		return nil, err
 	}
 
-	return models.CreateLocationLink(db, card, loc)
+	var TUCost uint = models.DEFAULT_TRAVEL_TU_COST
+	if in.TUCost != nil {
+		TUCost = *in.TUCost
+	}
+
+	return models.CreateLocationLink(db, card, loc, TUCost)
 }
 
 type ListLocationLinksIn struct {
@@ -42,7 +50,9 @@ type ListLocationLinksIn struct {
 
 func ListLocationLinks(c *gin.Context, in *ListLocationLinksIn) ([]*models.LocationLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +84,9 @@ type GetLocationLinkIn struct {
 
 func GetLocationLink(c *gin.Context, in *GetLocationLinkIn) (*models.LocationLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -82,6 +94,34 @@ func GetLocationLink(c *gin.Context, in *GetLocationLinkIn) (*models.LocationLin
 	return models.LoadLocationLinkFromID(db, sc, in.IDLocLink)
 }
 
+type UpdateLocationLinkIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDLocLink  int64 `path:"locationlink, required"`
+	TUCost     uint  `json:"tu_cost"`
+}
+
+func UpdateLocationLink(c *gin.Context, in *UpdateLocationLinkIn) (*models.LocationLink, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	ll, err := models.LoadLocationLinkFromID(db, sc, in.IDLocLink)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ll.Update(db, in.TUCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return ll, nil
+}
+
 type DeleteLocationLinkIn struct {
 	IDScenario int64 `path:"scenario, required"`
 	IDLocLink  int64 `path:"locationlink, required"`
@@ -89,7 +129,9 @@ type DeleteLocationLinkIn struct {
 
 func DeleteLocationLink(c *gin.Context, in *DeleteLocationLinkIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
@@ -1,19 +1,38 @@
 package main
 
 import (
+	"flag"
+
 	"github.com/gin-gonic/gin"
-	"github.com/go-gorp/gorp"
 	"github.com/loopfz/gad/zesty"
 	"github.com/loopfz/gadgeto/tonic"
 	"github.com/loopfz/gadgeto/tonic/jujuerrhook"
+	"github.com/loopfz/scecret/auth"
 	"github.com/loopfz/scecret/constants"
 	"github.com/loopfz/scecret/db/initdb"
+	"github.com/loopfz/scecret/models"
+	"github.com/loopfz/scecret/utils/blobstore"
 )
 
-var db *gorp.DbMap // TODO remove
+var (
+	blobDir  = flag.String("blob-dir", "", "Store uploaded images in this directory instead of the database")
+	tokenTTL = flag.Duration("token-ttl", auth.TokenTTL, "Expire auth tokens unused for this long (0: never expire)")
+)
 
 func main() {
 
+	flag.Parse()
+
+	auth.TokenTTL = *tokenTTL
+
+	if *blobDir != "" {
+		store, err := blobstore.NewLocal(*blobDir)
+		if err != nil {
+			panic(err)
+		}
+		models.SetBlobStore(store)
+	}
+
 	tdb, err := initdb.InitSqlite()
 	if err != nil {
 		panic(err)
@@ -21,102 +40,195 @@ func main() {
 
 	tonic.SetErrorHook(jujuerrhook.ErrHook)
 
-	db = tdb
 	zesty.RegisterDB(zesty.NewDB(tdb), constants.DBName)
 
 	router := gin.Default()
 
 	// Auth
-	router.POST("/register", tonic.Handler(RegisterUser, 201))
-	router.POST("/auth", tonic.Handler(Auth, 200))
-	router.GET("/me", tonic.Handler(GetMe, 200))
+	router.POST("/register", txHandler(RegisterUser, 201))
+	router.POST("/auth", txHandler(Auth, 200))
+	router.GET("/me", txHandler(GetMe, 200))
+	router.POST("/logout", txHandler(Logout, 204))
+	router.GET("/me/sessions", txHandler(ListSessions, 200))
+	router.DELETE("/me/sessions/:session", txHandler(DeleteSession, 204))
 
 	// Scenarios
-	router.POST("/scenario", tonic.Handler(NewScenario, 201))
-	router.GET("/scenario", tonic.Handler(ListScenarios, 200))
-	router.GET("/scenario/:scenario", tonic.Handler(GetScenario, 200))
-	router.PUT("/scenario/:scenario", tonic.Handler(UpdateScenario, 200))
-	router.DELETE("/scenario/:scenario", tonic.Handler(DeleteScenario, 204))
-	router.GET("/scenario/:scenario/graph", tonic.Handler(GetGraph, 200))
+	router.POST("/scenario", txHandler(NewScenario, 201))
+	router.GET("/scenario", txHandler(ListScenarios, 200))
+	router.GET("/scenario/:scenario", txHandler(GetScenario, 200))
+	router.PUT("/scenario/:scenario", txHandler(UpdateScenario, 200))
+	router.DELETE("/scenario/:scenario", txHandler(DeleteScenario, 204))
+	router.POST("/scenario/:scenario/clone", txHandler(CloneScenario, 201))
+	router.POST("/scenario/:scenario/transfer", txHandler(TransferScenario, 200))
+	router.GET("/scenario/:scenario/graph", txRawHandler(GetGraph))
+	router.GET("/scenario/:scenario/graph/full", txRawHandler(GetFullGraph))
+
+	// Members
+	router.POST("/scenario/:scenario/member", txHandler(NewMember, 201))
+	router.GET("/scenario/:scenario/member", txHandler(ListMembers, 200))
+	router.PUT("/scenario/:scenario/member/:member", txHandler(UpdateMember, 200))
+	router.DELETE("/scenario/:scenario/member/:member", txHandler(DeleteMember, 204))
+
+	// History
+	router.GET("/scenario/:scenario/history", txHandler(ListHistory, 200))
+	router.GET("/scenario/:scenario/history/:object_type/:object", txHandler(ListObjectHistory, 200))
+	router.POST("/scenario/:scenario/revision/:revision/restore", txHandler(RestoreRevision, 204))
+	router.GET("/scenario/:scenario/revision/:revision/diff", txHandler(DiffRevisions, 200))
+	router.POST("/scenario/:scenario/undo", txHandler(Undo, 200))
+	router.POST("/scenario/:scenario/redo", txHandler(Redo, 200))
+
+	// Playtests
+	router.POST("/scenario/:scenario/playtest", txHandler(NewPlaytest, 201))
+	router.GET("/scenario/:scenario/playtest", txHandler(ListPlaytests, 200))
+	router.GET("/scenario/:scenario/playtest/:playtest", txHandler(GetPlaytest, 200))
+	router.DELETE("/scenario/:scenario/playtest/:playtest", txHandler(DeletePlaytest, 204))
+	router.POST("/scenario/:scenario/playtest/:playtest/visit", txHandler(VisitCard, 200))
+	router.POST("/scenario/:scenario/playtest/:playtest/skill_test", txHandler(ResolveSkillTest, 200))
+	router.POST("/scenario/:scenario/playtest/:playtest/use_element", txHandler(UseElement, 200))
+
+	// Analysis
+	router.GET("/scenario/:scenario/analysis/reachability", txHandler(GetReachability, 200))
+	router.GET("/scenario/:scenario/analysis/runlength", txHandler(GetRunEstimate, 200))
+	router.GET("/scenario/:scenario/analysis/difficulty", txHandler(GetDifficulty, 200))
+	router.GET("/scenario/:scenario/lint", txHandler(LintScenario, 200))
+	router.GET("/scenario/:scenario/diff/:other", txHandler(DiffScenarios, 200))
 
 	// Locations
-	router.POST("/scenario/:scenario/location", tonic.Handler(NewLocation, 201))
-	router.GET("/scenario/:scenario/location", tonic.Handler(ListLocations, 200))
-	router.GET("/scenario/:scenario/location/:location", tonic.Handler(GetLocation, 200))
-	router.PUT("/scenario/:scenario/location/:location", tonic.Handler(UpdateLocation, 200))
-	router.DELETE("/scenario/:scenario/location/:location", tonic.Handler(DeleteLocation, 204))
+	router.POST("/scenario/:scenario/location", txHandler(NewLocation, 201))
+	router.GET("/scenario/:scenario/location", txHandler(ListLocations, 200))
+	router.GET("/scenario/:scenario/location/:location", txHandler(GetLocation, 200))
+	router.PUT("/scenario/:scenario/location/:location", txHandler(UpdateLocation, 200))
+	router.DELETE("/scenario/:scenario/location/:location", txHandler(DeleteLocation, 204))
+	router.PUT("/scenario/:scenario/location/:location/background", txRawHandler(SetLocationBackground))
+	router.GET("/scenario/:scenario/location/:location/background", txRawHandler(GetLocationBackground))
+	router.DELETE("/scenario/:scenario/location/:location/background", txHandler(DeleteLocationBackground, 204))
 
 	// Location cards
-	router.POST("/scenario/:scenario/location/:location/card", tonic.Handler(NewLocationCard, 201))
-	router.GET("/scenario/:scenario/location/:location/card", tonic.Handler(ListLocationCards, 200))
-	router.GET("/scenario/:scenario/location/:location/card/:location_card", tonic.Handler(GetLocationCard, 200))
-	router.PUT("/scenario/:scenario/location/:location/card/:location_card", tonic.Handler(UpdateLocationCard, 200))
-	router.DELETE("/scenario/:scenario/location/:location/card/:location_card", tonic.Handler(DeleteLocationCard, 204))
+	router.POST("/scenario/:scenario/location/:location/card", txHandler(NewLocationCard, 201))
+	router.GET("/scenario/:scenario/location/:location/card", txHandler(ListLocationCards, 200))
+	router.GET("/scenario/:scenario/location/:location/card/:location_card", txHandler(GetLocationCard, 200))
+	router.PUT("/scenario/:scenario/location/:location/card/:location_card", txHandler(UpdateLocationCard, 200))
+	router.DELETE("/scenario/:scenario/location/:location/card/:location_card", txHandler(DeleteLocationCard, 204))
 
 	// Location links
-	router.POST("/scenario/:scenario/locationlink", tonic.Handler(NewLocationLink, 201))
-	router.GET("/scenario/:scenario/locationlink", tonic.Handler(ListLocationLinks, 200))
-	router.GET("/scenario/:scenario/locationlink/:locationlink", tonic.Handler(GetLocationLink, 200))
-	router.DELETE("/scenario/:scenario/locationlink/:locationlink", tonic.Handler(DeleteLocationLink, 204))
+	router.POST("/scenario/:scenario/locationlink", txHandler(NewLocationLink, 201))
+	router.GET("/scenario/:scenario/locationlink", txHandler(ListLocationLinks, 200))
+	router.GET("/scenario/:scenario/locationlink/:locationlink", txHandler(GetLocationLink, 200))
+	router.PUT("/scenario/:scenario/locationlink/:locationlink", txHandler(UpdateLocationLink, 200))
+	router.DELETE("/scenario/:scenario/locationlink/:locationlink", txHandler(DeleteLocationLink, 204))
 
 	// Element links
-	router.POST("/scenario/:scenario/elementlink", tonic.Handler(NewElementLink, 201))
-	router.GET("/scenario/:scenario/elementlink", tonic.Handler(ListElementLinks, 200))
-	router.GET("/scenario/:scenario/elementlink/:elementlink", tonic.Handler(GetElementLink, 200))
-	router.DELETE("/scenario/:scenario/elementlink/:elementlink", tonic.Handler(DeleteElementLink, 204))
+	router.POST("/scenario/:scenario/elementlink", txHandler(NewElementLink, 201))
+	router.GET("/scenario/:scenario/elementlink", txHandler(ListElementLinks, 200))
+	router.GET("/scenario/:scenario/elementlink/:elementlink", txHandler(GetElementLink, 200))
+	router.DELETE("/scenario/:scenario/elementlink/:elementlink", txHandler(DeleteElementLink, 204))
+
+	// Element combinations
+	router.POST("/scenario/:scenario/elementcombination", txHandler(NewElementCombination, 201))
+	router.GET("/scenario/:scenario/elementcombination", txHandler(ListElementCombinations, 200))
+	router.GET("/scenario/:scenario/elementcombination/:elementcombination", txHandler(GetElementCombination, 200))
+	router.PUT("/scenario/:scenario/elementcombination/:elementcombination", txHandler(UpdateElementCombination, 200))
+	router.DELETE("/scenario/:scenario/elementcombination/:elementcombination", txHandler(DeleteElementCombination, 204))
 
 	// State tokens
-	router.GET("/scenario/:scenario/statetoken", tonic.Handler(ListStateTokens, 200))
-	router.GET("/scenario/:scenario/statetoken/:statetoken", tonic.Handler(GetStateToken, 200))
+	router.POST("/scenario/:scenario/statetoken", txHandler(NewStateToken, 201))
+	router.GET("/scenario/:scenario/statetoken", txHandler(ListStateTokens, 200))
+	router.GET("/scenario/:scenario/statetoken/:statetoken", txHandler(GetStateToken, 200))
+	router.PUT("/scenario/:scenario/statetoken/:statetoken", txHandler(UpdateStateToken, 200))
+	router.DELETE("/scenario/:scenario/statetoken/:statetoken", txHandler(DeleteStateToken, 204))
 
 	// State token links
-	router.POST("/scenario/:scenario/statetokenlink", tonic.Handler(NewStateTokenLink, 201))
-	router.GET("/scenario/:scenario/statetokenlink", tonic.Handler(ListStateTokenLinks, 200))
-	router.GET("/scenario/:scenario/statetokenlink/:statetokenlink", tonic.Handler(GetStateTokenLink, 200))
-	router.DELETE("/scenario/:scenario/statetokenlink/:statetokenlink", tonic.Handler(DeleteStateTokenLink, 204))
+	router.POST("/scenario/:scenario/statetokenlink", txHandler(NewStateTokenLink, 201))
+	router.GET("/scenario/:scenario/statetokenlink", txHandler(ListStateTokenLinks, 200))
+	router.GET("/scenario/:scenario/statetokenlink/:statetokenlink", txHandler(GetStateTokenLink, 200))
+	router.DELETE("/scenario/:scenario/statetokenlink/:statetokenlink", txHandler(DeleteStateTokenLink, 204))
 
 	// Stats
-	router.POST("/scenario/:scenario/stat", tonic.Handler(NewStat, 201))
-	router.GET("/scenario/:scenario/stat", tonic.Handler(ListStats, 200))
-	router.GET("/scenario/:scenario/stat/:stat", tonic.Handler(GetStat, 200))
-	router.PUT("/scenario/:scenario/stat/:stat", tonic.Handler(UpdateStat, 200))
-	router.DELETE("/scenario/:scenario/stat/:stat", tonic.Handler(DeleteStat, 204))
+	router.POST("/scenario/:scenario/stat", txHandler(NewStat, 201))
+	router.GET("/scenario/:scenario/stat", txHandler(ListStats, 200))
+	router.GET("/scenario/:scenario/stat/:stat", txHandler(GetStat, 200))
+	router.PUT("/scenario/:scenario/stat/:stat", txHandler(UpdateStat, 200))
+	router.DELETE("/scenario/:scenario/stat/:stat", txHandler(DeleteStat, 204))
 
 	// Skill tests
-	router.POST("/scenario/:scenario/skilltest", tonic.Handler(CreateSkillTest, 201))
-	router.GET("/scenario/:scenario/skilltest", tonic.Handler(ListSkillTests, 200))
-	router.GET("/scenario/:scenario/skilltest/:skilltest", tonic.Handler(GetSkillTest, 200))
-	router.PUT("/scenario/:scenario/skilltest/:skilltest", tonic.Handler(UpdateSkillTest, 200))
-	router.DELETE("/scenario/:scenario/skilltest/:skilltest", tonic.Handler(DeleteSkillTest, 204))
+	router.POST("/scenario/:scenario/skilltest", txHandler(CreateSkillTest, 201))
+	router.GET("/scenario/:scenario/skilltest", txHandler(ListSkillTests, 200))
+	router.GET("/scenario/:scenario/skilltest/:skilltest", txHandler(GetSkillTest, 200))
+	router.PUT("/scenario/:scenario/skilltest/:skilltest", txHandler(UpdateSkillTest, 200))
+	router.DELETE("/scenario/:scenario/skilltest/:skilltest", txHandler(DeleteSkillTest, 204))
+	router.GET("/scenario/:scenario/skilltest/:skilltest/odds", txHandler(GetSkillTestOdds, 200))
 
 	// Icons
-	router.POST("/scenario/:scenario/icon", tonic.Handler(NewIcon, 201))
-	router.GET("/scenario/:scenario/icon", tonic.Handler(ListIcons, 200))
-	router.GET("/scenario/:scenario/icon/:icon", tonic.Handler(GetIcon, 200))
-	router.PUT("/scenario/:scenario/icon/:icon", tonic.Handler(UpdateIcon, 200))
-	router.DELETE("/scenario/:scenario/icon/:icon", tonic.Handler(DeleteIcon, 204))
+	router.POST("/scenario/:scenario/icon", txHandler(NewIcon, 201))
+	router.GET("/scenario/:scenario/icon", txHandler(ListIcons, 200))
+	router.GET("/scenario/:scenario/icon/:icon", txHandler(GetIcon, 200))
+	router.PUT("/scenario/:scenario/icon/:icon", txHandler(UpdateIcon, 200))
+	router.DELETE("/scenario/:scenario/icon/:icon", txHandler(DeleteIcon, 204))
+	router.PUT("/scenario/:scenario/icon/:icon/image", txRawHandler(SetIconImage))
+	router.GET("/scenario/:scenario/icon/:icon/image", txRawHandler(GetIconImage))
 
 	// Elements
-	router.POST("/scenario/:scenario/element", tonic.Handler(NewElement, 201))
-	router.GET("/scenario/:scenario/element", tonic.Handler(ListElements, 200))
-	router.GET("/scenario/:scenario/element/:element", tonic.Handler(GetElement, 200))
-	router.PUT("/scenario/:scenario/element/:element", tonic.Handler(UpdateElement, 200))
-	router.DELETE("/scenario/:scenario/element/:element", tonic.Handler(DeleteElement, 204))
+	router.POST("/scenario/:scenario/element", txHandler(NewElement, 201))
+	router.GET("/scenario/:scenario/element", txHandler(ListElements, 200))
+	router.GET("/scenario/:scenario/element/:element", txHandler(GetElement, 200))
+	router.PUT("/scenario/:scenario/element/:element", txHandler(UpdateElement, 200))
+	router.DELETE("/scenario/:scenario/element/:element", txHandler(DeleteElement, 204))
+
+	// Receptacles
+	router.POST("/scenario/:scenario/receptacle", txHandler(NewReceptacle, 201))
+	router.GET("/scenario/:scenario/receptacle", txHandler(ListReceptacles, 200))
+	router.GET("/scenario/:scenario/receptacle/:receptacle", txHandler(GetReceptacle, 200))
+	router.PUT("/scenario/:scenario/receptacle/:receptacle", txHandler(UpdateReceptacle, 200))
+	router.DELETE("/scenario/:scenario/receptacle/:receptacle", txHandler(DeleteReceptacle, 204))
+
+	// Mission successes
+	router.POST("/scenario/:scenario/missionsuccess", txHandler(NewMissionSuccess, 201))
+	router.GET("/scenario/:scenario/missionsuccess", txHandler(ListMissionSuccesses, 200))
+	router.GET("/scenario/:scenario/missionsuccess/:missionsuccess", txHandler(GetMissionSuccess, 200))
+	router.PUT("/scenario/:scenario/missionsuccess/:missionsuccess", txHandler(UpdateMissionSuccess, 200))
+	router.DELETE("/scenario/:scenario/missionsuccess/:missionsuccess", txHandler(DeleteMissionSuccess, 204))
+
+	// Codex entries
+	router.POST("/scenario/:scenario/codex", txHandler(NewCodex, 201))
+	router.GET("/scenario/:scenario/codex", txHandler(ListCodices, 200))
+	router.GET("/scenario/:scenario/codex/:codex", txHandler(GetCodex, 200))
+	router.PUT("/scenario/:scenario/codex/:codex", txHandler(UpdateCodex, 200))
+	router.DELETE("/scenario/:scenario/codex/:codex", txHandler(DeleteCodex, 204))
+
+	// Plans
+	router.POST("/scenario/:scenario/plan", txHandler(NewPlan, 201))
+	router.GET("/scenario/:scenario/plan", txHandler(ListPlans, 200))
+	router.GET("/scenario/:scenario/plan/:plan", txHandler(GetPlan, 200))
+	router.PUT("/scenario/:scenario/plan/:plan", txHandler(UpdatePlan, 200))
+	router.DELETE("/scenario/:scenario/plan/:plan", txHandler(DeletePlan, 204))
+
+	// Requirements
+	router.POST("/scenario/:scenario/requirement", txHandler(NewRequirement, 201))
+	router.GET("/scenario/:scenario/requirement", txHandler(ListRequirements, 200))
+	router.GET("/scenario/:scenario/requirement/:requirement", txHandler(GetRequirement, 200))
+	router.PUT("/scenario/:scenario/requirement/:requirement", txHandler(UpdateRequirement, 200))
+	router.DELETE("/scenario/:scenario/requirement/:requirement", txHandler(DeleteRequirement, 204))
 
 	// Cards
-	router.GET("/scenario/:scenario/card", tonic.Handler(ListCards, 200))
-	router.GET("/scenario/:scenario/card/:card", tonic.Handler(GetCard, 200))
-	router.PUT("/scenario/:scenario/card/:card", tonic.Handler(UpdateCard, 200))
+	router.GET("/scenario/:scenario/card", txHandler(ListCards, 200))
+	router.GET("/scenario/:scenario/card/:card", txHandler(GetCard, 200))
+	router.PUT("/scenario/:scenario/card/:card", txHandler(UpdateCard, 200))
+	router.GET("/scenario/:scenario/card/:card/render", txRawHandler(RenderCard))
 
 	// Card icons
-	router.POST("/scenario/:scenario/card/:card/icon", tonic.Handler(NewCardIcon, 201))
-	router.GET("/scenario/:scenario/card/:card/icon", tonic.Handler(ListCardIcons, 200))
-	router.GET("/scenario/:scenario/card/:card/icon/:icon", tonic.Handler(GetCardIcon, 200))
-	router.PUT("/scenario/:scenario/card/:card/icon/:icon", tonic.Handler(UpdateCardIcon, 200))
-	router.DELETE("/scenario/:scenario/card/:card/icon/:icon", tonic.Handler(DeleteCardIcon, 204))
+	router.POST("/scenario/:scenario/card/:card/icon", txHandler(NewCardIcon, 201))
+	router.GET("/scenario/:scenario/card/:card/icon", txHandler(ListCardIcons, 200))
+	router.GET("/scenario/:scenario/card/:card/icon/:icon", txHandler(GetCardIcon, 200))
+	router.PUT("/scenario/:scenario/card/:card/icon/:icon", txHandler(UpdateCardIcon, 200))
+	router.DELETE("/scenario/:scenario/card/:card/icon/:icon", txHandler(DeleteCardIcon, 204))
+
+	// Export
+	router.GET("/scenario/:scenario/export/pdf", txRawHandler(ExportPDF))
+	router.GET("/scenario/:scenario/export/zip", txRawHandler(ExportArchive))
+	router.POST("/import", txRawHandler(ImportArchive))
 
 	// Sandbox
-	router.POST("/sandbox", tonic.Handler(NewSandbox, 201))
+	router.POST("/sandbox", txHandler(NewSandbox, 201))
 
 	router.Run(":8080")
 }
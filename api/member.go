@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type NewMemberIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	Email      string `json:"email" binding:"required"`
+	Role       string `json:"role" binding:"required"`
+}
+
+func NewMember(c *gin.Context, in *NewMemberIn) (*models.ScenarioMember, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Role == models.RoleOwner {
+		return nil, errors.NewBadRequest(nil, "Cannot invite an owner, transfer the scenario instead")
+	}
+
+	u, err := models.LoadUserFromEmail(db, in.Email)
+	if err == sql.ErrNoRows {
+		return nil, errors.NewNotFound(nil, "No such user")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = models.LoadScenarioMemberFromUser(db, sc, u)
+	if err == nil {
+		return nil, errors.NewBadRequest(nil, "User is already a member of this scenario")
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return models.CreateScenarioMember(db, sc, u, in.Role)
+}
+
+type ListMembersIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func ListMembers(c *gin.Context, in *ListMembersIn) ([]*models.ScenarioMember, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListScenarioMembers(db, sc)
+}
+
+type UpdateMemberIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	IDMember   int64  `path:"member, required"`
+	Role       string `json:"role" binding:"required"`
+}
+
+func UpdateMember(c *gin.Context, in *UpdateMemberIn) (*models.ScenarioMember, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := models.LoadScenarioMemberFromID(db, sc, in.IDMember)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Update(db, in.Role)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+
+	return m, nil
+}
+
+type DeleteMemberIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDMember   int64 `path:"member, required"`
+}
+
+// Owners can remove any other member, and members can remove themselves (leave the scenario).
+func DeleteMember(c *gin.Context, in *DeleteMemberIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return err
+	}
+
+	m, err := models.LoadScenarioMemberFromID(db, sc, in.IDMember)
+	if err != nil {
+		return err
+	}
+
+	u, err := auth.RetrieveTokenUser(db, c)
+	if err != nil {
+		return err
+	}
+	if m.IDUser != u.ID && sc.IDAuthor != u.ID {
+		return errors.NewForbidden(nil, "Requires owner role on this scenario")
+	}
+
+	err = m.Delete(db)
+	if err != nil {
+		return errors.NewBadRequest(err, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type NewMissionSuccessIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	Condition  string `json:"condition" binding:"required"`
+}
+
+func NewMissionSuccess(c *gin.Context, in *NewMissionSuccessIn) (*models.MissionSuccess, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.CreateMissionSuccess(db, sc, in.Condition)
+}
+
+type ListMissionSuccessesIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func ListMissionSuccesses(c *gin.Context, in *ListMissionSuccessesIn) ([]*models.MissionSuccess, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListMissionSuccesses(db, sc)
+}
+
+type GetMissionSuccessIn struct {
+	IDScenario       int64 `path:"scenario, required"`
+	IDMissionSuccess int64 `path:"missionsuccess, required"`
+}
+
+func GetMissionSuccess(c *gin.Context, in *GetMissionSuccessIn) (*models.MissionSuccess, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.LoadMissionSuccessFromID(db, sc, in.IDMissionSuccess)
+}
+
+type UpdateMissionSuccessIn struct {
+	IDScenario       int64  `path:"scenario, required"`
+	IDMissionSuccess int64  `path:"missionsuccess, required"`
+	Condition        string `json:"condition" binding:"required"`
+}
+
+func UpdateMissionSuccess(c *gin.Context, in *UpdateMissionSuccessIn) (*models.MissionSuccess, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := models.LoadMissionSuccessFromID(db, sc, in.IDMissionSuccess)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ms.Update(db, in.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+type DeleteMissionSuccessIn struct {
+	IDScenario       int64 `path:"scenario, required"`
+	IDMissionSuccess int64 `path:"missionsuccess, required"`
+}
+
+func DeleteMissionSuccess(c *gin.Context, in *DeleteMissionSuccessIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	ms, err := models.LoadMissionSuccessFromID(db, sc, in.IDMissionSuccess)
+	if err != nil {
+		return err
+	}
+
+	return ms.Delete(db)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type NewPlanIn struct {
+	IDScenario int64              `path:"scenario, required"`
+	IDLocation int64              `json:"id_location" binding:"required"`
+	Layout     *models.PlanLayout `json:"layout"`
+}
+
+func NewPlan(c *gin.Context, in *NewPlanIn) (*models.Plan, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := models.LoadLocationFromID(db, sc, in.IDLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.CreatePlan(db, sc, loc, in.Layout)
+}
+
+type ListPlansIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func ListPlans(c *gin.Context, in *ListPlansIn) ([]*models.Plan, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListPlans(db, sc)
+}
+
+type GetPlanIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDPlan     int64 `path:"plan, required"`
+}
+
+func GetPlan(c *gin.Context, in *GetPlanIn) (*models.Plan, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.LoadPlanFromID(db, sc, in.IDPlan)
+}
+
+type UpdatePlanIn struct {
+	IDScenario int64              `path:"scenario, required"`
+	IDPlan     int64              `path:"plan, required"`
+	IDLocation int64              `json:"id_location" binding:"required"`
+	Layout     *models.PlanLayout `json:"layout"`
+}
+
+func UpdatePlan(c *gin.Context, in *UpdatePlanIn) (*models.Plan, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := models.LoadPlanFromID(db, sc, in.IDPlan)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := models.LoadLocationFromID(db, sc, in.IDLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.Update(db, loc, in.Layout)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+type DeletePlanIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDPlan     int64 `path:"plan, required"`
+}
+
+func DeletePlan(c *gin.Context, in *DeletePlanIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	p, err := models.LoadPlanFromID(db, sc, in.IDPlan)
+	if err != nil {
+		return err
+	}
+
+	return p.Delete(db)
+}
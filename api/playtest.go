@@ -0,0 +1,194 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+	"github.com/loopfz/scecret/playtest"
+)
+
+type NewPlaytestIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func NewPlaytest(c *gin.Context, in *NewPlaytestIn) (*models.Playtest, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := auth.RetrieveTokenUser(db, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return playtest.Start(db, sc, u)
+}
+
+type ListPlaytestsIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+// List the playtests of the current user on a scenario.
+func ListPlaytests(c *gin.Context, in *ListPlaytestsIn) ([]*models.Playtest, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := auth.RetrieveTokenUser(db, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListPlaytests(db, sc, u)
+}
+
+type PlaytestIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDPlaytest int64 `path:"playtest, required"`
+}
+
+func GetPlaytest(c *gin.Context, in *PlaytestIn) (*models.Playtest, error) {
+
+	pt, _, err := playtestFromParams(c, in.IDScenario, in.IDPlaytest, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return pt, nil
+}
+
+func DeletePlaytest(c *gin.Context, in *PlaytestIn) error {
+
+	db := getDB(c)
+
+	pt, _, err := playtestFromParams(c, in.IDScenario, in.IDPlaytest, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	return pt.Delete(db)
+}
+
+type VisitCardIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDPlaytest int64 `path:"playtest, required"`
+	IDCard     int64 `json:"id_card" binding:"required"`
+}
+
+func VisitCard(c *gin.Context, in *VisitCardIn) (*models.Playtest, error) {
+
+	db := getDB(c)
+
+	pt, sc, err := playtestFromParams(c, in.IDScenario, in.IDPlaytest, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := models.LoadCardFromID(db, sc, in.IDCard)
+	if err != nil {
+		return nil, err
+	}
+
+	err = playtest.Visit(db, sc, pt, card)
+	if err != nil {
+		return nil, err
+	}
+
+	return pt, nil
+}
+
+type ResolveSkillTestIn struct {
+	IDScenario  int64 `path:"scenario, required"`
+	IDPlaytest  int64 `path:"playtest, required"`
+	IDSkillTest int64 `json:"id_skill_test" binding:"required"`
+	Passed      bool  `json:"passed"`
+}
+
+func ResolveSkillTest(c *gin.Context, in *ResolveSkillTestIn) (*models.Playtest, error) {
+
+	db := getDB(c)
+
+	pt, sc, err := playtestFromParams(c, in.IDScenario, in.IDPlaytest, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := models.LoadSkillTestFromID(db, sc, in.IDSkillTest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = playtest.ResolveSkillTest(db, sc, pt, st, in.Passed)
+	if err != nil {
+		return nil, err
+	}
+
+	return pt, nil
+}
+
+type UseElementIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDPlaytest int64 `path:"playtest, required"`
+	IDElement  int64 `json:"id_element" binding:"required"`
+	IDCard     int64 `json:"id_card" binding:"required"`
+}
+
+func UseElement(c *gin.Context, in *UseElementIn) (*models.Playtest, error) {
+
+	db := getDB(c)
+
+	pt, sc, err := playtestFromParams(c, in.IDScenario, in.IDPlaytest, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	elem, err := models.LoadElementFromID(db, sc, in.IDElement)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := models.LoadCardFromID(db, sc, in.IDCard)
+	if err != nil {
+		return nil, err
+	}
+
+	err = playtest.UseElement(db, sc, pt, elem, card)
+	if err != nil {
+		return nil, err
+	}
+
+	return pt, nil
+}
+
+// Playtests are private to the user who started them.
+// They are stored with the scenario: playing or deleting one requires the editor role.
+func playtestFromParams(c *gin.Context, IDScenario, IDPlaytest int64, role string) (*models.Playtest, *models.Scenario, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, IDScenario, role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u, err := auth.RetrieveTokenUser(db, c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pt, err := models.LoadPlaytestFromID(db, sc, u, IDPlaytest)
+	if err != nil {
+		return nil, nil, errors.NewNotFound(err, "No such playtest")
+	}
+
+	return pt, sc, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type NewReceptacleIn struct {
+	IDScenario int64                    `path:"scenario, required"`
+	Name       string                   `json:"name" binding:"required"`
+	LifePoints uint                     `json:"life_points"`
+	Ability    string                   `json:"ability"`
+	Stats      []*models.ReceptacleStat `json:"stats"`
+}
+
+func NewReceptacle(c *gin.Context, in *NewReceptacleIn) (*models.Receptacle, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.CreateReceptacle(db, sc, in.Name, in.LifePoints, in.Ability, in.Stats)
+}
+
+type ListReceptaclesIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func ListReceptacles(c *gin.Context, in *ListReceptaclesIn) ([]*models.Receptacle, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListReceptacles(db, sc)
+}
+
+type GetReceptacleIn struct {
+	IDScenario   int64 `path:"scenario, required"`
+	IDReceptacle int64 `path:"receptacle, required"`
+}
+
+func GetReceptacle(c *gin.Context, in *GetReceptacleIn) (*models.Receptacle, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.LoadReceptacleFromID(db, sc, in.IDReceptacle)
+}
+
+type UpdateReceptacleIn struct {
+	IDScenario   int64                    `path:"scenario, required"`
+	IDReceptacle int64                    `path:"receptacle, required"`
+	Name         string                   `json:"name" binding:"required"`
+	LifePoints   uint                     `json:"life_points"`
+	Ability      string                   `json:"ability"`
+	Stats        []*models.ReceptacleStat `json:"stats"`
+}
+
+func UpdateReceptacle(c *gin.Context, in *UpdateReceptacleIn) (*models.Receptacle, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := models.LoadReceptacleFromID(db, sc, in.IDReceptacle)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Update(db, in.Name, in.LifePoints, in.Ability, in.Stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+type DeleteReceptacleIn struct {
+	IDScenario   int64 `path:"scenario, required"`
+	IDReceptacle int64 `path:"receptacle, required"`
+}
+
+func DeleteReceptacle(c *gin.Context, in *DeleteReceptacleIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	r, err := models.LoadReceptacleFromID(db, sc, in.IDReceptacle)
+	if err != nil {
+		return err
+	}
+
+	return r.Delete(db)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type NewRequirementIn struct {
+	IDScenario int64                   `path:"scenario, required"`
+	IDCard     int64                   `json:"id_card" binding:"required"`
+	Expression *models.RequirementExpr `json:"expression" binding:"required"`
+}
+
+func NewRequirement(c *gin.Context, in *NewRequirementIn) (*models.Requirement, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := models.LoadCardFromID(db, sc, in.IDCard)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.CreateRequirement(db, card, in.Expression)
+}
+
+type ListRequirementsIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+func ListRequirements(c *gin.Context, in *ListRequirementsIn) ([]*models.Requirement, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ListRequirements(db, sc)
+}
+
+type GetRequirementIn struct {
+	IDScenario    int64 `path:"scenario, required"`
+	IDRequirement int64 `path:"requirement, required"`
+}
+
+func GetRequirement(c *gin.Context, in *GetRequirementIn) (*models.Requirement, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.LoadRequirementFromID(db, sc, in.IDRequirement)
+}
+
+type UpdateRequirementIn struct {
+	IDScenario    int64                   `path:"scenario, required"`
+	IDRequirement int64                   `path:"requirement, required"`
+	Expression    *models.RequirementExpr `json:"expression" binding:"required"`
+}
+
+func UpdateRequirement(c *gin.Context, in *UpdateRequirementIn) (*models.Requirement, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := models.LoadRequirementFromID(db, sc, in.IDRequirement)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Update(db, in.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+type DeleteRequirementIn struct {
+	IDScenario    int64 `path:"scenario, required"`
+	IDRequirement int64 `path:"requirement, required"`
+}
+
+func DeleteRequirement(c *gin.Context, in *DeleteRequirementIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	r, err := models.LoadRequirementFromID(db, sc, in.IDRequirement)
+	if err != nil {
+		return err
+	}
+
+	return r.Delete(db)
+}
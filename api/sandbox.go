@@ -8,6 +8,8 @@ import (
 
 func NewSandbox(c *gin.Context) (*models.Scenario, error) {
 
+	db := getDB(c)
+
 	u, err := auth.RetrieveTokenUser(db, c)
 	if err != nil {
 		return nil, err
@@ -84,7 +86,7 @@ func NewSandbox(c *gin.Context) (*models.Scenario, error) {
 	}
 
 	for _, ll := range locLinks {
-		_, err := models.CreateLocationLink(db, ll.Card, ll.Loc)
+		_, err := models.CreateLocationLink(db, ll.Card, ll.Loc, models.DEFAULT_TRAVEL_TU_COST)
 		if err != nil {
 			return nil, err
 		}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/archive"
 	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/diagram"
 	"github.com/loopfz/scecret/models"
 )
 
@@ -12,6 +19,8 @@ type NewScenarioIn struct {
 
 func NewScenario(c *gin.Context, in *NewScenarioIn) (*models.Scenario, error) {
 
+	db := getDB(c)
+
 	u, err := auth.RetrieveTokenUser(db, c)
 	if err != nil {
 		return nil, err
@@ -27,6 +36,8 @@ func NewScenario(c *gin.Context, in *NewScenarioIn) (*models.Scenario, error) {
 
 func ListScenarios(c *gin.Context) ([]*models.Scenario, error) {
 
+	db := getDB(c)
+
 	u, err := auth.RetrieveTokenUser(db, c)
 	if err != nil {
 		return nil, err
@@ -41,7 +52,9 @@ type GetScenarioIn struct {
 
 func GetScenario(c *gin.Context, in *GetScenarioIn) (*models.Scenario, error) {
 
-	return auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	return auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 }
 
 type UpdateScenarioIn struct {
@@ -51,7 +64,9 @@ type UpdateScenarioIn struct {
 
 func UpdateScenario(c *gin.Context, in *UpdateScenarioIn) (*models.Scenario, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +85,9 @@ type DeleteScenarioIn struct {
 
 func DeleteScenario(c *gin.Context, in *DeleteScenarioIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleOwner)
 	if err != nil {
 		return err
 	}
@@ -83,16 +100,164 @@ func DeleteScenario(c *gin.Context, in *DeleteScenarioIn) error {
 	return nil
 }
 
-type GetGraphIn struct {
-	IDScenario int64 `path:"scenario,required"`
+type CloneScenarioIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	Name       string `json:"name" binding:"required"`
+}
+
+func CloneScenario(c *gin.Context, in *CloneScenarioIn) (*models.Scenario, error) {
+
+	db := getDB(c)
+
+	u, err := auth.RetrieveTokenUser(db, c)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return archive.Clone(db, sc, u, in.Name)
+}
+
+type TransferScenarioIn struct {
+	IDScenario int64  `path:"scenario, required"`
+	Email      string `json:"email" binding:"required"`
 }
 
-func GetGraph(c *gin.Context, in *GetGraphIn) (interface{}, error) {
+// Give ownership of a scenario to one of its members.
+func TransferScenario(c *gin.Context, in *TransferScenarioIn) (*models.Scenario, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleOwner)
 	if err != nil {
 		return nil, err
 	}
 
-	return models.Graph(db, sc)
+	u, err := models.LoadUserFromEmail(db, in.Email)
+	if err != nil {
+		return nil, errors.NewNotFound(err, "No such user")
+	}
+
+	err = sc.TransferOwnership(db, u)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+
+	return sc, nil
+}
+
+// Get the graph of a scenario, as JSON or as text for diagram tools.
+// Raw handler: the response is not always JSON.
+// Query parameters:
+//
+//	format: "dot", "graphml" or "mermaid" (optional, JSON by default)
+func GetGraph(c *gin.Context) {
+
+	db := getDB(c)
+
+	IDScenario, err := int64Param(c, "scenario")
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	format := c.Query("format")
+	_, ok := diagram.Formats[format]
+	if format != "" && !ok {
+		renderError(c, errors.NewBadRequest(nil, fmt.Sprintf("Unknown format: %s", format)))
+		return
+	}
+
+	sc, err := auth.RetrieveTokenScenario(db, c, IDScenario, models.RoleViewer)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	if format == "" {
+		g, err := models.Graph(db, sc)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+		c.JSON(200, g)
+		return
+	}
+
+	d, err := diagram.LocationDiagram(db, sc)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	renderDiagram(c, d, format)
+}
+
+// Get the full graph of a scenario, with elements, state tokens and stats as nodes,
+// as JSON or as text for diagram tools.
+// Raw handler: the response is not always JSON.
+// Query parameters:
+//
+//	type: node types to keep, comma-separated (optional, all types by default)
+//	format: "dot", "graphml" or "mermaid" (optional, JSON by default)
+func GetFullGraph(c *gin.Context) {
+
+	db := getDB(c)
+
+	IDScenario, err := int64Param(c, "scenario")
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	format := c.Query("format")
+	_, ok := diagram.Formats[format]
+	if format != "" && !ok {
+		renderError(c, errors.NewBadRequest(nil, fmt.Sprintf("Unknown format: %s", format)))
+		return
+	}
+
+	var types []string
+	if t := c.Query("type"); t != "" {
+		types = strings.Split(t, ",")
+	}
+	err = models.ValidGraphNodeTypes(types)
+	if err != nil {
+		renderError(c, errors.NewBadRequest(err, err.Error()))
+		return
+	}
+
+	sc, err := auth.RetrieveTokenScenario(db, c, IDScenario, models.RoleViewer)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	g, err := models.FullGraph(db, sc, types...)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	if format == "" {
+		c.JSON(200, g)
+		return
+	}
+
+	renderDiagram(c, diagram.ScenarioDiagram(g), format)
+}
+
+func renderDiagram(c *gin.Context, d *diagram.Diagram, format string) {
+	var buf bytes.Buffer
+	err := d.Write(&buf, format)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+
+	c.Data(200, diagram.Formats[format], buf.Bytes())
 }
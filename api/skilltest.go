@@ -19,7 +19,9 @@ type CreateSkillTestIn struct {
 
 func CreateSkillTest(c *gin.Context, in *CreateSkillTestIn) (*models.SkillTest, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +48,9 @@ type ListSkillTestsIn struct {
 
 func ListSkillTests(c *gin.Context, in *ListSkillTestsIn) ([]*models.SkillTest, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +81,9 @@ type GetSkillTestIn struct {
 
 func GetSkillTest(c *gin.Context, in *GetSkillTestIn) (*models.SkillTest, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +104,9 @@ type UpdateSkillTestIn struct {
 
 func UpdateSkillTest(c *gin.Context, in *UpdateSkillTestIn) (*models.SkillTest, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +143,9 @@ type DeleteSkillTestIn struct {
 
 func DeleteSkillTest(c *gin.Context, in *DeleteSkillTestIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
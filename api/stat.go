@@ -15,7 +15,9 @@ type NewStatIn struct {
 
 func NewStat(c *gin.Context, in *NewStatIn) (*models.Stat, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +36,9 @@ type ListStatsIn struct {
 
 func ListStats(c *gin.Context, in *ListStatsIn) ([]*models.Stat, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +53,9 @@ type GetStatIn struct {
 
 func GetStat(c *gin.Context, in *GetStatIn) (*models.Stat, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +73,9 @@ type UpdateStatIn struct {
 
 func UpdateStat(c *gin.Context, in *UpdateStatIn) (*models.Stat, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +105,9 @@ type DeleteStatIn struct {
 
 func DeleteStat(c *gin.Context, in *DeleteStatIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
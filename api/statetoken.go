@@ -2,22 +2,50 @@ package main
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"github.com/loopfz/scecret/auth"
 	"github.com/loopfz/scecret/models"
 )
 
+type NewStateTokenIn struct {
+	IDScenario  int64  `path:"scenario, required"`
+	ShortName   string `json:"short_name" binding:"required"`
+	IDIcon      int64  `json:"id_icon" binding:"required"`
+	Description string `json:"description"`
+}
+
+func NewStateToken(c *gin.Context, in *NewStateTokenIn) (*models.StateToken, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	ico, err := models.LoadIconFromID(db, sc, in.IDIcon)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.CreateStateToken(db, sc, in.ShortName, ico, in.Description)
+}
+
 type ListStateTokensIn struct {
 	IDScenario int64 `path:"scenario, required"`
 }
 
+// List the base game state tokens and the state tokens of the scenario.
 func ListStateTokens(c *gin.Context, in *ListStateTokensIn) ([]*models.StateToken, error) {
 
-	_, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
 
-	return models.ListStateTokens(db)
+	return models.ListStateTokens(db, sc)
 }
 
 type GetStateTokenIn struct {
@@ -27,10 +55,77 @@ type GetStateTokenIn struct {
 
 func GetStateToken(c *gin.Context, in *GetStateTokenIn) (*models.StateToken, error) {
 
-	_, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.LoadStateTokenFromID(db, sc, in.IDTk)
+}
+
+type UpdateStateTokenIn struct {
+	IDScenario  int64  `path:"scenario, required"`
+	IDTk        int64  `path:"statetoken, required"`
+	ShortName   string `json:"short_name" binding:"required"`
+	IDIcon      int64  `json:"id_icon" binding:"required"`
+	Description string `json:"description"`
+}
+
+// Update a state token of the scenario. Base game state tokens cannot be modified.
+func UpdateStateToken(c *gin.Context, in *UpdateStateTokenIn) (*models.StateToken, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	tk, err := models.LoadStateTokenFromID(db, sc, in.IDTk)
+	if err != nil {
+		return nil, err
+	}
+	if tk.IDScenario == nil {
+		return nil, errors.NewForbidden(nil, "Cannot modify base game state token")
+	}
+
+	ico, err := models.LoadIconFromID(db, sc, in.IDIcon)
 	if err != nil {
 		return nil, err
 	}
 
-	return models.LoadStateTokenFromID(db, in.IDTk)
+	err = tk.Update(db, in.ShortName, ico, in.Description)
+	if err != nil {
+		return nil, err
+	}
+
+	return tk, nil
+}
+
+type DeleteStateTokenIn struct {
+	IDScenario int64 `path:"scenario, required"`
+	IDTk       int64 `path:"statetoken, required"`
+}
+
+// Delete a state token of the scenario. Base game state tokens cannot be deleted.
+func DeleteStateToken(c *gin.Context, in *DeleteStateTokenIn) error {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	tk, err := models.LoadStateTokenFromID(db, sc, in.IDTk)
+	if err != nil {
+		return err
+	}
+	if tk.IDScenario == nil {
+		return errors.NewForbidden(nil, "Cannot delete base game state token")
+	}
+
+	return tk.Delete(db)
 }
@@ -15,7 +15,9 @@ type NewStateTokenLinkIn struct {
 
 func NewStateTokenLink(c *gin.Context, in *NewStateTokenLinkIn) (*models.StateTokenLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -25,7 +27,7 @@ func NewStateTokenLink(c *gin.Context, in *NewStateTokenLinkIn) (*models.StateTo
 		return nil, err
 	}
 
-	tk, err := models.LoadStateTokenFromID(db, in.IDStateToken)
+	tk, err := models.LoadStateTokenFromID(db, sc, in.IDStateToken)
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +43,9 @@ type ListStateTokenLinksIn struct {
 
 func ListStateTokenLinks(c *gin.Context, in *ListStateTokenLinksIn) ([]*models.StateTokenLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +60,7 @@ func ListStateTokenLinks(c *gin.Context, in *ListStateTokenLinksIn) ([]*models.S
 
 	var tk *models.StateToken
 	if in.IDStateToken != nil {
-		tk, err = models.LoadStateTokenFromID(db, *in.IDStateToken)
+		tk, err = models.LoadStateTokenFromID(db, sc, *in.IDStateToken)
 		if err != nil {
 			return nil, err
 		}
@@ -72,7 +76,9 @@ type GetStateTokenLinkIn struct {
 
 func GetStateTokenLink(c *gin.Context, in *GetStateTokenLinkIn) (*models.StateTokenLink, error) {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +93,9 @@ type DeleteStateTokenLinkIn struct {
 
 func DeleteStateTokenLink(c *gin.Context, in *DeleteStateTokenLinkIn) error {
 
-	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario)
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
 	if err != nil {
 		return err
 	}
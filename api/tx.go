@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/loopfz/gad/zesty"
+	"github.com/loopfz/gadgeto/tonic"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/constants"
+	"github.com/loopfz/scecret/models"
+	"github.com/loopfz/scecret/utils/blobstore"
+	"github.com/loopfz/scecret/utils/securerandom"
+)
+
+// Every handler runs inside its own transaction, committed when it succeeds and rolled back
+// when it fails: a failure halfway through a multi-step model operation leaves nothing behind.
+// Handlers retrieve the transaction with getDB.
+// All the changes made by a handler are recorded as scenario revisions, in one batch.
+// Blob store changes follow the transaction: blobs written by a failed handler are deleted,
+// and blobs deleted by a handler are only deleted once its transaction is committed.
+
+const (
+	DBPROVIDER_KEY = "dbprovider"
+	BATCH_KEY      = "revisionbatch"
+	BLOBTX_KEY     = "blobtx"
+	BATCH_ID_LEN   = 16
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Database of the current request, running in its transaction.
+func getDB(c *gin.Context) *models.RevisionRecorder {
+	return &models.RevisionRecorder{
+		SqlExecutor: c.MustGet(DBPROVIDER_KEY).(zesty.DBProvider).DB(),
+		Batch:       c.MustGet(BATCH_KEY).(string),
+		Author: func() (int64, int64) {
+			var IDUser, IDSession int64
+			if u, ok := c.Get(auth.USER_KEY); ok {
+				IDUser = u.(*models.User).ID
+			}
+			if s, ok := c.Get(auth.SESSION_KEY); ok {
+				IDSession = s.(*models.Session).ID
+			}
+			return IDUser, IDSession
+		},
+		Blobs: c.MustGet(BLOBTX_KEY).(*blobstore.Tx),
+	}
+}
+
+func beginTx(c *gin.Context) (zesty.DBProvider, error) {
+	dbp, err := zesty.NewDBProvider(constants.DBName)
+	if err != nil {
+		return nil, err
+	}
+	err = dbp.Tx()
+	if err != nil {
+		return nil, err
+	}
+	batch, err := securerandom.RandomString(BATCH_ID_LEN)
+	if err != nil {
+		dbp.Rollback()
+		return nil, err
+	}
+	c.Set(DBPROVIDER_KEY, dbp)
+	c.Set(BATCH_KEY, batch)
+	c.Set(BLOBTX_KEY, models.NewBlobTx())
+	return dbp, nil
+}
+
+// Commit the transaction, then apply the deferred blob deletes.
+// A failed blob delete only leaves an orphan blob behind, it does not fail the request.
+func commitTx(c *gin.Context, dbp zesty.DBProvider) error {
+	err := dbp.Commit()
+	if err != nil {
+		rollbackBlobs(c)
+		return err
+	}
+	if tx := c.MustGet(BLOBTX_KEY).(*blobstore.Tx); tx != nil {
+		tx.Commit()
+	}
+	return nil
+}
+
+func rollbackTx(c *gin.Context, dbp zesty.DBProvider) {
+	dbp.Rollback()
+	rollbackBlobs(c)
+}
+
+// Delete the blobs written by the transaction.
+func rollbackBlobs(c *gin.Context) {
+	if tx := c.MustGet(BLOBTX_KEY).(*blobstore.Tx); tx != nil {
+		tx.Rollback()
+	}
+}
+
+// Rollback if the handler panics, then let the panic go on.
+func rollbackOnPanic(c *gin.Context, dbp zesty.DBProvider) {
+	if r := recover(); r != nil {
+		rollbackTx(c, dbp)
+		panic(r)
+	}
+}
+
+// Build a tonic handler running f inside a transaction.
+// f has the signature expected by tonic, and must return an error as its last value:
+// the transaction is committed if it is nil, rolled back otherwise.
+func txHandler(f interface{}, retcode int) gin.HandlerFunc {
+	fv := reflect.ValueOf(f)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumOut() == 0 || ft.Out(ft.NumOut()-1) != errorType {
+		panic("txHandler: handler must be a function returning an error")
+	}
+
+	// Same results as the handler, with zero values and the given error
+	errResults := func(err error) []reflect.Value {
+		ret := make([]reflect.Value, ft.NumOut())
+		for i := range ret {
+			ret[i] = reflect.Zero(ft.Out(i))
+		}
+		ret[len(ret)-1] = reflect.ValueOf(&err).Elem()
+		return ret
+	}
+
+	wrapped := reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+		c := args[0].Interface().(*gin.Context)
+
+		dbp, err := beginTx(c)
+		if err != nil {
+			return errResults(err)
+		}
+		defer rollbackOnPanic(c, dbp)
+
+		out := fv.Call(args)
+
+		if !out[len(out)-1].IsNil() {
+			rollbackTx(c, dbp)
+			return out
+		}
+		err = commitTx(c, dbp)
+		if err != nil {
+			return errResults(err)
+		}
+		return out
+	})
+
+	return tonic.Handler(wrapped.Interface(), retcode)
+}
+
+// Build a raw (non-tonic) handler running h inside a transaction.
+// Raw handlers write their own response, so it is buffered until the end of the handler:
+// the transaction is committed if the response status is a success, rolled back otherwise.
+// If the commit fails, the buffered response is replaced with the error.
+func txRawHandler(h gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		dbp, err := beginTx(c)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+		defer rollbackOnPanic(c, dbp)
+
+		w := c.Writer
+		bw := &bufferedWriter{ResponseWriter: w, status: 200}
+		c.Writer = bw
+		h(c)
+		c.Writer = w
+
+		if bw.status >= 400 {
+			rollbackTx(c, dbp)
+		} else if err := commitTx(c, dbp); err != nil {
+			renderError(c, err)
+			return
+		}
+
+		w.WriteHeader(bw.status)
+		w.Write(bw.buf.Bytes())
+	}
+}
+
+// bufferedWriter holds back the status and body of a response.
+// Headers are set directly on the underlying writer, which has not written anything yet.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	buf     bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.buf.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.buf.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.buf.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+// The response is only sent once the transaction is committed.
+func (w *bufferedWriter) Flush() {}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/auth"
+	"github.com/loopfz/scecret/models"
+)
+
+type UndoIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+// Undo the last operation made on a scenario from the current session.
+func Undo(c *gin.Context, in *UndoIn) ([]*models.Revision, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := auth.RetrieveTokenSession(db, c)
+	if err != nil {
+		return nil, err
+	}
+
+	revs, err := models.Undo(db, sc, s.ID)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+
+	return revs, nil
+}
+
+type RedoIn struct {
+	IDScenario int64 `path:"scenario, required"`
+}
+
+// Redo the last operation undone on a scenario from the current session.
+func Redo(c *gin.Context, in *RedoIn) ([]*models.Revision, error) {
+
+	db := getDB(c)
+
+	sc, err := auth.RetrieveTokenScenario(db, c, in.IDScenario, models.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := auth.RetrieveTokenSession(db, c)
+	if err != nil {
+		return nil, err
+	}
+
+	revs, err := models.Redo(db, sc, s.ID)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, err.Error())
+	}
+
+	return revs, nil
+}
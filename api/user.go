@@ -1,9 +1,8 @@
 package main
 
 import (
-	"errors"
-
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"github.com/loopfz/scecret/auth"
 	"github.com/loopfz/scecret/models"
 )
@@ -14,6 +13,8 @@ type RegisterUserIn struct {
 }
 
 func RegisterUser(c *gin.Context, in *RegisterUserIn) (*models.User, error) {
+	db := getDB(c)
+
 	return models.CreateUser(db, in.Email, in.Password)
 }
 
@@ -24,6 +25,8 @@ type AuthIn struct {
 
 func Auth(c *gin.Context, in *AuthIn) (string, error) {
 
+	db := getDB(c)
+
 	u, err := models.LoadUserFromEmail(db, in.Email)
 	if err != nil {
 		return "", err
@@ -33,7 +36,7 @@ func Auth(c *gin.Context, in *AuthIn) (string, error) {
 		return "", errors.New("Bad password")
 	}
 
-	tk, err := auth.CreateToken(u)
+	tk, err := auth.CreateToken(db, u)
 	if err != nil {
 		return "", err
 	}
@@ -43,5 +46,66 @@ func Auth(c *gin.Context, in *AuthIn) (string, error) {
 
 func GetMe(c *gin.Context) (*models.User, error) {
 
+	db := getDB(c)
+
 	return auth.RetrieveTokenUser(db, c)
 }
+
+func Logout(c *gin.Context) error {
+
+	db := getDB(c)
+
+	s, err := auth.RetrieveTokenSession(db, c)
+	if err != nil {
+		return err
+	}
+
+	return s.Delete(db)
+}
+
+func ListSessions(c *gin.Context) ([]*models.Session, error) {
+
+	db := getDB(c)
+
+	current, err := auth.RetrieveTokenSession(db, c)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := models.LoadUserFromID(db, current.IDUser)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := models.ListSessions(db, u)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range sessions {
+		s.Current = s.ID == current.ID
+	}
+
+	return sessions, nil
+}
+
+type DeleteSessionIn struct {
+	IDSession int64 `path:"session, required"`
+}
+
+func DeleteSession(c *gin.Context, in *DeleteSessionIn) error {
+
+	db := getDB(c)
+
+	u, err := auth.RetrieveTokenUser(db, c)
+	if err != nil {
+		return err
+	}
+
+	s, err := models.LoadSessionFromID(db, u, in.IDSession)
+	if err != nil {
+		return errors.NewNotFound(err, "No such session")
+	}
+
+	return s.Delete(db)
+}
@@ -0,0 +1,549 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+const (
+	FORMAT_VERSION = 1
+)
+
+// table describes how the rows of a model table are dumped and restored.
+// refs maps foreign key columns to the table they reference.
+// remap rewrites the references that are not columns (e.g. inside JSON data), with the ID maps
+// of the tables above it.
+// Tables are listed in dependency order: a table only references tables above it.
+type table struct {
+	name  string
+	proto interface{}
+	refs  map[string]string
+	remap func(r *restorer, row interface{}) error
+}
+
+// Models verifying their objects before creating them.
+// Restored rows go through the same verification.
+type validator interface {
+	Valid() error
+}
+
+var tables = []table{
+	{name: "image", proto: models.Image{}},
+	{name: "icon", proto: models.Icon{}, refs: map[string]string{"id_image": "image"}},
+	{name: "stat", proto: models.Stat{}, refs: map[string]string{"id_icon": "icon"}},
+	{name: "state_token", proto: models.StateToken{}, refs: map[string]string{"id_icon": "icon"}},
+	{name: "card", proto: models.Card{}},
+	{name: "location", proto: models.Location{}, refs: map[string]string{"id_background": "image"}},
+	{name: "location_card", proto: models.LocationCard{}, refs: map[string]string{
+		"id_location": "location",
+		"id_card":     "card",
+	}},
+	{name: "element", proto: models.Element{}, refs: map[string]string{"id_card": "card"}},
+	{name: "receptacle", proto: models.Receptacle{}, refs: map[string]string{"id_card": "card"}},
+	{name: "receptacle_stat", proto: models.ReceptacleStat{}, refs: map[string]string{
+		"id_receptacle": "receptacle",
+		"id_stat":       "stat",
+	}},
+	{name: "requirement", proto: models.Requirement{}, refs: map[string]string{"id_card": "card"}, remap: remapRequirement},
+	{name: "mission_success", proto: models.MissionSuccess{}, refs: map[string]string{"id_card": "card"}},
+	{name: "codex", proto: models.Codex{}, refs: map[string]string{"id_card": "card"}},
+	{name: "plan", proto: models.Plan{}, refs: map[string]string{
+		"id_location": "location",
+		"id_card":     "card",
+	}},
+	{name: "element_link", proto: models.ElementLink{}, refs: map[string]string{
+		"id_element": "element",
+		"id_card":    "card",
+	}},
+	{name: "element_combination", proto: models.ElementCombination{}, refs: map[string]string{"id_element": "element"}},
+	{name: "element_combination_input", proto: models.ElementCombinationInput{}, refs: map[string]string{
+		"id_combination": "element_combination",
+		"id_element":     "element",
+	}},
+	{name: "location_link", proto: models.LocationLink{}, refs: map[string]string{
+		"id_card":     "card",
+		"id_location": "location",
+	}},
+	{name: "state_token_link", proto: models.StateTokenLink{}, refs: map[string]string{
+		"id_card":        "card",
+		"id_state_token": "state_token",
+	}},
+	{name: "skill_test", proto: models.SkillTest{}, refs: map[string]string{
+		"id_card": "card",
+		"id_stat": "stat",
+	}},
+	{name: "card_icon", proto: models.CardIcon{}, refs: map[string]string{
+		"id_card":           "card",
+		"id_icon":           "icon",
+		"id_skilltest":      "skill_test",
+		"id_statetokenlink": "state_token_link",
+		"id_receptaclestat": "receptacle_stat",
+		"id_requirement":    "requirement",
+	}},
+}
+
+// Tables holding base game objects, shared by all scenarios.
+// References to their rows are kept as-is when they are not part of the bundle,
+// as long as they reference base game objects.
+var globalTables = map[string]bool{
+	"icon":        true,
+	"state_token": true,
+}
+
+// Bundle is a self-contained copy of a scenario: all its rows, indexed by table name,
+// and the raw data of its images, indexed by image ID.
+type Bundle struct {
+	Version int
+	Name    string
+	Rows    map[string][]interface{}
+	Images  map[int64][]byte
+}
+
+// Dump all the objects of a scenario into a bundle.
+func Dump(db gorp.SqlExecutor, scenar *models.Scenario) (*Bundle, error) {
+	return dump(db, scenar, true)
+}
+
+// Dump all the objects of a scenario into a bundle, without the data of its images.
+// Enough to compare scenarios, but not to restore them.
+func DumpRows(db gorp.SqlExecutor, scenar *models.Scenario) (*Bundle, error) {
+	return dump(db, scenar, false)
+}
+
+func dump(db gorp.SqlExecutor, scenar *models.Scenario, withImages bool) (*Bundle, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to dump scenario")
+	}
+
+	b := &Bundle{
+		Version: FORMAT_VERSION,
+		Name:    scenar.Name,
+		Rows:    make(map[string][]interface{}),
+		Images:  make(map[int64][]byte),
+	}
+
+	images, err := models.ListImages(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		if withImages {
+			data, err := img.Content()
+			if err != nil {
+				return nil, err
+			}
+			b.Images[img.ID] = data
+		}
+		b.add("image", img)
+	}
+
+	icons, err := models.ListIcons(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, ico := range icons {
+		// Skip base game icons
+		if ico.IDScenario != nil {
+			b.add("icon", ico)
+		}
+	}
+
+	tokens, err := models.ListStateTokens(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, tk := range tokens {
+		// Skip base game state tokens
+		if tk.IDScenario != nil {
+			b.add("state_token", tk)
+		}
+	}
+
+	stats, err := models.ListStats(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range stats {
+		b.add("stat", st)
+	}
+
+	cards, err := models.ListCards(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cards {
+		b.add("card", c)
+	}
+
+	locs, err := models.ListLocations(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, loc := range locs {
+		b.add("location", loc)
+		locCards, err := loc.ListLocationCards(db)
+		if err != nil {
+			return nil, err
+		}
+		for _, lc := range locCards {
+			b.add("location_card", lc)
+		}
+	}
+
+	elems, err := models.ListElements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elems {
+		b.add("element", e)
+	}
+
+	receptacles, err := models.ListReceptacles(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range receptacles {
+		b.add("receptacle", r)
+		for _, rs := range r.Stats {
+			b.add("receptacle_stat", rs)
+		}
+	}
+
+	reqs, err := models.ListRequirements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reqs {
+		b.add("requirement", r)
+	}
+
+	missionSuccesses, err := models.ListMissionSuccesses(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, ms := range missionSuccesses {
+		b.add("mission_success", ms)
+	}
+
+	codices, err := models.ListCodices(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, cx := range codices {
+		b.add("codex", cx)
+	}
+
+	plans, err := models.ListPlans(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range plans {
+		b.add("plan", p)
+	}
+
+	elemLinks, err := models.ListElementLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, el := range elemLinks {
+		b.add("element_link", el)
+	}
+
+	combinations, err := models.ListElementCombinations(db, scenar, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, ec := range combinations {
+		b.add("element_combination", ec)
+		for _, eci := range ec.Inputs {
+			b.add("element_combination_input", eci)
+		}
+	}
+
+	locLinks, err := models.ListLocationLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, ll := range locLinks {
+		b.add("location_link", ll)
+	}
+
+	tkLinks, err := models.ListStateTokenLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, tl := range tkLinks {
+		b.add("state_token_link", tl)
+	}
+
+	skillTests, err := models.ListSkillTests(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range skillTests {
+		b.add("skill_test", st)
+	}
+
+	cardIcons, err := models.ListScenarioCardIcons(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, ci := range cardIcons {
+		b.add("card_icon", ci)
+	}
+
+	return b, nil
+}
+
+func (b *Bundle) add(tableName string, row interface{}) {
+	b.Rows[tableName] = append(b.Rows[tableName], row)
+}
+
+// Recreate the objects of a bundle as a new scenario belonging to author.
+// All objects get fresh IDs, and all references between them are remapped.
+// The rows of the bundle are modified in place.
+func Restore(db gorp.SqlExecutor, b *Bundle, author *models.User, name string) (*models.Scenario, error) {
+	if db == nil || b == nil || author == nil {
+		return nil, errors.New("Missing parameters to restore scenario")
+	}
+	if b.Version > FORMAT_VERSION {
+		return nil, fmt.Errorf("Unsupported archive version %d (max %d)", b.Version, FORMAT_VERSION)
+	}
+
+	if name == "" {
+		name = b.Name
+	}
+	scenar, err := models.CreateScenario(db, name, author)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &restorer{db: db, idMap: make(map[string]map[int64]int64)}
+
+	for _, t := range tables {
+		r.idMap[t.name] = make(map[int64]int64)
+
+		for _, row := range b.Rows[t.name] {
+			cols := models.Columns(row)
+
+			oldID := cols["id"].Int()
+
+			if t.name == "image" {
+				// Images are recreated from their raw data, to go through validation and storage
+				img, err := models.CreateImage(db, scenar, b.Images[oldID])
+				if err != nil {
+					return nil, err
+				}
+				r.idMap[t.name][oldID] = img.ID
+				continue
+			}
+
+			if c, ok := cols["id_scenario"]; ok {
+				setInt(c, scenar.ID)
+			}
+
+			for col, refTable := range t.refs {
+				c, ok := cols[col]
+				if !ok || isNull(c) {
+					continue
+				}
+				newID, err := r.ref(refTable, getInt(c))
+				if err != nil {
+					return nil, fmt.Errorf("%s %d: %s=%d: %s", t.name, oldID, col, getInt(c), err)
+				}
+				setInt(c, newID)
+			}
+
+			if t.remap != nil {
+				err := t.remap(r, row)
+				if err != nil {
+					return nil, fmt.Errorf("%s %d: %s", t.name, oldID, err)
+				}
+			}
+
+			if v, ok := row.(validator); ok {
+				err := v.Valid()
+				if err != nil {
+					return nil, fmt.Errorf("%s %d: %s", t.name, oldID, err)
+				}
+			}
+
+			cols["id"].SetInt(0)
+			err := db.Insert(row)
+			if err != nil {
+				return nil, err
+			}
+			r.idMap[t.name][oldID] = cols["id"].Int()
+		}
+	}
+
+	return scenar, nil
+}
+
+// Deep-copy a scenario under a new name, for author.
+func Clone(db gorp.SqlExecutor, scenar *models.Scenario, author *models.User, name string) (*models.Scenario, error) {
+	if db == nil || scenar == nil || author == nil {
+		return nil, errors.New("Missing parameters to clone scenario")
+	}
+
+	b, err := Dump(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	return Restore(db, b, author, name)
+}
+
+// Dump a scenario in its state right after a revision, without the data of its images (see DumpRows).
+// The current state is dumped, then the later revisions are reverted on the bundle,
+// without touching the database.
+func DumpRevision(db gorp.SqlExecutor, scenar *models.Scenario, rev *models.Revision) (*Bundle, error) {
+	if db == nil || scenar == nil || rev == nil {
+		return nil, errors.New("Missing parameters to dump scenario revision")
+	}
+
+	b, err := DumpRows(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	later, err := models.ListRevisionsAfter(db, scenar, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range later {
+		err := b.revert(r)
+		if err != nil {
+			return nil, fmt.Errorf("Reverting revision %d: %s", r.ID, err)
+		}
+	}
+
+	return b, nil
+}
+
+// Apply the inverse of a revision to the rows of a bundle.
+func (b *Bundle) revert(rev *models.Revision) error {
+	before, _, err := rev.Objects()
+	if err != nil {
+		return err
+	}
+
+	rows := b.Rows[rev.ObjectType]
+	i := 0
+	for ; i < len(rows); i++ {
+		if models.Columns(rows[i])["id"].Int() == rev.IDObject {
+			break
+		}
+	}
+
+	switch {
+	case i < len(rows) && before == nil:
+		// Created by the revision
+		b.Rows[rev.ObjectType] = append(rows[:i:i], rows[i+1:]...)
+	case i < len(rows):
+		// Updated by the revision
+		rows[i] = before
+	case before != nil:
+		// Deleted by the revision
+		b.add(rev.ObjectType, before)
+	}
+	return nil
+}
+
+// restorer holds the state of a Restore: the new IDs of the rows restored so far.
+type restorer struct {
+	db gorp.SqlExecutor
+	// Old ID -> new ID, by table
+	idMap map[string]map[int64]int64
+}
+
+// New ID of a referenced row. Rows of global tables that are not part of the bundle
+// are kept as-is, if they are base game objects.
+func (r *restorer) ref(table string, oldID int64) (int64, error) {
+	newID, ok := r.idMap[table][oldID]
+	if ok {
+		return newID, nil
+	}
+	if !globalTables[table] {
+		return 0, errors.New("dangling reference")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`count(*)`).From(`"` + table + `"`).Where(
+		squirrel.Eq{`id`: oldID},
+	).Where(
+		squirrel.Eq{`id_scenario`: nil},
+	).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := r.db.SelectInt(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, errors.New("dangling reference, not a base game object")
+	}
+
+	return oldID, nil
+}
+
+// Remap the state tokens and elements of a requirement expression.
+func remapRequirement(r *restorer, row interface{}) error {
+	var walk func(e *models.RequirementExpr) error
+	walk = func(e *models.RequirementExpr) error {
+		if e == nil {
+			return nil
+		}
+		if e.IDStateToken != 0 {
+			newID, err := r.ref("state_token", e.IDStateToken)
+			if err != nil {
+				return fmt.Errorf("state token %d: %s", e.IDStateToken, err)
+			}
+			e.IDStateToken = newID
+		}
+		if e.IDElement != 0 {
+			newID, err := r.ref("element", e.IDElement)
+			if err != nil {
+				return fmt.Errorf("element %d: %s", e.IDElement, err)
+			}
+			e.IDElement = newID
+		}
+		for _, o := range e.Operands {
+			err := walk(o)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(row.(*models.Requirement).Expression)
+}
+
+// Helpers to handle both int64 and *int64 (nullable) columns.
+
+func isNull(v reflect.Value) bool {
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func getInt(v reflect.Value) int64 {
+	if v.Kind() == reflect.Ptr {
+		return v.Elem().Int()
+	}
+	return v.Int()
+}
+
+func setInt(v reflect.Value, i int64) {
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.ValueOf(&i))
+		return
+	}
+	v.SetInt(i)
+}
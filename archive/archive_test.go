@@ -0,0 +1,223 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/db/initdb"
+	"github.com/loopfz/scecret/models"
+)
+
+func testDB(t *testing.T) *gorp.DbMap {
+	db, err := initdb.InitSqliteRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRemapRequirement(t *testing.T) {
+	db := testDB(t)
+
+	base := &models.StateToken{ShortName: "base"}
+	err := db.Insert(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &models.StateToken{IDScenario: new(int64), ShortName: "other scenario"}
+	*other.IDScenario = 42
+	err = db.Insert(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := func(ID int64) *models.RequirementExpr {
+		return &models.RequirementExpr{Op: models.RequirementToken, IDStateToken: ID}
+	}
+	element := func(ID int64) *models.RequirementExpr {
+		return &models.RequirementExpr{Op: models.RequirementElement, IDElement: ID}
+	}
+	and := func(ops ...*models.RequirementExpr) *models.RequirementExpr {
+		return &models.RequirementExpr{Op: models.RequirementAnd, Operands: ops}
+	}
+
+	tests := []struct {
+		name     string
+		expr     *models.RequirementExpr
+		expected *models.RequirementExpr
+		valid    bool
+	}{
+		{"bundle token", token(1001), token(101), true},
+		{"bundle element", element(1002), element(202), true},
+		{"nested", and(token(1001), element(1002)), and(token(101), element(202)), true},
+		{"base token", token(base.ID), token(base.ID), true},
+		{"dangling element", element(3), nil, false},
+		{"other scenario token", and(element(1002), token(other.ID)), nil, false},
+		{"missing token", token(999), nil, false},
+	}
+
+	for _, tt := range tests {
+		r := &restorer{db: db, idMap: map[string]map[int64]int64{
+			"state_token": {1001: 101},
+			"element":     {1002: 202},
+		}}
+		req := &models.Requirement{Expression: tt.expr}
+		err := remapRequirement(r, req)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %v", tt.name, err, tt.valid)
+			continue
+		}
+		if tt.valid && !reflect.DeepEqual(req.Expression, tt.expected) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, req.Expression, tt.expected)
+		}
+	}
+}
+
+func TestZipRoundTrip(t *testing.T) {
+	db := testDB(t)
+
+	u, err := models.CreateUser(db, "author@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := models.CreateScenario(db, "Round trip", u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ico, err := models.CreateIcon(db, sc, "combat", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, err := models.CreateStat(db, sc, ico, "Combat", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.CreateStateToken(db, sc, "door", ico, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := models.CreateLocation(db, sc, "Hall", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc, err := loc.CreateLocationCard(db, sc, "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, err := models.LoadCardFromID(db, sc, lc.IDCard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	el, err := models.CreateElement(db, sc, 3, "Key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.CreateElementLink(db, card, el, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = models.CreateReceptacle(db, sc, "Box", 3, "", []*models.ReceptacleStat{{IDStat: stat.ID, Value: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Dump(db, sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = b.WriteZip(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := ReadZip(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc2, err := Restore(db, b2, u, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc2.Name != sc.Name || sc2.ID == sc.ID {
+		t.Fatalf("Restored scenario %+v from %+v", sc2, sc)
+	}
+	restored, err := Dump(db, sc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		table string
+		rows  int
+	}{
+		{"icon", 1},
+		{"stat", 1},
+		{"state_token", 1},
+		{"card", 3}, // Location, element and receptacle cards
+		{"location", 1},
+		{"location_card", 1},
+		{"element", 1},
+		{"element_link", 1},
+		{"receptacle", 1},
+		{"receptacle_stat", 1},
+	}
+
+	for _, tt := range tests {
+		if len(b.Rows[tt.table]) != tt.rows {
+			t.Errorf("%s: dumped %d rows, want %d", tt.table, len(b.Rows[tt.table]), tt.rows)
+		}
+		if len(restored.Rows[tt.table]) != tt.rows {
+			t.Errorf("%s: restored %d rows, want %d", tt.table, len(restored.Rows[tt.table]), tt.rows)
+		}
+	}
+}
+
+func TestReadZipLimits(t *testing.T) {
+	archive := func(files map[string][]byte) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, data := range files {
+			f, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(data)
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+	manifest := []byte(fmt.Sprintf(`{"version":%d,"name":"test"}`, FORMAT_VERSION))
+
+	many := map[string][]byte{MANIFEST_FILE: manifest}
+	for i := 0; i < MAX_FILES; i++ {
+		many[fmt.Sprintf("%s%d", IMAGES_DIR, i)] = nil
+	}
+	big := map[string][]byte{MANIFEST_FILE: manifest}
+	for i := 0; i <= MAX_ARCHIVE_SIZE/MAX_FILE_SIZE; i++ {
+		big[fmt.Sprintf("%s%d", IMAGES_DIR, i)] = make([]byte, MAX_FILE_SIZE)
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"manifest only", archive(map[string][]byte{MANIFEST_FILE: manifest}), true},
+		{"missing manifest", archive(map[string][]byte{"tables/card.json": []byte("[]")}), false},
+		{"unsupported version", archive(map[string][]byte{MANIFEST_FILE: []byte(`{"version":99}`)}), false},
+		{"too many files", archive(many), false},
+		{"too big", archive(big), false},
+		{"not a zip", []byte("hello"), false},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadZip(tt.data)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/loopfz/scecret/models"
+)
+
+const (
+	MANIFEST_FILE = "manifest.json"
+	TABLES_DIR    = "tables/"
+	IMAGES_DIR    = "images/"
+
+	MAX_FILE_SIZE    = 50 << 20  // Uncompressed size of a single file, in bytes
+	MAX_ARCHIVE_SIZE = 200 << 20 // Uncompressed size of all files, in bytes
+	MAX_FILES        = 5000
+)
+
+// Columns that are never written to archives: image data is stored
+// in separate files, and blob keys only make sense on the exporting server.
+var skippedColumns = map[string]bool{
+	"data":     true,
+	"blob_key": true,
+}
+
+type manifest struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// Write a bundle as a ZIP archive:
+// a manifest, one JSON file per table, and one file per image.
+func (b *Bundle) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	err := writeJSON(zw, MANIFEST_FILE, &manifest{Version: b.Version, Name: b.Name})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		rows := []map[string]interface{}{}
+		for _, row := range b.Rows[t.name] {
+			r := make(map[string]interface{})
+			for col, v := range models.Columns(row) {
+				if skippedColumns[col] {
+					continue
+				}
+				r[col] = v.Interface()
+			}
+			rows = append(rows, r)
+		}
+		err := writeJSON(zw, TABLES_DIR+t.name+".json", rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	for ID, data := range b.Images {
+		f, err := zw.Create(fmt.Sprintf("%s%d", IMAGES_DIR, ID))
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(f).Encode(v)
+}
+
+// Read a bundle from a ZIP archive written by WriteZip.
+// Columns missing from the archive (e.g. added in a later version) keep their zero value,
+// and tables missing from the archive are empty.
+func ReadZip(data []byte) (*Bundle, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(zr.File) > MAX_FILES {
+		return nil, fmt.Errorf("Too many files in archive: %d (max %d)", len(zr.File), MAX_FILES)
+	}
+
+	// Reading a file fails past its declared size, so the declared sizes bound the total
+	var size uint64
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		if f.UncompressedSize64 > MAX_ARCHIVE_SIZE-size {
+			return nil, fmt.Errorf("Archive too big: more than %d bytes uncompressed", MAX_ARCHIVE_SIZE)
+		}
+		size += f.UncompressedSize64
+		files[f.Name] = f
+	}
+
+	var m manifest
+	err = readJSON(files, MANIFEST_FILE, &m)
+	if err != nil {
+		return nil, err
+	}
+	if m.Version == 0 || m.Version > FORMAT_VERSION {
+		return nil, fmt.Errorf("Unsupported archive version %d (max %d)", m.Version, FORMAT_VERSION)
+	}
+
+	b := &Bundle{
+		Version: m.Version,
+		Name:    m.Name,
+		Rows:    make(map[string][]interface{}),
+		Images:  make(map[int64][]byte),
+	}
+
+	for _, t := range tables {
+		if _, ok := files[TABLES_DIR+t.name+".json"]; !ok {
+			continue
+		}
+		var rows []map[string]json.RawMessage
+		err := readJSON(files, TABLES_DIR+t.name+".json", &rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			row := reflect.New(reflect.TypeOf(t.proto)).Interface()
+			for col, v := range models.Columns(row) {
+				raw, ok := r[col]
+				if !ok || skippedColumns[col] {
+					continue
+				}
+				err := json.Unmarshal(raw, v.Addr().Interface())
+				if err != nil {
+					return nil, fmt.Errorf("%s.%s: %s", t.name, col, err)
+				}
+			}
+			b.add(t.name, row)
+		}
+	}
+
+	for name, f := range files {
+		if !strings.HasPrefix(name, IMAGES_DIR) || f.FileInfo().IsDir() {
+			continue
+		}
+		ID, err := strconv.ParseInt(strings.TrimPrefix(name, IMAGES_DIR), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid image file name: %s", name)
+		}
+		data, err := readFile(f)
+		if err != nil {
+			return nil, err
+		}
+		b.Images[ID] = data
+	}
+
+	return b, nil
+}
+
+func readJSON(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("Missing %s in archive", name)
+	}
+	data, err := readFile(f)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > MAX_FILE_SIZE {
+		return nil, errors.New("File too big in archive: " + f.Name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(io.LimitReader(r, MAX_FILE_SIZE))
+}
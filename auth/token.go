@@ -1,7 +1,8 @@
 package auth
 
 import (
-	"sync"
+	"database/sql"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-gorp/gorp"
@@ -14,61 +15,118 @@ import (
 const (
 	TOKEN_LEN    = 64
 	TOKEN_HEADER = "X-Auth-Token"
-)
+	USER_KEY     = "user"    // Context key of the authenticated user, set by RetrieveTokenUser
+	SESSION_KEY  = "session" // Context key of the session, set by RetrieveTokenSession
 
-var (
-	tokenStore = make(map[string]string)
-	lock       sync.RWMutex
+	// Last-used timestamps are only updated when older than this, to avoid a write on every request
+	SESSION_TOUCH_INTERVAL = time.Minute
 )
 
-func CreateToken(user *models.User) (string, error) {
+// Tokens expire when they have not been used for this long. Zero means tokens never expire.
+var TokenTTL = 30 * 24 * time.Hour
+
+// Create a token for a user. Only its digest is stored, in a new session.
+// The user's expired sessions are cleaned up.
+func CreateToken(db gorp.SqlExecutor, user *models.User) (string, error) {
 
 	tk, err := securerandom.RandomString(TOKEN_LEN)
 	if err != nil {
 		return "", err
 	}
 
-	lock.Lock()
-	tokenStore[hasher.Hash(tk)] = user.Email
-	lock.Unlock()
+	if TokenTTL > 0 {
+		err = models.DeleteSessionsUnusedSince(db, user, time.Now().UTC().Add(-TokenTTL))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err = models.CreateSession(db, user, hasher.Hash(tk))
+	if err != nil {
+		return "", err
+	}
 
 	return tk, nil
 }
 
-func RetrieveTokenUser(db *gorp.DbMap, c *gin.Context) (*models.User, error) {
+// Retrieve the session of the request's token.
+func RetrieveTokenSession(db gorp.SqlExecutor, c *gin.Context) (*models.Session, error) {
 
 	tk := c.Request.Header.Get(TOKEN_HEADER)
+	if tk == "" {
+		return nil, errors.NewUnauthorized(nil, "Missing token")
+	}
 
-	lock.RLock()
-	email, ok := tokenStore[hasher.Hash(tk)]
-	lock.RUnlock()
-	if !ok {
+	s, err := models.LoadSessionFromTokenHash(db, hasher.Hash(tk))
+	if err == sql.ErrNoRows {
 		return nil, errors.NewUnauthorized(nil, "Bad token")
 	}
+	if err != nil {
+		return nil, errors.Wrap(err, errors.New("Error retrieving session"))
+	}
+
+	now := time.Now().UTC()
+
+	if TokenTTL > 0 && now.Sub(s.LastUsed) > TokenTTL {
+		return nil, errors.NewUnauthorized(nil, "Expired token")
+	}
+
+	if now.Sub(s.LastUsed) > SESSION_TOUCH_INTERVAL {
+		err = s.Touch(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.Set(SESSION_KEY, s)
 
-	u, err := models.LoadUserFromEmail(db, email)
+	return s, nil
+}
+
+func RetrieveTokenUser(db gorp.SqlExecutor, c *gin.Context) (*models.User, error) {
+
+	s, err := RetrieveTokenSession(db, c)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := models.LoadUserFromID(db, s.IDUser)
 	if err != nil {
 		return nil, errors.Wrap(err, errors.New("Error retrieving user information"))
 	}
 
+	c.Set(USER_KEY, u)
+
 	return u, nil
 }
 
-func RetrieveTokenScenario(db *gorp.DbMap, c *gin.Context, IDScenario int64) (*models.Scenario, error) {
+// Retrieve a scenario the request's user is a member of, with at least the required role.
+func RetrieveTokenScenario(db gorp.SqlExecutor, c *gin.Context, IDScenario int64, role string) (*models.Scenario, error) {
 
 	u, err := RetrieveTokenUser(db, c)
 	if err != nil {
 		return nil, err
 	}
 
-	sc, err := models.LoadScenarioFromID(db, u, IDScenario)
+	sc, err := models.LoadScenarioFromID(db, nil, IDScenario)
+	if err == sql.ErrNoRows {
+		return nil, errors.NewNotFound(nil, "No such scenario")
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if sc.IDAuthor != u.ID {
+	m, err := models.LoadScenarioMemberFromUser(db, sc, u)
+	if err == sql.ErrNoRows {
 		return nil, errors.NewNotFound(nil, "No such scenario")
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !models.RoleAtLeast(m.Role, role) {
+		return nil, errors.NewForbidden(nil, "Requires "+role+" role on this scenario")
+	}
 
 	return sc, nil
 }
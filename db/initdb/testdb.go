@@ -23,13 +23,36 @@ func PopulateDbMap(db *gorp.DbMap) error {
 	db.AddTableWithName(models.CardIcon{}, `card_icon`).SetKeys(true, "id")
 	db.AddTableWithName(models.Element{}, `element`).SetKeys(true, "id")
 	db.AddTableWithName(models.ElementLink{}, `element_link`).SetKeys(true, "id")
+	db.AddTableWithName(models.ElementCombination{}, `element_combination`).SetKeys(true, "id")
+	db.AddTableWithName(models.ElementCombinationInput{}, `element_combination_input`).SetKeys(true, "id")
+	db.AddTableWithName(models.Receptacle{}, `receptacle`).SetKeys(true, "id")
+	db.AddTableWithName(models.ReceptacleStat{}, `receptacle_stat`).SetKeys(true, "id")
+	db.AddTableWithName(models.Requirement{}, `requirement`).SetKeys(true, "id")
+	db.AddTableWithName(models.MissionSuccess{}, `mission_success`).SetKeys(true, "id")
+	db.AddTableWithName(models.Codex{}, `codex`).SetKeys(true, "id")
+	db.AddTableWithName(models.Plan{}, `plan`).SetKeys(true, "id")
 	db.AddTableWithName(models.Icon{}, `icon`).SetKeys(true, "id")
 	db.AddTableWithName(models.StateToken{}, `state_token`).SetKeys(true, "id")
 	db.AddTableWithName(models.StateTokenLink{}, `state_token_link`).SetKeys(true, "id")
 	db.AddTableWithName(models.Stat{}, `stat`).SetKeys(true, "id")
 	db.AddTableWithName(models.SkillTest{}, `skill_test`).SetKeys(true, "id")
+	db.AddTableWithName(models.Image{}, `image`).SetKeys(true, "id")
+	db.AddTableWithName(models.Session{}, `session`).SetKeys(true, "id")
+	db.AddTableWithName(models.ScenarioMember{}, `scenario_member`).SetKeys(true, "id")
+	db.AddTableWithName(models.Revision{}, `revision`).SetKeys(true, "id")
+	db.AddTableWithName(models.Playtest{}, `playtest`).SetKeys(true, "id")
 
-	return db.CreateTablesIfNotExists()
+	err := db.CreateTablesIfNotExists()
+	if err != nil {
+		return err
+	}
+
+	err = models.BackfillScenarioOwners(db)
+	if err != nil {
+		return err
+	}
+
+	return models.CreateBaseIcons(db)
 }
 
 func InitPostgres() (*gorp.DbMap, error) {
@@ -0,0 +1,260 @@
+package diagram
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+)
+
+// A diagram is a flat list of nodes and directed edges, written as text for diagram tools.
+// Node IDs are prefixed by their kind ("card_12") so that they are unique across kinds,
+// and valid identifiers in all formats.
+
+const (
+	FormatDOT     = "dot"
+	FormatGraphML = "graphml"
+	FormatMermaid = "mermaid"
+)
+
+// Formats, with the content type of their output.
+var Formats = map[string]string{
+	FormatDOT:     "text/vnd.graphviz; charset=utf-8",
+	FormatGraphML: "application/graphml+xml; charset=utf-8",
+	FormatMermaid: "text/plain; charset=utf-8",
+}
+
+// Node kinds are the node types of models.ScenarioGraph.
+const (
+	NodeLocation   = models.GraphNodeLocation
+	NodeCard       = models.GraphNodeCard
+	NodeElement    = models.GraphNodeElement
+	NodeStateToken = models.GraphNodeStateToken
+	NodeStat       = models.GraphNodeStat
+
+	NodeCombination = "combination" // Element combinations of the location diagram
+)
+
+const (
+	EdgeCard        = models.GraphEdgeCard // From a location to its cards
+	EdgeReveals     = "reveals"
+	EdgeUnlocks     = "unlocks"
+	EdgeGives       = "gives"
+	EdgeSkillTest   = "skill_test"
+	EdgeRequirement = models.GraphEdgeRequirement // From cards giving a token or element to cards whose requirement references it
+)
+
+type Diagram struct {
+	Nodes []*Node
+	Edges []*Edge
+}
+
+type Node struct {
+	ID    string
+	Kind  string
+	Label string
+}
+
+type Edge struct {
+	From  string
+	To    string
+	Kind  string
+	Label string
+}
+
+func NodeID(kind string, ID int64) string {
+	return models.GraphNodeID(kind, ID)
+}
+
+func (d *Diagram) AddNode(kind string, ID int64, label string) {
+	d.Nodes = append(d.Nodes, &Node{ID: NodeID(kind, ID), Kind: kind, Label: label})
+}
+
+func (d *Diagram) AddEdge(from, to string, kind string, label string) {
+	d.Edges = append(d.Edges, &Edge{From: from, To: to, Kind: kind, Label: label})
+}
+
+// Write the diagram in one of the Formats.
+func (d *Diagram) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatDOT:
+		return d.WriteDOT(w)
+	case FormatGraphML:
+		return d.WriteGraphML(w)
+	case FormatMermaid:
+		return d.WriteMermaid(w)
+	}
+	return fmt.Errorf("Unknown diagram format: %s", format)
+}
+
+// Build the diagram of a scenario's location graph (see models.LocationGraph):
+// locations and their cards, with the stats of skill tests, linked by
+// revealed locations, state tokens unlocking cards, elements given to cards using them
+// or to the combinations they are an input of, tokens and elements referenced by requirements,
+// and skill tests.
+func LocationDiagram(db gorp.SqlExecutor, scenar *models.Scenario) (*Diagram, error) {
+
+	locs, combs, err := models.LocationGraph(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(map[int64]string)
+	tks, err := models.ListStateTokens(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, tk := range tks {
+		tokens[tk.ID] = tk.ShortName
+	}
+
+	elements := make(map[int64]string)
+	elems, err := models.ListElements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elems {
+		elements[e.ID] = fmt.Sprintf("element %d", e.Number)
+	}
+
+	stats, err := models.ListStats(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diagram{}
+
+	// Cards unlocked by each token, using each element, requiring each token or element
+	unlocked := make(map[int64][]*models.CardGraph)
+	using := make(map[int64][]*models.CardGraph)
+	requiringToken := make(map[int64][]*models.CardGraph)
+	requiringElement := make(map[int64][]*models.CardGraph)
+	tested := make(map[int64]bool)
+
+	for _, loc := range locs {
+		label := loc.Name
+		if loc.Hidden {
+			label += " (hidden)"
+		}
+		d.AddNode(NodeLocation, loc.ID, label)
+		for _, c := range loc.Cards {
+			d.AddNode(NodeCard, c.ID, c.Description)
+			d.AddEdge(NodeID(NodeLocation, loc.ID), NodeID(NodeCard, c.ID), EdgeCard, "")
+			for _, tk := range c.IsUnlockedStateTokens {
+				unlocked[tk] = append(unlocked[tk], c)
+			}
+			for _, e := range c.UsesElements {
+				using[e] = append(using[e], c)
+			}
+			if c.Requirement != nil {
+				for _, tk := range c.Requirement.StateTokens() {
+					requiringToken[tk] = append(requiringToken[tk], c)
+				}
+				for _, e := range c.Requirement.Elements() {
+					requiringElement[e] = append(requiringElement[e], c)
+				}
+			}
+		}
+	}
+
+	// Combinations each element is an input of
+	combining := make(map[int64][]*models.CombGraph)
+	for _, cb := range combs {
+		d.AddNode(NodeCombination, cb.ID, "combination into "+elements[cb.GivesElements[0]])
+		for _, e := range cb.Inputs {
+			combining[e] = append(combining[e], cb)
+		}
+	}
+
+	addRelations := func(from string, c *models.CardGraph) {
+		for _, l := range c.Reveals {
+			d.AddEdge(from, NodeID(NodeLocation, l), EdgeReveals, fmt.Sprintf("reveals (%d TU)", c.TravelTUCosts[l]))
+		}
+		for _, tk := range c.UnlockStateTokens {
+			for _, to := range unlocked[tk] {
+				d.AddEdge(from, NodeID(NodeCard, to.ID), EdgeUnlocks, tokens[tk])
+			}
+			for _, to := range requiringToken[tk] {
+				d.AddEdge(from, NodeID(NodeCard, to.ID), EdgeRequirement, "requirement: "+tokens[tk])
+			}
+		}
+		for _, e := range c.GivesElements {
+			for _, to := range using[e] {
+				d.AddEdge(from, NodeID(NodeCard, to.ID), EdgeGives, elements[e])
+			}
+			for _, to := range combining[e] {
+				d.AddEdge(from, NodeID(NodeCombination, to.ID), EdgeGives, elements[e])
+			}
+			for _, to := range requiringElement[e] {
+				d.AddEdge(from, NodeID(NodeCard, to.ID), EdgeRequirement, "requirement: "+elements[e])
+			}
+		}
+		for _, st := range c.SkillTests {
+			d.AddEdge(from, NodeID(NodeStat, st), EdgeSkillTest, "skill test")
+			tested[st] = true
+		}
+	}
+
+	for _, loc := range locs {
+		for _, c := range loc.Cards {
+			addRelations(NodeID(NodeCard, c.ID), c)
+		}
+	}
+	for _, cb := range combs {
+		addRelations(NodeID(NodeCombination, cb.ID), &cb.CardGraph)
+	}
+
+	// Only the stats of skill tests are part of the diagram
+	for _, st := range stats {
+		if tested[st.ID] {
+			d.AddNode(NodeStat, st.ID, st.Name)
+		}
+	}
+
+	return d.pruneEdges(), nil
+}
+
+// Drop the edges whose endpoints are not nodes of the diagram, e.g. skill tests of stats
+// that are not part of the scenario.
+func (d *Diagram) pruneEdges() *Diagram {
+	nodes := make(map[string]bool)
+	for _, n := range d.Nodes {
+		nodes[n.ID] = true
+	}
+	edges := make([]*Edge, 0, len(d.Edges))
+	for _, e := range d.Edges {
+		if nodes[e.From] && nodes[e.To] {
+			edges = append(edges, e)
+		}
+	}
+	d.Edges = edges
+	return d
+}
+
+// Build the diagram of a scenario's full graph (see models.FullGraph), with its node types.
+// Edges are labelled by their type.
+func ScenarioDiagram(g *models.ScenarioGraph) *Diagram {
+	d := &Diagram{}
+
+	for _, n := range g.Nodes {
+		label := n.Name
+		if n.Hidden {
+			label += " (hidden)"
+		}
+		d.Nodes = append(d.Nodes, &Node{ID: n.ID, Kind: n.Type, Label: label})
+	}
+	for _, e := range g.Edges {
+		label := strings.Replace(e.Type, "_", " ", -1)
+		switch e.Type {
+		case models.GraphEdgeCard:
+			label = ""
+		case models.GraphEdgeReveals:
+			label = fmt.Sprintf("reveals (%d TU)", e.TUCost)
+		}
+		d.AddEdge(e.From, e.To, e.Type, label)
+	}
+
+	return d.pruneEdges()
+}
@@ -0,0 +1,47 @@
+package diagram
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteDOTEdges(t *testing.T) {
+	tests := []struct {
+		name string
+		edge *Edge
+		line string
+	}{
+		{"unlabelled", &Edge{From: "card_1", To: "card_2", Kind: EdgeUnlocks}, "\tcard_1 -> card_2;"},
+		{"labelled", &Edge{From: "card_1", To: "card_2", Kind: EdgeUnlocks, Label: "key"}, "\tcard_1 -> card_2 [label=\"key\"];"},
+		{"card", &Edge{From: "location_1", To: "card_1", Kind: EdgeCard}, "\tlocation_1 -> card_1 [style=dashed];"},
+		{"labelled card", &Edge{From: "location_1", To: "card_1", Kind: EdgeCard, Label: "A"}, "\tlocation_1 -> card_1 [label=\"A\", style=dashed];"},
+	}
+
+	for _, tt := range tests {
+		d := &Diagram{Edges: []*Edge{tt.edge}}
+		var buf bytes.Buffer
+		err := d.WriteDOT(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(buf.String(), "\n")
+		if len(lines) < 2 || lines[1] != tt.line {
+			t.Errorf("%s: got %q, expected %q", tt.name, buf.String(), tt.line)
+		}
+	}
+}
+
+func TestPruneEdges(t *testing.T) {
+	d := &Diagram{}
+	d.AddNode(NodeCard, 1, "Hall")
+	d.AddNode(NodeCard, 2, "Cellar")
+	d.AddEdge(NodeID(NodeCard, 1), NodeID(NodeCard, 2), EdgeUnlocks, "key")
+	d.AddEdge(NodeID(NodeCard, 1), NodeID(NodeStat, 3), EdgeSkillTest, "skill test")
+	d.AddEdge(NodeID(NodeLocation, 4), NodeID(NodeCard, 2), EdgeCard, "")
+
+	d.pruneEdges()
+	if len(d.Edges) != 1 || d.Edges[0].Kind != EdgeUnlocks {
+		t.Errorf("got edges %+v, expected the unlocks edge only", d.Edges)
+	}
+}
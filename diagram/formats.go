@@ -0,0 +1,176 @@
+package diagram
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Node shapes, by kind. Kinds without a shape use the default one of the format.
+var dotShapes = map[string]string{
+	NodeLocation:    "box",
+	NodeCard:        "ellipse",
+	NodeElement:     "note",
+	NodeStateToken:  "circle",
+	NodeStat:        "diamond",
+	NodeCombination: "invtriangle",
+}
+
+// Mermaid node shapes are brackets around the label.
+var mermaidShapes = map[string][2]string{
+	NodeLocation:    {"[", "]"},
+	NodeCard:        {"(", ")"},
+	NodeElement:     {">", "]"},
+	NodeStateToken:  {"((", "))"},
+	NodeStat:        {"{{", "}}"},
+	NodeCombination: {"[/", "\\]"},
+}
+
+// Write the diagram as a Graphviz DOT digraph.
+// Edges from locations to their cards are dashed.
+func (d *Diagram) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph scenario {")
+	for _, n := range d.Nodes {
+		attrs := fmt.Sprintf("label=%s", dotQuote(n.Label))
+		if shape, ok := dotShapes[n.Kind]; ok {
+			attrs += ", shape=" + shape
+		}
+		fmt.Fprintf(bw, "\t%s [%s];\n", n.ID, attrs)
+	}
+	for _, e := range d.Edges {
+		var attrs []string
+		if e.Label != "" {
+			attrs = append(attrs, fmt.Sprintf("label=%s", dotQuote(e.Label)))
+		}
+		if e.Kind == EdgeCard {
+			attrs = append(attrs, "style=dashed")
+		}
+		attr := ""
+		if len(attrs) > 0 {
+			attr = " [" + strings.Join(attrs, ", ") + "]"
+		}
+		fmt.Fprintf(bw, "\t%s -> %s%s;\n", e.From, e.To, attr)
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
+
+// Write the diagram as a GraphML document, with the kind and label of nodes and edges as data.
+func (d *Diagram) WriteGraphML(w io.Writer) error {
+	type data struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+	type node struct {
+		ID   string `xml:"id,attr"`
+		Data []data `xml:"data"`
+	}
+	type edge struct {
+		ID     string `xml:"id,attr"`
+		Source string `xml:"source,attr"`
+		Target string `xml:"target,attr"`
+		Data   []data `xml:"data"`
+	}
+	type key struct {
+		ID       string `xml:"id,attr"`
+		For      string `xml:"for,attr"`
+		AttrName string `xml:"attr.name,attr"`
+		AttrType string `xml:"attr.type,attr"`
+	}
+	type graph struct {
+		ID          string `xml:"id,attr"`
+		EdgeDefault string `xml:"edgedefault,attr"`
+		Nodes       []node `xml:"node"`
+		Edges       []edge `xml:"edge"`
+	}
+	type graphml struct {
+		XMLName xml.Name `xml:"graphml"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Keys    []key    `xml:"key"`
+		Graph   graph    `xml:"graph"`
+	}
+
+	doc := graphml{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []key{
+			{ID: "node_kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{ID: "node_label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "edge_kind", For: "edge", AttrName: "kind", AttrType: "string"},
+			{ID: "edge_label", For: "edge", AttrName: "label", AttrType: "string"},
+		},
+		Graph: graph{ID: "scenario", EdgeDefault: "directed"},
+	}
+	for _, n := range d.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node{
+			ID:   n.ID,
+			Data: []data{{"node_kind", n.Kind}, {"node_label", n.Label}},
+		})
+	}
+	for i, e := range d.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, edge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: e.From,
+			Target: e.To,
+			Data:   []data{{"edge_kind", e.Kind}, {"edge_label", e.Label}},
+		})
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// Write the diagram as a Mermaid flowchart.
+// Edges from locations to their cards are dotted.
+func (d *Diagram) WriteMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "flowchart LR")
+	for _, n := range d.Nodes {
+		shape, ok := mermaidShapes[n.Kind]
+		if !ok {
+			shape = [2]string{"[", "]"}
+		}
+		fmt.Fprintf(bw, "    %s%s%s%s\n", n.ID, shape[0], mermaidQuote(n.Label), shape[1])
+	}
+	for _, e := range d.Edges {
+		arrow := "-->"
+		if e.Kind == EdgeCard {
+			arrow = "-.->"
+		}
+		if e.Label != "" {
+			arrow += "|" + mermaidQuote(e.Label) + "|"
+		}
+		fmt.Fprintf(bw, "    %s %s %s\n", e.From, arrow, e.To)
+	}
+
+	return bw.Flush()
+}
+
+// Mermaid labels are quoted, with quotes and line breaks as entities.
+func mermaidQuote(s string) string {
+	s = strings.Replace(s, `"`, "#quot;", -1)
+	s = strings.Replace(s, "\n", "<br>", -1)
+	return `"` + s + `"`
+}
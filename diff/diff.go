@@ -0,0 +1,158 @@
+package diff
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/archive"
+	"github.com/loopfz/scecret/models"
+)
+
+// Diffs compare two scenario bundles (two scenarios, or two revisions of one scenario)
+// semantically: objects are matched by what identifies them for a designer,
+// e.g. location name and letter for location cards, number for elements,
+// never by database ID. See index for the keys of each type of object.
+
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is an object that was added, removed, or changed between two bundles.
+type Change struct {
+	Type   string         `json:"type"`
+	Key    string         `json:"key"`
+	Action string         `json:"action"`
+	Fields []*FieldChange `json:"fields,omitempty"` // For changed objects
+}
+
+// FieldChange is the before/after value of a changed field.
+// References to other objects are given by their key.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// kind describes how the objects of a table are compared.
+// fields are the compared columns, other than the ones making up the key.
+// refs maps foreign key columns to the table they reference: they are compared by key.
+// formats turns columns holding references in their data into comparable values.
+// Links are identified by what they link: they are added/removed when relinked.
+type kind struct {
+	table   string
+	fields  []string
+	refs    map[string]string
+	formats map[string]func(idx *index, v interface{}) interface{}
+}
+
+// Compared tables, in the order they are reported.
+var kinds = []kind{
+	{table: "location", fields: []string{"hidden", "notes"}},
+	{table: "card", fields: []string{"card_type", "number", "description", "front", "back", "tu_cost"}},
+	{table: "element", fields: []string{"description", "notes"}},
+	{table: "receptacle", fields: []string{"life_points", "ability"}},
+	{table: "mission_success", fields: []string{"condition"}},
+	{table: "codex", fields: []string{"entry"}},
+	{table: "plan", fields: []string{"layout"}},
+	{table: "icon", fields: []string{"url"}},
+	{table: "state_token", fields: []string{"description", "id_icon"}, refs: map[string]string{"id_icon": "icon"}},
+	{table: "stat", fields: []string{"description", "id_icon"}, refs: map[string]string{"id_icon": "icon"}},
+	{table: "location_link", fields: []string{"tu_cost"}},
+	{table: "element_link"},
+	{table: "element_combination"},
+	{table: "element_combination_input"},
+	{table: "state_token_link"},
+	{table: "receptacle_stat", fields: []string{"value"}},
+	{table: "requirement", fields: []string{"expression"}, formats: map[string]func(*index, interface{}) interface{}{
+		"expression": formatRequirement,
+	}},
+	{table: "skill_test", fields: []string{"normal_shields", "skull_shields", "heart_shields", "ut_shields", "special_shields"}},
+	{table: "card_icon", fields: []string{"x", "y", "size_x", "size_y", "annotation", "annotation_type"}},
+}
+
+// Compare two bundles. Changes are listed by type, then by key.
+// The database is only used to name base game objects (icons, state tokens).
+func Compare(db gorp.SqlExecutor, from, to *archive.Bundle) ([]*Change, error) {
+	if db == nil || from == nil || to == nil {
+		return nil, errors.New("Missing parameters to compare scenarios")
+	}
+
+	g, err := loadGlobals(db)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newIndex(from, g)
+	b := newIndex(to, g)
+
+	changes := []*Change{}
+
+	for _, k := range kinds {
+		before, after := a.rows[k.table], b.rows[k.table]
+
+		for _, key := range sortedKeys(before) {
+			row, ok := after[key]
+			if !ok {
+				changes = append(changes, &Change{Type: k.table, Key: key, Action: Removed})
+				continue
+			}
+			fields := k.compare(a, before[key], b, row)
+			if len(fields) > 0 {
+				changes = append(changes, &Change{Type: k.table, Key: key, Action: Changed, Fields: fields})
+			}
+		}
+
+		for _, key := range sortedKeys(after) {
+			if _, ok := before[key]; !ok {
+				changes = append(changes, &Change{Type: k.table, Key: key, Action: Added})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+func (k kind) compare(a *index, rowA interface{}, b *index, rowB interface{}) []*FieldChange {
+	colsA, colsB := models.Columns(rowA), models.Columns(rowB)
+
+	var fields []*FieldChange
+	for _, f := range k.fields {
+		var va, vb interface{}
+		if ref, ok := k.refs[f]; ok {
+			va, vb = a.key(ref, colsA[f].Int()), b.key(ref, colsB[f].Int())
+		} else if format, ok := k.formats[f]; ok {
+			va, vb = format(a, colsA[f].Interface()), format(b, colsB[f].Interface())
+		} else {
+			va, vb = colsA[f].Interface(), colsB[f].Interface()
+		}
+		if !reflect.DeepEqual(va, vb) {
+			fields = append(fields, &FieldChange{Field: f, Before: va, After: vb})
+		}
+	}
+	return fields
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Requirement expressions are compared in their readable form, naming tokens and elements by key.
+func formatRequirement(idx *index, v interface{}) interface{} {
+	e := v.(*models.RequirementExpr)
+	if e == nil {
+		return nil
+	}
+	return e.Format(
+		func(ID int64) string { return idx.key("state_token", ID) },
+		func(ID int64) string { return idx.key("element", ID) },
+	)
+}
@@ -0,0 +1,92 @@
+package diff
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/loopfz/scecret/archive"
+	"github.com/loopfz/scecret/db/initdb"
+	"github.com/loopfz/scecret/models"
+)
+
+// A scenario with a location of two cards, one of them giving an element.
+func testBundle() *archive.Bundle {
+	b := &archive.Bundle{Rows: map[string][]interface{}{
+		"location": {&models.Location{ID: 1, Name: "Asylum"}},
+		"card": {
+			&models.Card{ID: 10, CardType: models.CardTypeLocation, Description: "Hall"},
+			&models.Card{ID: 11, CardType: models.CardTypeLocation, Description: "Cellar"},
+			&models.Card{ID: 12, CardType: models.CardTypeElement},
+		},
+		"location_card": {
+			&models.LocationCard{ID: 20, IDLocation: 1, IDCard: 10, Letter: "A"},
+			&models.LocationCard{ID: 21, IDLocation: 1, IDCard: 11, Letter: "B"},
+		},
+		"element":      {&models.Element{ID: 30, IDCard: 12, Number: 7}},
+		"element_link": {&models.ElementLink{ID: 40, IDCard: 11, IDElement: 30, GivesUses: true}},
+	}}
+	return b
+}
+
+func TestCompare(t *testing.T) {
+	db, err := initdb.InitSqliteRandom()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(b *archive.Bundle)
+		changes []string // "<action> <type> <key> <fields>"
+	}{
+		{"identical", func(b *archive.Bundle) {}, nil},
+		{"IDs are ignored", func(b *archive.Bundle) {
+			// Same objects, created in another scenario
+			for _, row := range b.Rows["location"] {
+				row.(*models.Location).ID = 100
+			}
+			for _, row := range b.Rows["location_card"] {
+				row.(*models.LocationCard).IDLocation = 100
+			}
+		}, nil},
+		{"changed description", func(b *archive.Bundle) {
+			b.Rows["card"][0].(*models.Card).Description = "Great hall"
+		}, []string{"changed card Asylum A [description]"}},
+		{"changed card type", func(b *archive.Bundle) {
+			b.Rows["card"][1].(*models.Card).CardType = models.CardTypeCodex
+		}, []string{"changed card Asylum B [card_type]"}},
+		{"added location", func(b *archive.Bundle) {
+			b.Rows["location"] = append(b.Rows["location"], &models.Location{ID: 2, Name: "Library"})
+		}, []string{"added location Library []"}},
+		{"relinked element", func(b *archive.Bundle) {
+			b.Rows["element_link"][0].(*models.ElementLink).IDCard = 10
+		}, []string{"removed element_link Asylum B gives element 7 []", "added element_link Asylum A gives element 7 []"}},
+		{"duplicate letters", func(b *archive.Bundle) {
+			b.Rows["card"] = append(b.Rows["card"], &models.Card{ID: 13, CardType: models.CardTypeLocation})
+			b.Rows["location_card"] = append(b.Rows["location_card"], &models.LocationCard{ID: 22, IDLocation: 1, IDCard: 13, Letter: "A"})
+		}, []string{"added card Asylum A (2) []"}},
+	}
+
+	for _, tt := range tests {
+		to := testBundle()
+		tt.edit(to)
+
+		changes, err := Compare(db, testBundle(), to)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		var got []string
+		for _, c := range changes {
+			var fields []string
+			for _, f := range c.Fields {
+				fields = append(fields, f.Field)
+			}
+			got = append(got, fmt.Sprintf("%s %s %s %v", c.Action, c.Type, c.Key, fields))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.changes) {
+			t.Errorf("%s: got changes %q, want %q", tt.name, got, tt.changes)
+		}
+	}
+}
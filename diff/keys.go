@@ -0,0 +1,269 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/archive"
+	"github.com/loopfz/scecret/models"
+)
+
+// Keys of the objects, by type:
+//   - location: its name
+//   - card: location name and letter ("Asylum A") for location cards,
+//     element number ("element 12") for element cards, receptacle name ("receptacle Nina")
+//     for receptacle cards, "mission success", "codex <number>" and "plan <location>" for the
+//     other card types, otherwise card number or description
+//   - element: "element <number>", receptacle: its name
+//   - mission success, codex, plan, requirement: the key of their card
+//   - icon, state token: short name, stat: name
+//   - element combination: "combination into <output element key>"
+//   - links, combination inputs, skill tests and card icons: the keys of the objects they relate
+//     (e.g. "Asylum A: strength" for a skill test)
+// Objects with the same key are told apart by a counter, in ID order: "Asylum A (2)".
+
+// globals names the base game objects shared by all scenarios.
+type globals struct {
+	icons  map[int64]string
+	tokens map[int64]string
+}
+
+func loadGlobals(db gorp.SqlExecutor) (*globals, error) {
+	g := &globals{
+		icons:  make(map[int64]string),
+		tokens: make(map[int64]string),
+	}
+
+	icons, err := models.ListIcons(db, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, ico := range icons {
+		if ico.IDScenario == nil {
+			g.icons[ico.ID] = ico.ShortName
+		}
+	}
+
+	tokens, err := models.ListStateTokens(db, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, tk := range tokens {
+		if tk.IDScenario == nil {
+			g.tokens[tk.ID] = tk.ShortName
+		}
+	}
+
+	return g, nil
+}
+
+// index holds the objects of a bundle by key, and the key of each object by ID.
+type index struct {
+	g    *globals
+	keys map[string]map[int64]string       // Table -> ID -> key
+	rows map[string]map[string]interface{} // Table -> key -> row
+}
+
+func newIndex(b *archive.Bundle, g *globals) *index {
+	idx := &index{
+		g:    g,
+		keys: make(map[string]map[int64]string),
+		rows: make(map[string]map[string]interface{}),
+	}
+
+	for _, row := range rowsByID(b, "location") {
+		loc := row.(*models.Location)
+		idx.set("location", loc.ID, loc.Name, row)
+	}
+	for _, row := range rowsByID(b, "icon") {
+		ico := row.(*models.Icon)
+		idx.set("icon", ico.ID, ico.ShortName, row)
+	}
+	for _, row := range rowsByID(b, "state_token") {
+		tk := row.(*models.StateToken)
+		idx.set("state_token", tk.ID, tk.ShortName, row)
+	}
+	for _, row := range rowsByID(b, "stat") {
+		st := row.(*models.Stat)
+		idx.set("stat", st.ID, st.Name, row)
+	}
+	for _, row := range rowsByID(b, "element") {
+		e := row.(*models.Element)
+		idx.set("element", e.ID, fmt.Sprintf("element %d", e.Number), row)
+	}
+	for _, row := range rowsByID(b, "receptacle") {
+		r := row.(*models.Receptacle)
+		idx.set("receptacle", r.ID, r.Name, row)
+	}
+
+	// Card keys come from their location card or element
+	cards := make(map[int64]interface{})
+	for _, row := range rowsByID(b, "card") {
+		cards[row.(*models.Card).ID] = row
+	}
+	for _, row := range rowsByID(b, "location_card") {
+		lc := row.(*models.LocationCard)
+		c, ok := cards[lc.IDCard]
+		if !ok {
+			continue
+		}
+		idx.set("card", lc.IDCard, idx.key("location", lc.IDLocation)+" "+lc.Letter, c)
+		delete(cards, lc.IDCard)
+	}
+	for _, row := range rowsByID(b, "element") {
+		e := row.(*models.Element)
+		c, ok := cards[e.IDCard]
+		if !ok {
+			continue
+		}
+		idx.set("card", e.IDCard, idx.key("element", e.ID), c)
+		delete(cards, e.IDCard)
+	}
+	for _, row := range rowsByID(b, "receptacle") {
+		r := row.(*models.Receptacle)
+		c, ok := cards[r.IDCard]
+		if !ok {
+			continue
+		}
+		idx.set("card", r.IDCard, "receptacle "+idx.key("receptacle", r.ID), c)
+		delete(cards, r.IDCard)
+	}
+	for _, row := range rowsByID(b, "mission_success") {
+		ms := row.(*models.MissionSuccess)
+		if c, ok := cards[ms.IDCard]; ok {
+			idx.set("card", ms.IDCard, "mission success", c)
+			delete(cards, ms.IDCard)
+		}
+		idx.set("mission_success", ms.ID, idx.key("card", ms.IDCard), row)
+	}
+	for _, row := range rowsByID(b, "codex") {
+		cx := row.(*models.Codex)
+		if c, ok := cards[cx.IDCard]; ok {
+			idx.set("card", cx.IDCard, fmt.Sprintf("codex %d", cx.Number), c)
+			delete(cards, cx.IDCard)
+		}
+		idx.set("codex", cx.ID, idx.key("card", cx.IDCard), row)
+	}
+	for _, row := range rowsByID(b, "plan") {
+		p := row.(*models.Plan)
+		if c, ok := cards[p.IDCard]; ok {
+			idx.set("card", p.IDCard, "plan "+idx.key("location", p.IDLocation), c)
+			delete(cards, p.IDCard)
+		}
+		idx.set("plan", p.ID, idx.key("card", p.IDCard), row)
+	}
+	for _, row := range rowsByID(b, "card") {
+		c := row.(*models.Card)
+		if _, ok := cards[c.ID]; !ok {
+			continue
+		}
+		if c.Number != 0 {
+			idx.set("card", c.ID, fmt.Sprintf("card %d", c.Number), row)
+		} else {
+			idx.set("card", c.ID, fmt.Sprintf("card %q", c.Description), row)
+		}
+	}
+
+	for _, row := range rowsByID(b, "location_link") {
+		ll := row.(*models.LocationLink)
+		idx.set("location_link", ll.ID,
+			fmt.Sprintf("%s reveals %s", idx.key("card", ll.IDCard), idx.key("location", ll.IDLocation)), row)
+	}
+	for _, row := range rowsByID(b, "element_link") {
+		el := row.(*models.ElementLink)
+		verb := "uses"
+		if el.GivesUses {
+			verb = "gives"
+		}
+		idx.set("element_link", el.ID,
+			fmt.Sprintf("%s %s %s", idx.key("card", el.IDCard), verb, idx.key("element", el.IDElement)), row)
+	}
+	for _, row := range rowsByID(b, "element_combination") {
+		ec := row.(*models.ElementCombination)
+		idx.set("element_combination", ec.ID,
+			fmt.Sprintf("combination into %s", idx.key("element", ec.IDElement)), row)
+	}
+	for _, row := range rowsByID(b, "element_combination_input") {
+		eci := row.(*models.ElementCombinationInput)
+		idx.set("element_combination_input", eci.ID,
+			fmt.Sprintf("%s: %s", idx.key("element_combination", eci.IDCombination), idx.key("element", eci.IDElement)), row)
+	}
+	for _, row := range rowsByID(b, "state_token_link") {
+		tl := row.(*models.StateTokenLink)
+		verb := "is unlocked by"
+		if tl.UnlocksUnlocked {
+			verb = "unlocks"
+		}
+		idx.set("state_token_link", tl.ID,
+			fmt.Sprintf("%s %s %s", idx.key("card", tl.IDCard), verb, idx.key("state_token", tl.IDStateToken)), row)
+	}
+	for _, row := range rowsByID(b, "requirement") {
+		r := row.(*models.Requirement)
+		idx.set("requirement", r.ID, idx.key("card", r.IDCard), row)
+	}
+	for _, row := range rowsByID(b, "skill_test") {
+		st := row.(*models.SkillTest)
+		idx.set("skill_test", st.ID,
+			fmt.Sprintf("%s: %s", idx.key("card", st.IDCard), idx.key("stat", st.IDStat)), row)
+	}
+	for _, row := range rowsByID(b, "receptacle_stat") {
+		rs := row.(*models.ReceptacleStat)
+		idx.set("receptacle_stat", rs.ID,
+			fmt.Sprintf("%s: %s", idx.key("receptacle", rs.IDReceptacle), idx.key("stat", rs.IDStat)), row)
+	}
+	for _, row := range rowsByID(b, "card_icon") {
+		ci := row.(*models.CardIcon)
+		face := "back"
+		if ci.FrontBack {
+			face = "front"
+		}
+		idx.set("card_icon", ci.ID,
+			fmt.Sprintf("%s %s: %s", idx.key("card", ci.IDCard), face, idx.key("icon", ci.IDIcon)), row)
+	}
+
+	return idx
+}
+
+// Register an object under a key, made unique with a counter if needed.
+func (idx *index) set(table string, ID int64, key string, row interface{}) {
+	if idx.keys[table] == nil {
+		idx.keys[table] = make(map[int64]string)
+		idx.rows[table] = make(map[string]interface{})
+	}
+
+	k := key
+	for n := 2; idx.rows[table][k] != nil; n++ {
+		k = fmt.Sprintf("%s (%d)", key, n)
+	}
+
+	idx.keys[table][ID] = k
+	idx.rows[table][k] = row
+}
+
+// Key of an object by ID. Base game objects are named by the globals.
+func (idx *index) key(table string, ID int64) string {
+	if k, ok := idx.keys[table][ID]; ok {
+		return k
+	}
+	switch table {
+	case "icon":
+		if k, ok := idx.g.icons[ID]; ok {
+			return k
+		}
+	case "state_token":
+		if k, ok := idx.g.tokens[ID]; ok {
+			return k
+		}
+	}
+	return fmt.Sprintf("%s #%d", table, ID)
+}
+
+// Rows of a table sorted by ID, so that counters of duplicate keys follow creation order.
+func rowsByID(b *archive.Bundle, table string) []interface{} {
+	rows := append([]interface{}{}, b.Rows[table]...)
+	sort.Slice(rows, func(i, j int) bool {
+		return models.Columns(rows[i])["id"].Int() < models.Columns(rows[j])["id"].Int()
+	})
+	return rows
+}
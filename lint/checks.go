@@ -0,0 +1,151 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+)
+
+func checkOrphanElements(s *scenarioData) []*Warning {
+	given := make(map[int64]bool)
+	for _, el := range s.elemLinks {
+		if el.GivesUses {
+			given[el.IDElement] = true
+		}
+	}
+	for _, ec := range s.elemCombs {
+		given[ec.IDElement] = true
+	}
+
+	var ret []*Warning
+	for _, e := range s.elements {
+		if !given[e.ID] {
+			ret = append(ret, &Warning{
+				Message: fmt.Sprintf("Element %d (%s) is not given by any card nor combination", e.Number, e.Description),
+				Objects: []*Object{{Type: ObjectElement, ID: e.ID}},
+			})
+		}
+	}
+	return ret
+}
+
+func checkUnusedStats(s *scenarioData) []*Warning {
+	used := make(map[int64]bool)
+	for _, st := range s.skillTests {
+		used[st.IDStat] = true
+	}
+
+	var ret []*Warning
+	for _, st := range s.stats {
+		if !used[st.ID] {
+			ret = append(ret, &Warning{
+				Message: fmt.Sprintf("Stat %s is not used in any skill test", st.Name),
+				Objects: []*Object{{Type: ObjectStat, ID: st.ID}},
+			})
+		}
+	}
+	return ret
+}
+
+func checkLocationsWithoutA(s *scenarioData) []*Warning {
+	var ret []*Warning
+	for _, loc := range s.locations {
+		hasA := false
+		for _, lc := range s.locCards[loc.ID] {
+			if lc.Letter == "A" {
+				hasA = true
+			}
+		}
+		if !hasA {
+			ret = append(ret, &Warning{
+				Message: fmt.Sprintf("Location %s has no \"A\" card", loc.Name),
+				Objects: []*Object{{Type: ObjectLocation, ID: loc.ID}},
+			})
+		}
+	}
+	return ret
+}
+
+// Cards without a number (0) are ignored.
+func checkDuplicateCardNumbers(s *scenarioData) []*Warning {
+	byNumber := make(map[uint][]int64)
+	for _, c := range s.cards {
+		if c.Number != 0 {
+			byNumber[c.Number] = append(byNumber[c.Number], c.ID)
+		}
+	}
+
+	numbers := make([]uint, 0, len(byNumber))
+	for n := range byNumber {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	var ret []*Warning
+	for _, n := range numbers {
+		IDs := byNumber[n]
+		if len(IDs) < 2 {
+			continue
+		}
+		w := &Warning{
+			Message: fmt.Sprintf("%d cards have number %d", len(IDs), n),
+		}
+		for _, ID := range IDs {
+			w.Objects = append(w.Objects, &Object{Type: ObjectCard, ID: ID})
+		}
+		ret = append(ret, w)
+	}
+	return ret
+}
+
+func checkOverlappingIcons(s *scenarioData) []*Warning {
+	var ret []*Warning
+	for i, a := range s.cardIcons {
+		for _, b := range s.cardIcons[i+1:] {
+			if a.IDCard != b.IDCard || a.FrontBack != b.FrontBack {
+				continue
+			}
+			if a.X < b.X+b.SizeX && b.X < a.X+a.SizeX && a.Y < b.Y+b.SizeY && b.Y < a.Y+a.SizeY {
+				face := "back"
+				if a.FrontBack {
+					face = "front"
+				}
+				ret = append(ret, &Warning{
+					Message: fmt.Sprintf("Icons overlap on the %s of a card", face),
+					Objects: []*Object{
+						{Type: ObjectCard, ID: a.IDCard},
+						{Type: ObjectCardIcon, ID: a.ID},
+						{Type: ObjectCardIcon, ID: b.ID},
+					},
+				})
+			}
+		}
+	}
+	return ret
+}
+
+func checkZeroShieldSkillTests(s *scenarioData) []*Warning {
+	var ret []*Warning
+	for _, st := range s.skillTests {
+		if st.NormalShields+st.SkullShields+st.HeartShields+st.UTShields+st.SpecialShields == 0 {
+			ret = append(ret, &Warning{
+				Message: "Skill test has no shield",
+				Objects: []*Object{
+					{Type: ObjectSkillTest, ID: st.ID},
+					{Type: ObjectCard, ID: st.IDCard},
+				},
+			})
+		}
+	}
+	return ret
+}
+
+func checkUnmeetableRequirements(s *scenarioData) []*Warning {
+	var ret []*Warning
+	for _, r := range s.unmeetable {
+		ret = append(ret, &Warning{
+			Message: "Requirement of a card can never be met with the state tokens and elements of the scenario",
+			Objects: []*Object{{Type: ObjectCard, ID: r.IDCard}},
+		})
+	}
+	return ret
+}
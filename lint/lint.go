@@ -0,0 +1,199 @@
+package lint
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+)
+
+// Types of the objects referenced by warnings.
+const (
+	ObjectCard      = "card"
+	ObjectCardIcon  = "card_icon"
+	ObjectElement   = "element"
+	ObjectLocation  = "location"
+	ObjectSkillTest = "skill_test"
+	ObjectStat      = "stat"
+)
+
+// Warning is a potential design issue in a scenario, found by a check.
+type Warning struct {
+	Check   string    `json:"check"`
+	Message string    `json:"message"`
+	Objects []*Object `json:"objects"`
+}
+
+// Object identifies a scenario object involved in a warning.
+type Object struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+}
+
+// Check is a named verification run against a scenario.
+type Check struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	run         func(s *scenarioData) []*Warning
+}
+
+// All the available checks, in the order they are run.
+var Checks = []*Check{
+	{
+		Name:        "orphan_element",
+		Description: "Elements that are not given by any card nor combination",
+		run:         checkOrphanElements,
+	},
+	{
+		Name:        "unused_stat",
+		Description: "Stats that are not used in any skill test",
+		run:         checkUnusedStats,
+	},
+	{
+		Name:        "location_without_a",
+		Description: "Locations that have no \"A\" card",
+		run:         checkLocationsWithoutA,
+	},
+	{
+		Name:        "duplicate_card_number",
+		Description: "Cards sharing the same number",
+		run:         checkDuplicateCardNumbers,
+	},
+	{
+		Name:        "overlapping_icons",
+		Description: "Icons overlapping on the same card face",
+		run:         checkOverlappingIcons,
+	},
+	{
+		Name:        "zero_shield_skill_test",
+		Description: "Skill tests without any shield",
+		run:         checkZeroShieldSkillTests,
+	},
+	{
+		Name:        "unmeetable_requirement",
+		Description: "Card requirements needing state tokens or elements that cannot be obtained",
+		run:         checkUnmeetableRequirements,
+	},
+}
+
+// Run checks against a scenario. If no check names are given, all checks are run.
+func Run(db gorp.SqlExecutor, scenar *models.Scenario, names ...string) ([]*Warning, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to lint scenario")
+	}
+
+	checks, err := selectChecks(names)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := loadScenarioData(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := []*Warning{}
+	for _, c := range checks {
+		for _, w := range c.run(s) {
+			w.Check = c.Name
+			warnings = append(warnings, w)
+		}
+	}
+
+	return warnings, nil
+}
+
+func selectChecks(names []string) ([]*Check, error) {
+	if len(names) == 0 {
+		return Checks, nil
+	}
+
+	var ret []*Check
+	for _, n := range names {
+		c := CheckByName(n)
+		if c == nil {
+			return nil, fmt.Errorf("Unknown check: %s", n)
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+// Find a check by name. Returns nil if there is none.
+func CheckByName(name string) *Check {
+	for _, c := range Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// scenarioData holds all the objects of a scenario needed by the checks,
+// loaded once before running them.
+type scenarioData struct {
+	cards      []*models.Card
+	cardIcons  []*models.CardIcon
+	elements   []*models.Element
+	elemLinks  []*models.ElementLink
+	elemCombs  []*models.ElementCombination
+	locations  []*models.Location
+	locCards   map[int64][]*models.LocationCard // By location ID
+	stats      []*models.Stat
+	skillTests []*models.SkillTest
+	unmeetable []*models.Requirement
+}
+
+func loadScenarioData(db gorp.SqlExecutor, scenar *models.Scenario) (*scenarioData, error) {
+	var err error
+
+	s := &scenarioData{
+		locCards: make(map[int64][]*models.LocationCard),
+	}
+
+	s.cards, err = models.ListCards(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	s.cardIcons, err = models.ListScenarioCardIcons(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	s.elements, err = models.ListElements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	s.elemLinks, err = models.ListElementLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.elemCombs, err = models.ListElementCombinations(db, scenar, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.locations, err = models.ListLocations(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, loc := range s.locations {
+		s.locCards[loc.ID], err = loc.ListLocationCards(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.stats, err = models.ListStats(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	s.skillTests, err = models.ListSkillTests(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.unmeetable, err = models.ListUnmeetableRequirements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
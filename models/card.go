@@ -22,6 +22,16 @@ const (
 
 	AnnotationTypeSquare = 1
 	AnnotationTypeCircle = 2
+
+	DEFAULT_CARD_TU_COST = 1 // Visiting a location card takes one Time Unit
+
+	// Card types, by the object the card backs
+	CardTypeLocation       = "location"
+	CardTypeElement        = "element"
+	CardTypeReceptacle     = "receptacle"
+	CardTypeMissionSuccess = "mission_success"
+	CardTypeCodex          = "codex"
+	CardTypePlan           = "plan"
 )
 
 /*
@@ -33,10 +43,12 @@ const (
 type Card struct {
 	ID          int64     `json:"id" db:"id"`
 	IDScenario  int64     `json:"-" db:"id_scenario"`
+	CardType    string    `json:"card_type" db:"card_type"` // Type of the object backed by the card
 	Number      uint      `json:"number" db:"number"`
 	Description string    `json:"description" db:"description"`
 	Front       *CardFace `json:"front" db:"front"`
 	Back        *CardFace `json:"back" db:"back"`
+	TUCost      uint      `json:"tu_cost" db:"tu_cost"` // Time Units spent on the card (action, one round of skill tests)
 }
 
 // CardFace describes the Front or Back non-image components of a card.
@@ -59,9 +71,9 @@ type TextField struct {
 // It is linked to a Card, and to a collection of Icon graphical elements.
 // It has coordinates/size properties, and optional annotations (small circle or square) to add
 // e.g. a Stat value for a character or a number above a Shield.
-// It also has foreign keys to the SkillTest/StateTokenLink that it originated from,
-// so that it can be retrieved for update when the SkillTest/StateTokenLink is updated, and can
-// be automatically deleted through CASCADE.
+// It also has foreign keys to the SkillTest/StateTokenLink/ReceptacleStat/Requirement that it originated from,
+// so that it can be retrieved for update when the SkillTest/StateTokenLink/ReceptacleStat/Requirement is updated,
+// and can be automatically deleted through CASCADE.
 type CardIcon struct {
 	ID               int64  `json:"id" db:"id"`
 	IDCard           int64  `json:"id_card" db:"id_card"`
@@ -75,24 +87,28 @@ type CardIcon struct {
 	AnnotationType   int    `json:"annotation_type" db:"annotation_type"`
 	IDSkillTest      *int64 `json:"-" db:"id_skilltest"`
 	IDStateTokenLink *int64 `json:"-" db:"id_statetokenlink"`
+	IDReceptacleStat *int64 `json:"-" db:"id_receptaclestat"`
+	IDRequirement    *int64 `json:"-" db:"id_requirement"`
 }
 
 /*
 ** BASE CARD
  */
 
-// Create a card.
-func CreateCard(db *gorp.DbMap, scenar *Scenario, num uint, desc string, front *CardFace, back *CardFace) (*Card, error) {
+// Create a card, backing an object of type CardType.
+func CreateCard(db gorp.SqlExecutor, scenar *Scenario, CardType string, num uint, desc string, front *CardFace, back *CardFace, TUCost uint) (*Card, error) {
 	if db == nil || scenar == nil {
 		return nil, errors.New("Missing parameters to create card")
 	}
 
 	c := &Card{
 		IDScenario:  scenar.ID,
+		CardType:    CardType,
 		Number:      num,
 		Description: desc,
 		Front:       front,
 		Back:        back,
+		TUCost:      TUCost,
 	}
 
 	err := db.Insert(c)
@@ -103,7 +119,7 @@ func CreateCard(db *gorp.DbMap, scenar *Scenario, num uint, desc string, front *
 }
 
 // Load a card by ID. Optionally filtered by scenario.
-func LoadCardFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Card, error) {
+func LoadCardFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Card, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load card")
 	}
@@ -131,7 +147,7 @@ func LoadCardFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Card, error) {
 }
 
 // List a scenario's cards.
-func ListCards(db *gorp.DbMap, scenar *Scenario) ([]*Card, error) {
+func ListCards(db gorp.SqlExecutor, scenar *Scenario) ([]*Card, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list cards")
 	}
@@ -160,7 +176,7 @@ func ListCards(db *gorp.DbMap, scenar *Scenario) ([]*Card, error) {
 }
 
 // Update a card.
-func (c *Card) Update(db *gorp.DbMap, num uint, desc string, front *CardFace, back *CardFace) error {
+func (c *Card) Update(db gorp.SqlExecutor, num uint, desc string, front *CardFace, back *CardFace, TUCost uint) error {
 	if db == nil {
 		return errors.New("Missing db parameter to update card")
 	}
@@ -169,6 +185,7 @@ func (c *Card) Update(db *gorp.DbMap, num uint, desc string, front *CardFace, ba
 	c.Description = desc
 	c.Front = front
 	c.Back = back
+	c.TUCost = TUCost
 
 	rows, err := db.Update(c)
 	if err != nil {
@@ -181,7 +198,7 @@ func (c *Card) Update(db *gorp.DbMap, num uint, desc string, front *CardFace, ba
 }
 
 // Delete a card.
-func (c *Card) Delete(db *gorp.DbMap) error {
+func (c *Card) Delete(db gorp.SqlExecutor) error {
 	rows, err := db.Delete(c)
 	if err != nil {
 		return err
@@ -197,10 +214,10 @@ func (c *Card) Delete(db *gorp.DbMap) error {
  */
 
 // Create a CardIcon object.
-func (c *Card) CreateCardIcon(db *gorp.DbMap, ico *Icon,
+func (c *Card) CreateCardIcon(db gorp.SqlExecutor, ico *Icon,
 	FrontBack bool, X, Y, SizeX, SizeY uint,
 	Annotation string, AnnotationType int,
-	SkillTest *SkillTest, StateTokenLink *StateTokenLink) (*CardIcon, error) {
+	SkillTest *SkillTest, StateTokenLink *StateTokenLink, ReceptacleStat *ReceptacleStat, Requirement *Requirement) (*CardIcon, error) {
 	if db == nil || ico == nil {
 		return nil, errors.New("Missing parameters to create card icon")
 	}
@@ -223,6 +240,12 @@ func (c *Card) CreateCardIcon(db *gorp.DbMap, ico *Icon,
 	if StateTokenLink != nil {
 		ci.IDStateTokenLink = &StateTokenLink.ID
 	}
+	if ReceptacleStat != nil {
+		ci.IDReceptacleStat = &ReceptacleStat.ID
+	}
+	if Requirement != nil {
+		ci.IDRequirement = &Requirement.ID
+	}
 
 	err := ci.Valid()
 	if err != nil {
@@ -238,7 +261,7 @@ func (c *Card) CreateCardIcon(db *gorp.DbMap, ico *Icon,
 }
 
 // List all CardIcon objects linked to this card, with filters.
-func (c *Card) ListCardIcons(db *gorp.DbMap, SkillTest *SkillTest, StateTokenLink *StateTokenLink) ([]*CardIcon, error) {
+func (c *Card) ListCardIcons(db gorp.SqlExecutor, SkillTest *SkillTest, StateTokenLink *StateTokenLink, ReceptacleStat *ReceptacleStat, Requirement *Requirement) ([]*CardIcon, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load card icons")
 	}
@@ -253,6 +276,12 @@ func (c *Card) ListCardIcons(db *gorp.DbMap, SkillTest *SkillTest, StateTokenLin
 	if StateTokenLink != nil {
 		selector = selector.Where(squirrel.Eq{`id_statetokenlink`: StateTokenLink.ID})
 	}
+	if ReceptacleStat != nil {
+		selector = selector.Where(squirrel.Eq{`id_receptaclestat`: ReceptacleStat.ID})
+	}
+	if Requirement != nil {
+		selector = selector.Where(squirrel.Eq{`id_requirement`: Requirement.ID})
+	}
 
 	query, args, err := selector.ToSql()
 	if err != nil {
@@ -269,8 +298,34 @@ func (c *Card) ListCardIcons(db *gorp.DbMap, SkillTest *SkillTest, StateTokenLin
 	return ci, nil
 }
 
+// List all CardIcon objects of a scenario's cards.
+func ListScenarioCardIcons(db gorp.SqlExecutor, scenar *Scenario) ([]*CardIcon, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to list card icons")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`"card_icon".*`).From(`"card_icon"`).Join(
+		`"card" ON "card".id = "card_icon".id_card`,
+	).Where(
+		squirrel.Eq{`"card".id_scenario`: scenar.ID},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ci []*CardIcon
+
+	_, err = db.Select(&ci, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ci, nil
+}
+
 // Load one CardIcon object linked to this card, by ID.
-func (c *Card) LoadCardIconFromID(db *gorp.DbMap, ID int64) (*CardIcon, error) {
+func (c *Card) LoadCardIconFromID(db gorp.SqlExecutor, ID int64) (*CardIcon, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load card icon")
 	}
@@ -297,7 +352,7 @@ func (c *Card) LoadCardIconFromID(db *gorp.DbMap, ID int64) (*CardIcon, error) {
 }
 
 // Update a CardIcon object.
-func (ci *CardIcon) Update(db *gorp.DbMap, ico *Icon, FrontBack bool,
+func (ci *CardIcon) Update(db gorp.SqlExecutor, ico *Icon, FrontBack bool,
 	X, Y, SizeX, SizeY uint,
 	Annotation string, AnnotationType int) error {
 
@@ -327,12 +382,12 @@ func (ci *CardIcon) Update(db *gorp.DbMap, ico *Icon, FrontBack bool,
 }
 
 // Delete a CardIcon object.
-func (ci *CardIcon) Delete(db *gorp.DbMap) error {
+func (ci *CardIcon) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete card icon")
 	}
 
-	if ci.IDSkillTest != nil || ci.IDStateTokenLink != nil {
+	if ci.IDSkillTest != nil || ci.IDStateTokenLink != nil || ci.IDReceptacleStat != nil || ci.IDRequirement != nil {
 		return errors.New("Cannot delete auto-generated icon")
 	}
 
@@ -364,8 +419,14 @@ func (ci *CardIcon) Valid() error {
 	if ci.AnnotationType != 0 && ci.AnnotationType != AnnotationTypeSquare && ci.AnnotationType != AnnotationTypeCircle {
 		return fmt.Errorf("Unknown annotation type %d", ci.AnnotationType)
 	}
-	if ci.IDSkillTest != nil && ci.IDStateTokenLink != nil {
-		return errors.New("References to both skill_test and state_token_link")
+	refs := 0
+	for _, ref := range []*int64{ci.IDSkillTest, ci.IDStateTokenLink, ci.IDReceptacleStat, ci.IDRequirement} {
+		if ref != nil {
+			refs++
+		}
+	}
+	if refs > 1 {
+		return errors.New("References to several of skill_test, state_token_link, receptacle_stat and requirement")
 	}
 	return nil
 }
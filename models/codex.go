@@ -0,0 +1,183 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+// Codex represents a numbered entry of the scenario's codex,
+// a card the players are told to read by number (e.g. "read codex 3").
+type Codex struct {
+	ID         int64  `json:"id" db:"id"`
+	IDScenario int64  `json:"-" db:"id_scenario"`
+	Number     int    `json:"number" db:"number"`
+	Entry      string `json:"entry" db:"entry"`
+	IDCard     int64  `json:"id_card" db:"id_card"`
+}
+
+// Create a new codex entry.
+func CreateCodex(db gorp.SqlExecutor, scenar *Scenario, Number int, Entry string) (*Codex, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to create codex")
+	}
+
+	card, err := CreateCard(db, scenar, CardTypeCodex, 0, codexCardDesc(Number), &CardFace{}, &CardFace{}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cx := &Codex{
+		IDScenario: scenar.ID,
+		Number:     Number,
+		Entry:      Entry,
+		IDCard:     card.ID,
+	}
+
+	err = cx.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Insert(cx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cx, nil
+}
+
+func codexCardDesc(Number int) string {
+	return fmt.Sprintf("Codex %d", Number)
+}
+
+// List codex entries, optionally filtered by scenario.
+func ListCodices(db gorp.SqlExecutor, scenar *Scenario) ([]*Codex, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to list codices")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"codex"`)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.OrderBy(`number`).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var cx []*Codex
+
+	_, err = db.Select(&cx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return cx, nil
+}
+
+// Load codex entry by ID. Optional scenario filter.
+func LoadCodexFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Codex, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load codex")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"codex"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var cx Codex
+
+	err = db.SelectOne(&cx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cx, nil
+}
+
+// Update a codex entry.
+func (cx *Codex) Update(db gorp.SqlExecutor, Number int, Entry string) error {
+	if db == nil {
+		return errors.New("Missing db parameter to update codex")
+	}
+
+	cx.Number = Number
+	cx.Entry = Entry
+
+	err := cx.Valid()
+	if err != nil {
+		return err
+	}
+
+	// Update linked card description
+	card, err := LoadCardFromID(db, nil, cx.IDCard)
+	if err != nil {
+		return err
+	}
+	err = card.Update(db, card.Number, codexCardDesc(Number), card.Front, card.Back, card.TUCost)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Update(cx)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such codex to update")
+	}
+
+	return nil
+}
+
+// Delete a codex entry, and its card.
+func (cx *Codex) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete codex")
+	}
+
+	card, err := LoadCardFromID(db, nil, cx.IDCard)
+	if err != nil {
+		return err
+	}
+	err = card.Delete(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Delete(cx)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such codex to delete")
+	}
+
+	return nil
+}
+
+func (cx *Codex) Valid() error {
+	if cx.Number == 0 {
+		return errors.New("Missing codex number")
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package models
+
+import "reflect"
+
+// Map a model's database columns (db struct tags) to its fields.
+// row must be a pointer to a model struct.
+func Columns(row interface{}) map[string]reflect.Value {
+	ret := make(map[string]reflect.Value)
+
+	v := reflect.ValueOf(row).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		col := f.Tag.Get("db")
+		if col == "" || col == "-" || f.PkgPath != "" {
+			continue
+		}
+		ret[col] = v.Field(i)
+	}
+
+	return ret
+}
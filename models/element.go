@@ -19,13 +19,13 @@ type Element struct {
 }
 
 // Create a new element.
-func CreateElement(db *gorp.DbMap, scenar *Scenario, Number int, Description string) (*Element, error) {
+func CreateElement(db gorp.SqlExecutor, scenar *Scenario, Number int, Description string) (*Element, error) {
 	if db == nil || scenar == nil {
 		return nil, errors.New("Missing parameters to create element")
 	}
 
 	cardDesc := fmt.Sprintf("Element %d", Number)
-	card, err := CreateCard(db, scenar, 0, cardDesc, &CardFace{}, &CardFace{})
+	card, err := CreateCard(db, scenar, CardTypeElement, 0, cardDesc, &CardFace{}, &CardFace{}, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -44,21 +44,21 @@ func CreateElement(db *gorp.DbMap, scenar *Scenario, Number int, Description str
 
 	err = db.Insert(elem)
 	if err != nil {
-		return nil, err // TODO Tx
+		return nil, err
 	}
 
 	return elem, nil
 }
 
 // List elements, optionally filtered by scenario.
-func ListElements(db *gorp.DbMap, scenar *Scenario) ([]*Element, error) {
+func ListElements(db gorp.SqlExecutor, scenar *Scenario) ([]*Element, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list elements")
 	}
 
 	selector := sqlgenerator.PGsql.Select(`*`).From(`"element"`)
 
-	if scenar == nil {
+	if scenar != nil {
 		selector = selector.Where(
 			squirrel.Eq{`id_scenario`: scenar.ID},
 		)
@@ -80,7 +80,7 @@ func ListElements(db *gorp.DbMap, scenar *Scenario) ([]*Element, error) {
 }
 
 // Returns all card objects that belong to elements.
-func GetElementCards(db *gorp.DbMap, scenar *Scenario) ([]*Card, error) {
+func GetElementCards(db gorp.SqlExecutor, scenar *Scenario) ([]*Card, error) {
 	if db == nil || scenar == nil {
 		return nil, errors.New("Missing parameters to get element cards")
 	}
@@ -107,7 +107,7 @@ func GetElementCards(db *gorp.DbMap, scenar *Scenario) ([]*Card, error) {
 }
 
 // Load element by ID. Optional scenario filter.
-func LoadElementFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Element, error) {
+func LoadElementFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Element, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list elements")
 	}
@@ -116,7 +116,7 @@ func LoadElementFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Element, er
 		squirrel.Eq{`id`: ID},
 	)
 
-	if scenar == nil {
+	if scenar != nil {
 		selector = selector.Where(
 			squirrel.Eq{`id_scenario`: scenar.ID},
 		)
@@ -138,7 +138,7 @@ func LoadElementFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Element, er
 }
 
 // Update an element.
-func (e *Element) Update(db *gorp.DbMap, Number int, Description string, Notes string) error {
+func (e *Element) Update(db gorp.SqlExecutor, Number int, Description string, Notes string) error {
 	if db == nil {
 		return errors.New("Missing db parameter to update element")
 	}
@@ -153,33 +153,52 @@ func (e *Element) Update(db *gorp.DbMap, Number int, Description string, Notes s
 	if err != nil {
 		return err
 	}
-	err = card.Update(db, card.Number, cardDesc, card.Front, card.Back)
+	err = card.Update(db, card.Number, cardDesc, card.Front, card.Back, card.TUCost)
 	if err != nil {
 		return err
 	}
 
 	err = e.Valid()
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 
 	rows, err := db.Update(e)
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 	if rows == 0 {
-		return errors.New("No such element to update") // TODO Tx
+		return errors.New("No such element to update")
 	}
 
 	return nil
 }
 
-// Delete an element.
-func (e *Element) Delete(db *gorp.DbMap) error {
+// Delete an element, and the combinations it is part of.
+func (e *Element) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete element")
 	}
 
+	reqs, err := listReferencingRequirements(db, &Scenario{ID: e.IDScenario}, RequirementElement, e.ID)
+	if err != nil {
+		return err
+	}
+	if len(reqs) > 0 {
+		return fmt.Errorf("Element %d is referenced by the requirement of %d card(s)", e.Number, len(reqs))
+	}
+
+	combinations, err := ListElementCombinations(db, &Scenario{ID: e.IDScenario}, e)
+	if err != nil {
+		return err
+	}
+	for _, ec := range combinations {
+		err = ec.Delete(db)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Delete card object
 	card, err := LoadCardFromID(db, nil, e.IDCard)
 	if err != nil {
@@ -192,10 +211,10 @@ func (e *Element) Delete(db *gorp.DbMap) error {
 
 	rows, err := db.Delete(e)
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 	if rows == 0 {
-		return errors.New("No such element to delete") // TODO Tx
+		return errors.New("No such element to delete")
 	}
 
 	return nil
@@ -0,0 +1,326 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+// ElementCombination represents elements that players combine into another element,
+// e.g. element 3 plus element 7 gives element 12.
+type ElementCombination struct {
+	ID         int64                      `json:"id" db:"id"`
+	IDScenario int64                      `json:"-" db:"id_scenario"`
+	IDElement  int64                      `json:"id_element" db:"id_element"` // Output
+	Inputs     []*ElementCombinationInput `json:"inputs" db:"-"`              // Filled when loading
+}
+
+// ElementCombinationInput is an element consumed by a combination.
+type ElementCombinationInput struct {
+	ID            int64 `json:"-" db:"id"`
+	IDCombination int64 `json:"-" db:"id_combination"`
+	IDElement     int64 `json:"id_element" db:"id_element"`
+}
+
+// Create a combination of two or more input elements into an output element.
+func CreateElementCombination(db gorp.SqlExecutor, scenar *Scenario, output *Element, inputs []*Element) (*ElementCombination, error) {
+	if db == nil || scenar == nil || output == nil {
+		return nil, errors.New("Missing parameters to create element combination")
+	}
+
+	ec := &ElementCombination{
+		IDScenario: scenar.ID,
+		IDElement:  output.ID,
+	}
+
+	err := ec.check(db, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Insert(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ec.setInputs(db, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec, nil
+}
+
+// Verify the inputs of a combination: at least two distinct elements, other than the output,
+// and the output must not be needed to obtain them through other combinations.
+func (ec *ElementCombination) check(db gorp.SqlExecutor, inputs []*Element) error {
+	err := ec.validInputs(inputs)
+	if err != nil {
+		return err
+	}
+
+	combinations, err := ListElementCombinations(db, &Scenario{ID: ec.IDScenario}, nil)
+	if err != nil {
+		return err
+	}
+
+	return ec.checkCycles(inputs, combinations)
+}
+
+func (ec *ElementCombination) validInputs(inputs []*Element) error {
+	if len(inputs) < 2 {
+		return errors.New("An element combination needs at least two input elements")
+	}
+
+	seen := make(map[int64]bool)
+	for _, in := range inputs {
+		if in.ID == ec.IDElement {
+			return fmt.Errorf("Element %d cannot be combined into itself", in.Number)
+		}
+		if seen[in.ID] {
+			return fmt.Errorf("Duplicate input element %d", in.Number)
+		}
+		seen[in.ID] = true
+	}
+	return nil
+}
+
+// Verify that none of the inputs is obtained by combining the output, among the other combinations.
+func (ec *ElementCombination) checkCycles(inputs []*Element, combinations []*ElementCombination) error {
+	byOutput := make(map[int64][]*ElementCombination)
+	for _, c := range combinations {
+		if c.ID != ec.ID {
+			byOutput[c.IDElement] = append(byOutput[c.IDElement], c)
+		}
+	}
+
+	visited := make(map[int64]bool)
+	var needs func(IDElement int64) bool
+	needs = func(IDElement int64) bool {
+		if IDElement == ec.IDElement {
+			return true
+		}
+		if visited[IDElement] {
+			return false
+		}
+		visited[IDElement] = true
+		for _, c := range byOutput[IDElement] {
+			for _, in := range c.Inputs {
+				if needs(in.IDElement) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, in := range inputs {
+		if needs(in.ID) {
+			return fmt.Errorf("Element %d is obtained by combining the output element (cyclic combination)", in.Number)
+		}
+	}
+
+	return nil
+}
+
+// Create the input rows of a combination.
+func (ec *ElementCombination) setInputs(db gorp.SqlExecutor, inputs []*Element) error {
+
+	// Store inputs in a stable order
+	sort.Slice(inputs, func(i, j int) bool { return inputs[i].ID < inputs[j].ID })
+
+	ec.Inputs = []*ElementCombinationInput{}
+
+	for _, in := range inputs {
+		eci := &ElementCombinationInput{
+			IDCombination: ec.ID,
+			IDElement:     in.ID,
+		}
+		err := db.Insert(eci)
+		if err != nil {
+			return err
+		}
+		ec.Inputs = append(ec.Inputs, eci)
+	}
+
+	return nil
+}
+
+func (ec *ElementCombination) deleteInputs(db gorp.SqlExecutor) error {
+	inputs, err := ec.ListInputs(db)
+	if err != nil {
+		return err
+	}
+	for _, eci := range inputs {
+		_, err := db.Delete(eci)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List the input elements of a combination.
+func (ec *ElementCombination) ListInputs(db gorp.SqlExecutor) ([]*ElementCombinationInput, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to list element combination inputs")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"element_combination_input"`).Where(
+		squirrel.Eq{`id_combination`: ec.ID},
+	).OrderBy(`id_element`).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var eci []*ElementCombinationInput
+
+	_, err = db.Select(&eci, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return eci, nil
+}
+
+// Whether an element is an input of the combination.
+func (ec *ElementCombination) HasInput(IDElement int64) bool {
+	for _, in := range ec.Inputs {
+		if in.IDElement == IDElement {
+			return true
+		}
+	}
+	return false
+}
+
+// List element combinations, with filters. The output element filter also matches
+// combinations using the element as input. Their inputs are filled.
+func ListElementCombinations(db gorp.SqlExecutor, scenar *Scenario, elem *Element) ([]*ElementCombination, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to list element combinations")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"element_combination"`)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var ec []*ElementCombination
+
+	_, err = db.Select(&ec, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*ElementCombination{}
+	for _, c := range ec {
+		c.Inputs, err = c.ListInputs(db)
+		if err != nil {
+			return nil, err
+		}
+		if elem == nil || c.IDElement == elem.ID || c.HasInput(elem.ID) {
+			ret = append(ret, c)
+		}
+	}
+
+	return ret, nil
+}
+
+// Load an element combination by ID, with its inputs. Optional scenario filter.
+func LoadElementCombinationFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*ElementCombination, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load element combination")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"element_combination"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var ec ElementCombination
+
+	err = db.SelectOne(&ec, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ec.Inputs, err = ec.ListInputs(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ec, nil
+}
+
+// Update an element combination. Its inputs are replaced.
+func (ec *ElementCombination) Update(db gorp.SqlExecutor, output *Element, inputs []*Element) error {
+	if db == nil || output == nil {
+		return errors.New("Missing parameters to update element combination")
+	}
+
+	ec.IDElement = output.ID
+
+	err := ec.check(db, inputs)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Update(ec)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such element combination to update")
+	}
+
+	err = ec.deleteInputs(db)
+	if err != nil {
+		return err
+	}
+
+	return ec.setInputs(db, inputs)
+}
+
+// Delete an element combination, with its inputs.
+func (ec *ElementCombination) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete element combination")
+	}
+
+	err := ec.deleteInputs(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Delete(ec)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such element combination to delete")
+	}
+
+	return nil
+}
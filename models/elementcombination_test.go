@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestElementCombinationCheck(t *testing.T) {
+	elem := func(Number int) *Element {
+		return &Element{ID: int64(Number), Number: Number}
+	}
+	combination := func(ID int64, output int, inputs ...int) *ElementCombination {
+		ec := &ElementCombination{ID: ID, IDElement: int64(output)}
+		for _, in := range inputs {
+			ec.Inputs = append(ec.Inputs, &ElementCombinationInput{IDCombination: ID, IDElement: int64(in)})
+		}
+		return ec
+	}
+
+	// 1 + 2 = 3, 3 + 4 = 5, 6 + 7 = 8
+	existing := []*ElementCombination{
+		combination(1, 3, 1, 2),
+		combination(2, 5, 3, 4),
+		combination(3, 8, 6, 7),
+	}
+
+	tests := []struct {
+		name   string
+		ID     int64 // Combination being updated, 0 for a new one
+		output int
+		inputs []int
+		err    string
+	}{
+		{"independent", 0, 9, []int{4, 6}, ""},
+		{"output of existing combinations", 0, 9, []int{5, 8}, ""},
+		{"single input", 0, 9, []int{4}, "An element combination needs at least two input elements"},
+		{"into itself", 0, 9, []int{4, 9}, "Element 9 cannot be combined into itself"},
+		{"duplicate input", 0, 9, []int{4, 4}, "Duplicate input element 4"},
+		{"direct cycle", 0, 1, []int{3, 6}, "Element 3 is obtained by combining the output element (cyclic combination)"},
+		{"indirect cycle", 0, 1, []int{5, 6}, "Element 5 is obtained by combining the output element (cyclic combination)"},
+		{"unchanged update", 2, 5, []int{3, 4}, ""},
+		{"update creating a cycle", 1, 3, []int{5, 6}, "Element 5 is obtained by combining the output element (cyclic combination)"},
+		{"update replacing the only path", 1, 2, []int{3, 6}, ""},
+	}
+
+	for _, tt := range tests {
+		ec := &ElementCombination{ID: tt.ID, IDElement: int64(tt.output)}
+		var inputs []*Element
+		for _, n := range tt.inputs {
+			inputs = append(inputs, elem(n))
+		}
+
+		err := ec.validInputs(inputs)
+		if err == nil {
+			err = ec.checkCycles(inputs, existing)
+		}
+
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%s: got error %v, expected %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -17,7 +17,7 @@ type ElementLink struct {
 }
 
 // Create a link between an element and a card.
-func CreateElementLink(db *gorp.DbMap, card *Card, elem *Element, GivesUses bool) (*ElementLink, error) {
+func CreateElementLink(db gorp.SqlExecutor, card *Card, elem *Element, GivesUses bool) (*ElementLink, error) {
 	if db == nil || elem == nil || card == nil {
 		return nil, errors.New("Missing parameters to create element link")
 	}
@@ -38,7 +38,7 @@ func CreateElementLink(db *gorp.DbMap, card *Card, elem *Element, GivesUses bool
 }
 
 // List element links, with filters.
-func ListElementLinks(db *gorp.DbMap, scenar *Scenario, card *Card, elem *Element) ([]*ElementLink, error) {
+func ListElementLinks(db gorp.SqlExecutor, scenar *Scenario, card *Card, elem *Element) ([]*ElementLink, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load element links")
 	}
@@ -77,7 +77,7 @@ func ListElementLinks(db *gorp.DbMap, scenar *Scenario, card *Card, elem *Elemen
 }
 
 // Load an element link by id, with optional scenario filter.
-func LoadElementLinkFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*ElementLink, error) {
+func LoadElementLinkFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*ElementLink, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load element link")
 	}
@@ -105,7 +105,7 @@ func LoadElementLinkFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Element
 }
 
 // Delete an element link
-func (el *ElementLink) Delete(db *gorp.DbMap) error {
+func (el *ElementLink) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete element link")
 	}
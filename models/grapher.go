@@ -10,20 +10,50 @@ type LocGraph struct {
 }
 
 type CardGraph struct {
-	ID                    int64   `json:"id"`
-	Description           string  `json:"description"`
-	Reveals               []int64 `json:"reveals,omitempty"`
-	UnlockStateTokens     []int64 `json:"unlocks_state_tokens,omitempty"`
-	IsUnlockedStateTokens []int64 `json:"is_unlocked_state_tokens,omitempty"`
-	SkillTests            []int64 `json:"skill_tests,omitempty"`
+	ID                    int64            `json:"id"`
+	Description           string           `json:"description"`
+	TUCost                uint             `json:"tu_cost"`
+	Reveals               []int64          `json:"reveals,omitempty"`
+	TravelTUCosts         map[int64]uint   `json:"travel_tu_costs,omitempty"` // By revealed location
+	UnlockStateTokens     []int64          `json:"unlocks_state_tokens,omitempty"`
+	IsUnlockedStateTokens []int64          `json:"is_unlocked_state_tokens,omitempty"`
+	SkillTests            []int64          `json:"skill_tests,omitempty"`
+	GivesElements         []int64          `json:"gives_elements,omitempty"`
+	UsesElements          []int64          `json:"uses_elements,omitempty"`
+	Requirement           *RequirementExpr `json:"requirement,omitempty"`
 }
 
-func Graph(db *gorp.DbMap, scenar *Scenario) (interface{}, error) {
+// CombGraph is an element combination: it gives its output element once all of its input elements
+// are held. Relations of the output element card are attributed to it, as they are attributed
+// to the location cards giving element cards.
+type CombGraph struct {
+	CardGraph
+	Inputs []int64 `json:"inputs"`
+}
 
-	locations, err := ListLocations(db, scenar)
+type locationGraphOut struct {
+	Locations    []*LocGraph  `json:"locations"`
+	Combinations []*CombGraph `json:"combinations"`
+}
+
+func Graph(db gorp.SqlExecutor, scenar *Scenario) (interface{}, error) {
+	locs, combs, err := LocationGraph(db, scenar)
 	if err != nil {
 		return nil, err
 	}
+	return &locationGraphOut{Locations: locs, Combinations: combs}, nil
+}
+
+// Build the graph of a scenario's locations and their cards, with the relations between cards:
+// revealed locations, unlocked state tokens, given and used elements, skill tests, requirements.
+// Elements are abstracted out: relations of element cards are attributed to the location cards
+// that give them, or to the combinations they are the output of.
+func LocationGraph(db gorp.SqlExecutor, scenar *Scenario) ([]*LocGraph, []*CombGraph, error) {
+
+	locations, err := ListLocations(db, scenar)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	locGraphOut := []*LocGraph{}
 	cards := make(map[int64]*CardGraph)
@@ -31,7 +61,7 @@ func Graph(db *gorp.DbMap, scenar *Scenario) (interface{}, error) {
 	for _, loc := range locations {
 		loc_cards, err := loc.GetCards(db)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		locG := &LocGraph{
 			ID:     loc.ID,
@@ -43,48 +73,81 @@ func Graph(db *gorp.DbMap, scenar *Scenario) (interface{}, error) {
 			cG := &CardGraph{
 				ID:          c.ID,
 				Description: c.Description,
+				TUCost:      c.TUCost,
 			}
 			locG.Cards = append(locG.Cards, cG)
 			cards[c.ID] = cG
 		}
 	}
 
-	elemToCard := make(map[int64]int64)
-	elemCards := make(map[int64]*Card)
-	elems, err := GetElementCards(db, scenar)
+	eg, err := loadElementGraph(db, scenar)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	for _, elem := range elems {
-		elemCards[elem.ID] = elem
-	}
-	elemLink, err := ListElementLinks(db, scenar, nil, nil)
-	if err != nil {
-		return nil, err
+
+	combGraphOut := []*CombGraph{}
+	combs := make(map[int64]*CombGraph)
+
+	for _, ec := range eg.combinations {
+		cbG := &CombGraph{CardGraph: CardGraph{ID: ec.ID, GivesElements: []int64{ec.IDElement}}}
+		for _, in := range ec.Inputs {
+			cbG.Inputs = append(cbG.Inputs, in.IDElement)
+		}
+		combGraphOut = append(combGraphOut, cbG)
+		combs[ec.ID] = cbG
 	}
-	for _, el := range elemLink {
-		if el.GivesUses {
-			c, ok := elemCards[el.IDElement]
+
+	// Location card or combination an element card originates from (see recurseElementLinks)
+	originGraph := func(origin int64) *CardGraph {
+		if origin < 0 {
+			cbG, ok := combs[-origin]
 			if !ok {
+				return nil
+			}
+			return &cbG.CardGraph
+		}
+		return cards[origin]
+	}
+
+	for _, el := range eg.links {
+		origins := []int64{el.IDCard}
+		if _, ok := cards[el.IDCard]; !ok {
+			if !el.GivesUses {
 				continue
 			}
-			// This allows backtracking:
-			// card c.ID (element card) IS GIVEN BY el.IDCard
-			// if el.IDCard represents an element card too,
-			// its origin cab be recursively found too
-			// until we reach a location card, which we will design as the actual origin
-			// to abstract elements out of this graph
-			elemToCard[c.ID] = el.IDCard
+			// Elements given by element cards are attributed to their origins
+			origins = recurseElementLinks(el.IDCard, eg)
+		}
+		for _, origin := range origins {
+			c := originGraph(origin)
+			if c == nil {
+				continue
+			}
+			if el.GivesUses {
+				c.GivesElements = appendID(c.GivesElements, el.IDElement)
+			} else {
+				c.UsesElements = appendID(c.UsesElements, el.IDElement)
+			}
 		}
 	}
 
 	stateTk, err := ListStateTokenLinks(db, scenar, nil, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, tk := range stateTk {
 		c, ok := cards[tk.IDCard]
 		if !ok {
+			if !tk.UnlocksUnlocked {
+				continue
+			}
+			// Tokens unlocked by element cards are attributed to their origins
+			for _, origin := range recurseElementLinks(tk.IDCard, eg) {
+				c = originGraph(origin)
+				if c != nil {
+					c.UnlockStateTokens = append(c.UnlockStateTokens, tk.IDStateToken)
+				}
+			}
 			continue
 		}
 		if tk.UnlocksUnlocked {
@@ -96,24 +159,30 @@ func Graph(db *gorp.DbMap, scenar *Scenario) (interface{}, error) {
 
 	locLink, err := ListLocationLinks(db, scenar, nil, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, ll := range locLink {
-		c, ok := cards[ll.IDCard]
-		if !ok {
-			initialLocationCard := recurseElementLinks(ll.IDCard, elemToCard)
-			c, ok = cards[initialLocationCard]
-			if !ok {
+		origins := []int64{ll.IDCard}
+		if _, ok := cards[ll.IDCard]; !ok {
+			origins = recurseElementLinks(ll.IDCard, eg)
+		}
+		for _, origin := range origins {
+			c := originGraph(origin)
+			if c == nil {
 				// Could not backtrack to an initial location card
 				continue
 			}
+			c.Reveals = append(c.Reveals, ll.IDLocation)
+			if c.TravelTUCosts == nil {
+				c.TravelTUCosts = make(map[int64]uint)
+			}
+			c.TravelTUCosts[ll.IDLocation] = ll.TUCost
 		}
-		c.Reveals = append(c.Reveals, ll.IDLocation)
 	}
 
 	skillTest, err := ListSkillTests(db, scenar, nil, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, st := range skillTest {
 		c, ok := cards[st.IDCard]
@@ -123,19 +192,116 @@ func Graph(db *gorp.DbMap, scenar *Scenario) (interface{}, error) {
 		c.SkillTests = append(c.SkillTests, st.IDStat)
 	}
 
-	return locGraphOut, nil
+	requirements, err := ListRequirements(db, scenar)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range requirements {
+		c, ok := cards[r.IDCard]
+		if !ok {
+			continue
+		}
+		c.Requirement = r.Expression
+	}
+
+	return locGraphOut, combGraphOut, nil
+}
+
+// elementGraph is how element cards are obtained, to backtrack them to the cards they originate from.
+type elementGraph struct {
+	cards        map[int64]int64   // Card ID by element ID
+	givers       map[int64][]int64 // Cards giving each element card
+	combined     map[int64][]int64 // Combinations giving each element card
+	links        []*ElementLink
+	combinations []*ElementCombination
 }
 
-func recurseElementLinks(IDCard int64, elemToCard map[int64]int64) int64 {
-	var i int64
-	ok := true
-	retID := IDCard
+func loadElementGraph(db gorp.SqlExecutor, scenar *Scenario) (*elementGraph, error) {
+	eg := &elementGraph{
+		cards:    make(map[int64]int64),
+		givers:   make(map[int64][]int64),
+		combined: make(map[int64][]int64),
+	}
+
+	elems, err := ListElements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, elem := range elems {
+		eg.cards[elem.ID] = elem.IDCard
+	}
+	eg.links, err = ListElementLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, el := range eg.links {
+		if el.GivesUses {
+			c, ok := eg.cards[el.IDElement]
+			if !ok {
+				continue
+			}
+			// This allows backtracking:
+			// card c (element card) IS GIVEN BY el.IDCard
+			// if el.IDCard represents an element card too,
+			// its origin cab be recursively found too
+			// until we reach a location card, which we will design as the actual origin
+			// to abstract elements out of this graph
+			eg.givers[c] = append(eg.givers[c], el.IDCard)
+		}
+	}
+	eg.combinations, err = ListElementCombinations(db, scenar, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, ec := range eg.combinations {
+		c, ok := eg.cards[ec.IDElement]
+		if !ok {
+			continue
+		}
+		// A combined element card is not given by the cards of its inputs, as it needs all of them:
+		// the combination itself is its origin
+		eg.combined[c] = append(eg.combined[c], ec.ID)
+	}
+
+	return eg, nil
+}
+
+// Backtrack an element card to what it originates from: the cards giving its element, recursively,
+// and the combinations it is the output of. Each origin is enough to obtain the card.
+// Cards that are not given by any other card are origins, a card that is not an element card
+// is its own origin. Combinations are origins by their negated ID (as in accessRules).
+func recurseElementLinks(IDCard int64, eg *elementGraph) []int64 {
+	var origins []int64
+	visited := make(map[int64]bool)
+
+	var walk func(int64)
+	walk = func(ID int64) {
+		if visited[ID] {
+			return
+		}
+		visited[ID] = true
+		givers, combined := eg.givers[ID], eg.combined[ID]
+		if len(givers) == 0 && len(combined) == 0 {
+			origins = append(origins, ID)
+			return
+		}
+		for _, g := range givers {
+			walk(g)
+		}
+		for _, ec := range combined {
+			origins = append(origins, -ec)
+		}
+	}
+	walk(IDCard)
+
+	return origins
+}
 
-	for ok {
-		i, ok = elemToCard[retID]
-		if ok {
-			retID = i
+func appendID(ids []int64, ID int64) []int64 {
+	for _, i := range ids {
+		if i == ID {
+			return ids
 		}
 	}
-	return retID
+	return append(ids, ID)
 }
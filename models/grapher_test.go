@@ -0,0 +1,32 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecurseElementLinks(t *testing.T) {
+	// Element card 10 is given by card 1, 11 by card 2, 12 is the output of combination 3,
+	// 13 is given by element card 12 and by card 2
+	eg := &elementGraph{
+		givers:   map[int64][]int64{10: {1}, 11: {2}, 13: {12, 2}},
+		combined: map[int64][]int64{12: {3}},
+	}
+
+	tests := []struct {
+		name    string
+		IDCard  int64
+		origins []int64
+	}{
+		{"location card", 5, []int64{5}},
+		{"element card given by a card", 10, []int64{1}},
+		{"combined element card", 12, []int64{-3}},
+		{"element card given by a combined element card", 13, []int64{-3, 2}},
+	}
+
+	for _, tt := range tests {
+		if got := recurseElementLinks(tt.IDCard, eg); !reflect.DeepEqual(got, tt.origins) {
+			t.Errorf("%s: got origins %v, expected %v", tt.name, got, tt.origins)
+		}
+	}
+}
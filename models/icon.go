@@ -1,7 +1,10 @@
 package models
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/Masterminds/squirrel"
@@ -16,17 +19,36 @@ const (
 	HEART_SHIELD_ICON   = "heart_shield"
 	UT_SHIELD_ICON      = "ut_shield"
 	SPECIAL_SHIELD_ICON = "special_shield"
+
+	// Requirement expressions
+	ELEMENT_ICON     = "element"
+	NOT_ICON         = "not"
+	OR_ICON          = "or"
+	GROUP_START_ICON = "group_start"
+	GROUP_END_ICON   = "group_end"
+
+	MAX_ICON_WIDTH  = 1024 // In pixels
+	MAX_ICON_HEIGHT = 1024 // In pixels
 )
 
+// Base game icons placed by model code, see CreateBaseIcons.
+var BaseIcons = []string{
+	NORMAL_SHIELD_ICON, SKULL_SHIELD_ICON, HEART_SHIELD_ICON, UT_SHIELD_ICON, SPECIAL_SHIELD_ICON,
+	ELEMENT_ICON, NOT_ICON, OR_ICON, GROUP_START_ICON, GROUP_END_ICON,
+}
+
+// Icon is a graphical element that can be placed on cards (see CardIcon).
+// Its graphics are either an uploaded PNG/SVG image, or an external URL.
 type Icon struct {
 	ID         int64  `json:"id" db:"id"`
 	IDScenario *int64 `json:"id_scenario" db:"id_scenario"`
 	ShortName  string `json:"short_name" db:"short_name"`
 	URL        string `json:"url" db:"url"`
+	IDImage    *int64 `json:"id_image" db:"id_image"`
 }
 
 // Create an icon
-func CreateIcon(db *gorp.DbMap, scenar *Scenario, ShortName string, URL string) (*Icon, error) {
+func CreateIcon(db gorp.SqlExecutor, scenar *Scenario, ShortName string, URL string) (*Icon, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to create icon")
 	}
@@ -54,7 +76,7 @@ func CreateIcon(db *gorp.DbMap, scenar *Scenario, ShortName string, URL string)
 }
 
 // List icons, optionally filtered by scenario.
-func ListIcons(db *gorp.DbMap, scenar *Scenario) ([]*Icon, error) {
+func ListIcons(db gorp.SqlExecutor, scenar *Scenario) ([]*Icon, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list icons")
 	}
@@ -87,7 +109,7 @@ func ListIcons(db *gorp.DbMap, scenar *Scenario) ([]*Icon, error) {
 
 // Load an icon from ID. If scenar parameter is non-nil it acts as a filter:
 // only rows with id_scenario NULL or stricly equal will be returned.
-func LoadIconFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Icon, error) {
+func LoadIconFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Icon, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load icon")
 	}
@@ -115,9 +137,33 @@ func LoadIconFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Icon, error) {
 	return &i, nil
 }
 
+// Create the missing base game icons, without graphics: an image or URL can be set afterwards.
+// Existing base icons are left as-is.
+func CreateBaseIcons(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to create base icons")
+	}
+
+	for _, ShortName := range BaseIcons {
+		_, err := LoadBaseIconFromShortName(db, ShortName)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		_, err = CreateIcon(db, nil, ShortName, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Used to load base game objects, e.g. shield icons. These need to be referenced by a const name for conveniency.
 // This enforces id_scenario IS NULL (i.e. base game objects) on returned rows.
-func LoadBaseIconFromShortName(db *gorp.DbMap, ShortName string) (*Icon, error) {
+func LoadBaseIconFromShortName(db gorp.SqlExecutor, ShortName string) (*Icon, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load base icon")
 	}
@@ -144,12 +190,12 @@ func LoadBaseIconFromShortName(db *gorp.DbMap, ShortName string) (*Icon, error)
 }
 
 // Update an icon
-func (i *Icon) Update(db *gorp.DbMap, ShortName string, URL string) error {
+func (i *Icon) Update(db gorp.SqlExecutor, ShortName string, URL string) error {
 	if db == nil {
 		return errors.New("Missing db parameter to update icon")
 	}
 
-	i.ShortName = ShortName
+	i.ShortName = strings.TrimSpace(ShortName)
 	i.URL = URL
 
 	err := i.Valid()
@@ -169,7 +215,7 @@ func (i *Icon) Update(db *gorp.DbMap, ShortName string, URL string) error {
 }
 
 // Delete an icon
-func (i *Icon) Delete(db *gorp.DbMap) error {
+func (i *Icon) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete icon")
 	}
@@ -182,11 +228,81 @@ func (i *Icon) Delete(db *gorp.DbMap) error {
 		return errors.New("No such icon to delete")
 	}
 
+	img, err := i.LoadImage(db)
+	if err != nil {
+		return err
+	}
+	if img != nil {
+		return img.Delete(db)
+	}
+
 	return nil
 }
 
+// Set the uploaded image of an icon, replacing any previous one. The previous image is kept (see Image).
+func (i *Icon) SetImage(db gorp.SqlExecutor, img *Image) error {
+	if db == nil || img == nil {
+		return errors.New("Missing parameters to set icon image")
+	}
+
+	err := validIconImage(img)
+	if err != nil {
+		return err
+	}
+
+	i.IDImage = &img.ID
+
+	rows, err := db.Update(i)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such icon to update")
+	}
+
+	return nil
+}
+
+// Create an image from raw data for an icon. The icon constraints are verified
+// before the image is stored.
+func CreateIconImage(db gorp.SqlExecutor, scenar *Scenario, data []byte) (*Image, error) {
+	return createImage(db, scenar, data, validIconImage)
+}
+
+func validIconImage(img *Image) error {
+	if img.Format != ImageFormatPNG && img.Format != ImageFormatSVG {
+		return fmt.Errorf("Unsupported icon format: %s (PNG or SVG only)", img.Format)
+	}
+	if img.Width > MAX_ICON_WIDTH || img.Height > MAX_ICON_HEIGHT {
+		return fmt.Errorf("Icon too big: %dx%d (max %dx%d)", img.Width, img.Height,
+			MAX_ICON_WIDTH, MAX_ICON_HEIGHT)
+	}
+	return nil
+}
+
+// Load the uploaded image of an icon. Returns nil if there is none.
+func (i *Icon) LoadImage(db gorp.SqlExecutor) (*Image, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load icon image")
+	}
+
+	if i.IDImage == nil {
+		return nil, nil
+	}
+
+	return LoadImageFromID(db, nil, *i.IDImage)
+}
+
 // Verify that an icon object is valid before creating/updating it
 func (i *Icon) Valid() error {
-	// TODO coherency checks
+	if i.ShortName == "" {
+		return errors.New("Empty icon short name")
+	}
+	if i.URL != "" {
+		u, err := url.Parse(i.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid icon URL: %s", i.URL)
+		}
+	}
 	return nil
 }
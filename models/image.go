@@ -0,0 +1,313 @@
+package models
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/blobstore"
+	"github.com/loopfz/scecret/utils/securerandom"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+const (
+	MAX_IMAGE_SIZE   = 10 << 20 // In bytes
+	MAX_IMAGE_WIDTH  = 20000    // In pixels, panoramas can be very wide
+	MAX_IMAGE_HEIGHT = 5000     // In pixels
+
+	BLOB_KEY_LEN = 16
+
+	ImageFormatPNG  = "png"
+	ImageFormatJPEG = "jpeg"
+	ImageFormatSVG  = "svg"
+)
+
+// Where image data is stored. If nil, it is stored in the image table.
+var blobStore blobstore.Store
+
+// Store image data in a blob store instead of the database.
+func SetBlobStore(s blobstore.Store) {
+	blobStore = s
+}
+
+// Start a blob store transaction, to use along with a database transaction
+// (see RevisionRecorder.Blobs). Returns nil if there is no blob store.
+func NewBlobTx() *blobstore.Tx {
+	if blobStore == nil {
+		return nil
+	}
+	return blobstore.NewTx(blobStore)
+}
+
+// Blob store to use with an executor: its blob transaction, if any.
+func blobs(db gorp.SqlExecutor) blobstore.Store {
+	if rr, ok := db.(*RevisionRecorder); ok && rr.Blobs != nil {
+		return rr.Blobs
+	}
+	return blobStore
+}
+
+// Image is a picture uploaded by the user, e.g. a location panorama or an icon.
+// The raw data is stored either in DB or in the blob store (see SetBlobStore),
+// along with its format and dimensions.
+// Images are not deleted when they are replaced: reverting a revision or undoing a change
+// may bring back a reference to them.
+type Image struct {
+	ID         int64  `json:"id" db:"id"`
+	IDScenario int64  `json:"-" db:"id_scenario"`
+	Format     string `json:"format" db:"format"`
+	Width      int    `json:"width" db:"width"`
+	Height     int    `json:"height" db:"height"`
+	Data       []byte `json:"-" db:"data"`
+	BlobKey    string `json:"-" db:"blob_key"`
+}
+
+// Create an image from raw PNG/JPEG/SVG data.
+func CreateImage(db gorp.SqlExecutor, scenar *Scenario, data []byte) (*Image, error) {
+	return createImage(db, scenar, data, nil)
+}
+
+// Create an image, verified by an additional check (e.g. icon formats) before anything is stored.
+func createImage(db gorp.SqlExecutor, scenar *Scenario, data []byte, check func(*Image) error) (*Image, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to create image")
+	}
+
+	img := &Image{
+		IDScenario: scenar.ID,
+		Data:       data,
+	}
+
+	err := img.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	if check != nil {
+		err = check(img)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if blobStore != nil {
+		key, err := securerandom.RandomString(BLOB_KEY_LEN)
+		if err != nil {
+			return nil, err
+		}
+		err = blobs(db).Put(key, data)
+		if err != nil {
+			return nil, err
+		}
+		img.BlobKey = key
+		img.Data = nil
+	}
+
+	err = db.Insert(img)
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// Load an image by ID. Optionally filtered by scenario.
+func LoadImageFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Image, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load image")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"image"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
+
+	if scenar != nil {
+		selector = selector.Where(squirrel.Eq{`id_scenario`: scenar.ID})
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var img Image
+
+	err = db.SelectOne(&img, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &img, nil
+}
+
+// List a scenario's images.
+func ListImages(db gorp.SqlExecutor, scenar *Scenario) ([]*Image, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to list images")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"image"`).Where(
+		squirrel.Eq{`id_scenario`: scenar.ID},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var img []*Image
+
+	_, err = db.Select(&img, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// Delete an image.
+func (img *Image) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete image")
+	}
+
+	rows, err := db.Delete(img)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such image to delete")
+	}
+
+	if img.BlobKey != "" && blobStore != nil {
+		return blobs(db).Delete(img.BlobKey)
+	}
+
+	return nil
+}
+
+// Raw image data, from DB or from the blob store.
+func (img *Image) Content() ([]byte, error) {
+	if img.BlobKey == "" {
+		return img.Data, nil
+	}
+	if blobStore == nil {
+		return nil, errors.New("Image stored in blob store, but no blob store configured")
+	}
+	return blobStore.Get(img.BlobKey)
+}
+
+// Decode the image data. Not supported for SVG images.
+func (img *Image) Decode() (image.Image, error) {
+	if img.Format == ImageFormatSVG {
+		return nil, errors.New("Cannot decode SVG image")
+	}
+
+	data, err := img.Content()
+	if err != nil {
+		return nil, err
+	}
+
+	i, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// MIME type of the image data.
+func (img *Image) ContentType() string {
+	if img.Format == ImageFormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/" + img.Format
+}
+
+// Verify that an image is valid before creating it.
+// This also fills in the format and dimensions from the raw data.
+func (img *Image) Valid() error {
+	if len(img.Data) == 0 {
+		return errors.New("Empty image")
+	}
+	if len(img.Data) > MAX_IMAGE_SIZE {
+		return fmt.Errorf("Image too big: %d bytes (max %d)", len(img.Data), MAX_IMAGE_SIZE)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		// Not a raster image, maybe SVG
+		cfg, err = svgConfig(img.Data)
+		if err != nil {
+			return fmt.Errorf("Invalid image data: %s", err)
+		}
+		format = ImageFormatSVG
+	}
+	if format != ImageFormatPNG && format != ImageFormatJPEG && format != ImageFormatSVG {
+		return fmt.Errorf("Unsupported image format: %s", format)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > MAX_IMAGE_WIDTH || cfg.Height > MAX_IMAGE_HEIGHT {
+		return fmt.Errorf("Invalid image dimensions: %dx%d (max %dx%d)", cfg.Width, cfg.Height,
+			MAX_IMAGE_WIDTH, MAX_IMAGE_HEIGHT)
+	}
+
+	img.Format = format
+	img.Width = cfg.Width
+	img.Height = cfg.Height
+
+	return nil
+}
+
+// Read the dimensions of an SVG document, from its root element
+// width/height attributes, or its viewBox.
+func svgConfig(data []byte) (image.Config, error) {
+	var cfg image.Config
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return cfg, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if se.Name.Local != "svg" {
+			return cfg, errors.New("Root element is not svg")
+		}
+
+		var viewBox []string
+		for _, attr := range se.Attr {
+			switch attr.Name.Local {
+			case "width":
+				cfg.Width = svgLength(attr.Value)
+			case "height":
+				cfg.Height = svgLength(attr.Value)
+			case "viewBox":
+				viewBox = strings.Fields(strings.Replace(attr.Value, ",", " ", -1))
+			}
+		}
+		if (cfg.Width == 0 || cfg.Height == 0) && len(viewBox) == 4 {
+			cfg.Width = svgLength(viewBox[2])
+			cfg.Height = svgLength(viewBox[3])
+		}
+
+		return cfg, nil
+	}
+}
+
+// Parse an SVG length in pixels. Returns 0 for unsupported units (e.g. percentages).
+func svgLength(s string) int {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "px"), 64)
+	if err != nil {
+		return 0
+	}
+	return int(f + 0.5)
+}
@@ -12,12 +12,15 @@ import (
 
 // Location represents a location the players can visit.
 // It is composed of several cards.
+// It can have a background panorama image, which is sliced across the backs
+// of its cards in letter order.
 type Location struct {
-	ID         int64  `json:"id" db:"id"`
-	IDScenario int64  `json:"-" db:"id_scenario"`
-	Name       string `json:"name" db:"name"`
-	Hidden     bool   `json:"hidden" db:"hidden"`
-	Notes      string `json:"notes" db:"notes"`
+	ID           int64  `json:"id" db:"id"`
+	IDScenario   int64  `json:"-" db:"id_scenario"`
+	Name         string `json:"name" db:"name"`
+	Hidden       bool   `json:"hidden" db:"hidden"`
+	Notes        string `json:"notes" db:"notes"`
+	IDBackground *int64 `json:"id_background" db:"id_background"`
 }
 
 // LocationCard represents the cards contained in a location.
@@ -30,7 +33,7 @@ type LocationCard struct {
 }
 
 // Create a location.
-func CreateLocation(db *gorp.DbMap, scenar *Scenario, Name string, Hidden bool) (*Location, error) {
+func CreateLocation(db gorp.SqlExecutor, scenar *Scenario, Name string, Hidden bool) (*Location, error) {
 	if db == nil || scenar == nil {
 		return nil, errors.New("Missing parameters to create location")
 	}
@@ -55,7 +58,7 @@ func CreateLocation(db *gorp.DbMap, scenar *Scenario, Name string, Hidden bool)
 }
 
 // List locations, with filters.
-func ListLocations(db *gorp.DbMap, scenar *Scenario) ([]*Location, error) {
+func ListLocations(db gorp.SqlExecutor, scenar *Scenario) ([]*Location, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list locations")
 	}
@@ -82,7 +85,7 @@ func ListLocations(db *gorp.DbMap, scenar *Scenario) ([]*Location, error) {
 }
 
 // Load a Location from ID. Optionally filtered by scenario.
-func LoadLocationFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Location, error) {
+func LoadLocationFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Location, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list locations")
 	}
@@ -111,7 +114,7 @@ func LoadLocationFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Location,
 }
 
 // Update a location.
-func (loc *Location) Update(db *gorp.DbMap, Name string, Hidden bool, Notes string) error {
+func (loc *Location) Update(db gorp.SqlExecutor, Name string, Hidden bool, Notes string) error {
 	if db == nil {
 		return errors.New("Missing db parameter to update location")
 	}
@@ -138,12 +141,11 @@ func (loc *Location) Update(db *gorp.DbMap, Name string, Hidden bool, Notes stri
 }
 
 // Delete a location.
-func (loc *Location) Delete(db *gorp.DbMap) error {
+func (loc *Location) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete location")
 	}
 
-	// TODO Tx
 	locCards, err := loc.ListLocationCards(db)
 	if err != nil {
 		return err
@@ -156,6 +158,21 @@ func (loc *Location) Delete(db *gorp.DbMap) error {
 		}
 	}
 
+	plans, err := ListPlans(db, &Scenario{ID: loc.IDScenario})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range plans {
+		if p.IDLocation != loc.ID {
+			continue
+		}
+		err := p.Delete(db)
+		if err != nil {
+			return err
+		}
+	}
+
 	rows, err := db.Delete(loc)
 	if err != nil {
 		return err
@@ -163,9 +180,65 @@ func (loc *Location) Delete(db *gorp.DbMap) error {
 	if rows == 0 {
 		return errors.New("No such location to delete")
 	}
+
+	return nil
+}
+
+// Set the background panorama of a location, replacing any previous one.
+// A nil image removes the background. The previous image is kept (see Image).
+func (loc *Location) SetBackground(db gorp.SqlExecutor, img *Image) error {
+	if db == nil {
+		return errors.New("Missing db parameter to set location background")
+	}
+	if img != nil {
+		err := validBackground(img)
+		if err != nil {
+			return err
+		}
+	}
+
+	loc.IDBackground = nil
+	if img != nil {
+		loc.IDBackground = &img.ID
+	}
+
+	rows, err := db.Update(loc)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such location to update")
+	}
+
+	return nil
+}
+
+// Create an image from raw data for a location background. The background constraints
+// are verified before the image is stored.
+func CreateBackgroundImage(db gorp.SqlExecutor, scenar *Scenario, data []byte) (*Image, error) {
+	return createImage(db, scenar, data, validBackground)
+}
+
+func validBackground(img *Image) error {
+	if img.Format == ImageFormatSVG {
+		return errors.New("Location background must be a PNG or JPEG image")
+	}
 	return nil
 }
 
+// Load the background panorama of a location. Returns nil if there is none.
+func (loc *Location) LoadBackground(db gorp.SqlExecutor) (*Image, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load location background")
+	}
+
+	if loc.IDBackground == nil {
+		return nil, nil
+	}
+
+	return LoadImageFromID(db, nil, *loc.IDBackground)
+}
+
 // Verify that a Location is valid before creating/updating it.
 func (loc *Location) Valid() error {
 	if loc.Name == "" {
@@ -175,7 +248,7 @@ func (loc *Location) Valid() error {
 }
 
 // Create a link between a card and a location.
-func (loc *Location) CreateLocationCard(db *gorp.DbMap, scenar *Scenario, letter string) (*LocationCard, error) {
+func (loc *Location) CreateLocationCard(db gorp.SqlExecutor, scenar *Scenario, letter string) (*LocationCard, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to create location card")
 	}
@@ -183,7 +256,7 @@ func (loc *Location) CreateLocationCard(db *gorp.DbMap, scenar *Scenario, letter
 	letter = strings.ToUpper(strings.TrimSpace(letter))
 
 	cardDesc := fmt.Sprintf("%s - %s", loc.Name, letter)
-	card, err := CreateCard(db, scenar, 0, cardDesc, &CardFace{}, &CardFace{})
+	card, err := CreateCard(db, scenar, CardTypeLocation, 0, cardDesc, &CardFace{}, &CardFace{}, DEFAULT_CARD_TU_COST)
 	if err != nil {
 		return nil, err
 	}
@@ -196,19 +269,19 @@ func (loc *Location) CreateLocationCard(db *gorp.DbMap, scenar *Scenario, letter
 
 	err = lc.Valid()
 	if err != nil {
-		return nil, err // TODO Tx
+		return nil, err
 	}
 
 	err = db.Insert(lc)
 	if err != nil {
-		return nil, err // TODO Tx
+		return nil, err
 	}
 
 	return lc, nil
 }
 
 // List a location's cards.
-func (loc *Location) ListLocationCards(db *gorp.DbMap) ([]*LocationCard, error) {
+func (loc *Location) ListLocationCards(db gorp.SqlExecutor) ([]*LocationCard, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list location cards")
 	}
@@ -232,7 +305,7 @@ func (loc *Location) ListLocationCards(db *gorp.DbMap) ([]*LocationCard, error)
 }
 
 // Load a location card,
-func (loc *Location) LoadLocationCardFromID(db *gorp.DbMap, ID int64) (*LocationCard, error) {
+func (loc *Location) LoadLocationCardFromID(db gorp.SqlExecutor, ID int64) (*LocationCard, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load location card")
 	}
@@ -258,8 +331,32 @@ func (loc *Location) LoadLocationCardFromID(db *gorp.DbMap, ID int64) (*Location
 	return &lc, nil
 }
 
+// Load the location card object linked to a card.
+func LoadLocationCardFromCardID(db gorp.SqlExecutor, IDCard int64) (*LocationCard, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load location card")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"location_card"`).Where(
+		squirrel.Eq{`id_card`: IDCard},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var lc LocationCard
+
+	err = db.SelectOne(&lc, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lc, nil
+}
+
 // Update a location card.
-func (lc *LocationCard) Update(db *gorp.DbMap, letter string) error {
+func (lc *LocationCard) Update(db gorp.SqlExecutor, letter string) error {
 	if db == nil {
 		return errors.New("Missing db parameter to update location card")
 	}
@@ -281,24 +378,24 @@ func (lc *LocationCard) Update(db *gorp.DbMap, letter string) error {
 		return err
 	}
 	cardDesc := fmt.Sprintf("%s - %s", loc.Name, lc.Letter)
-	err = card.Update(db, card.Number, cardDesc, card.Front, card.Back)
+	err = card.Update(db, card.Number, cardDesc, card.Front, card.Back, card.TUCost)
 	if err != nil {
 		return err
 	}
 
 	rows, err := db.Update(lc)
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 	if rows == 0 {
-		return errors.New("No such location card to update") // TODO Tx
+		return errors.New("No such location card to update")
 	}
 
 	return nil
 }
 
 // Delete a location card.
-func (lc *LocationCard) Delete(db *gorp.DbMap) error {
+func (lc *LocationCard) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to update location card")
 	}
@@ -315,10 +412,10 @@ func (lc *LocationCard) Delete(db *gorp.DbMap) error {
 
 	rows, err := db.Delete(lc)
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 	if rows == 0 {
-		return errors.New("No such location card to delete") // TODO Tx
+		return errors.New("No such location card to delete")
 	}
 
 	return nil
@@ -340,7 +437,7 @@ func (lc *LocationCard) Valid() error {
 }
 
 // TEMP ?
-func (loc *Location) GetCards(db *gorp.DbMap) ([]*Card, error) {
+func (loc *Location) GetCards(db gorp.SqlExecutor) ([]*Card, error) {
 
 	var c []*Card
 
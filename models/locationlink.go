@@ -8,17 +8,23 @@ import (
 	"github.com/loopfz/scecret/utils/sqlgenerator"
 )
 
+const (
+	DEFAULT_TRAVEL_TU_COST = 1
+)
+
 // LocationLink represents a link between a card and a Location.
 // The card REVEALS the location.
+// Travelling to the location once revealed costs TUCost Time Units.
 type LocationLink struct {
 	ID         int64 `json:"id" db:"id"`
 	IDScenario int64 `json:"-" db:"id_scenario"`
 	IDCard     int64 `json:"id_card" db:"id_card"`
 	IDLocation int64 `json:"id_location" db:"id_location"`
+	TUCost     uint  `json:"tu_cost" db:"tu_cost"`
 }
 
 // Create a link between a card and a location.
-func CreateLocationLink(db *gorp.DbMap, card *Card, loc *Location) (*LocationLink, error) {
+func CreateLocationLink(db gorp.SqlExecutor, card *Card, loc *Location, TUCost uint) (*LocationLink, error) {
 	if db == nil || card == nil || loc == nil {
 		return nil, errors.New("Missing parameters to create location link")
 	}
@@ -35,18 +41,19 @@ func CreateLocationLink(db *gorp.DbMap, card *Card, loc *Location) (*LocationLin
 		IDScenario: card.IDScenario,
 		IDCard:     card.ID,
 		IDLocation: loc.ID,
+		TUCost:     TUCost,
 	}
 
 	err := db.Insert(ll)
 	if err != nil {
-		return nil, err // TODO Tx
+		return nil, err
 	}
 
 	return ll, nil
 }
 
 // List location links, with filters.
-func ListLocationLinks(db *gorp.DbMap, scenar *Scenario, card *Card, loc *Location) ([]*LocationLink, error) {
+func ListLocationLinks(db gorp.SqlExecutor, scenar *Scenario, card *Card, loc *Location) ([]*LocationLink, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load location links")
 	}
@@ -79,7 +86,7 @@ func ListLocationLinks(db *gorp.DbMap, scenar *Scenario, card *Card, loc *Locati
 }
 
 // Loads a location link by ID. Optionally filtered by scenario.
-func LoadLocationLinkFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*LocationLink, error) {
+func LoadLocationLinkFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*LocationLink, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load card links")
 	}
@@ -107,8 +114,27 @@ func LoadLocationLinkFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Locati
 	return &ll, nil
 }
 
+// Update the travel cost of a location link.
+func (ll *LocationLink) Update(db gorp.SqlExecutor, TUCost uint) error {
+	if db == nil {
+		return errors.New("Missing db parameter to update location link")
+	}
+
+	ll.TUCost = TUCost
+
+	rows, err := db.Update(ll)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such location link to update")
+	}
+
+	return nil
+}
+
 // Delete a location link.
-func (ll *LocationLink) Delete(db *gorp.DbMap) error {
+func (ll *LocationLink) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete location link")
 	}
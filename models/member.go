@@ -0,0 +1,247 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+// Roles of the members of a scenario, from most to least privileged.
+// Owners can do everything, including deleting the scenario, managing its members
+// and transferring ownership. Editors can modify the scenario. Viewers can only read it.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var roleRanks = map[string]int{
+	RoleOwner:  3,
+	RoleEditor: 2,
+	RoleViewer: 1,
+}
+
+// Whether a role grants at least the privileges of another.
+func RoleAtLeast(role string, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+// ScenarioMember represents a user's role on a scenario.
+// A scenario has exactly one owner, its author.
+type ScenarioMember struct {
+	ID         int64  `json:"id" db:"id"`
+	IDScenario int64  `json:"-" db:"id_scenario"`
+	IDUser     int64  `json:"-" db:"id_user"`
+	Role       string `json:"role" db:"role"`
+	Email      string `json:"email" db:"-"` // Filled when listing
+}
+
+// Add a user to a scenario with a role.
+func CreateScenarioMember(db gorp.SqlExecutor, scenar *Scenario, user *User, Role string) (*ScenarioMember, error) {
+	if db == nil || scenar == nil || user == nil {
+		return nil, errors.New("Missing parameters to create scenario member")
+	}
+
+	m := &ScenarioMember{
+		IDScenario: scenar.ID,
+		IDUser:     user.ID,
+		Role:       Role,
+		Email:      user.Email,
+	}
+
+	err := m.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Insert(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// List the members of a scenario.
+func ListScenarioMembers(db gorp.SqlExecutor, scenar *Scenario) ([]*ScenarioMember, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to list scenario members")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"scenario_member"`).Where(
+		squirrel.Eq{`id_scenario`: scenar.ID},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var m []*ScenarioMember
+
+	_, err = db.Select(&m, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range m {
+		u, err := LoadUserFromID(db, member.IDUser)
+		if err != nil {
+			return nil, err
+		}
+		member.Email = u.Email
+	}
+
+	return m, nil
+}
+
+// Load a scenario member by ID.
+func LoadScenarioMemberFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*ScenarioMember, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to load scenario member")
+	}
+
+	return loadScenarioMember(db, squirrel.And{
+		squirrel.Eq{`id`: ID},
+		squirrel.Eq{`id_scenario`: scenar.ID},
+	})
+}
+
+// Load the membership of a user on a scenario.
+func LoadScenarioMemberFromUser(db gorp.SqlExecutor, scenar *Scenario, user *User) (*ScenarioMember, error) {
+	if db == nil || scenar == nil || user == nil {
+		return nil, errors.New("Missing parameters to load scenario member")
+	}
+
+	return loadScenarioMember(db, squirrel.And{
+		squirrel.Eq{`id_user`: user.ID},
+		squirrel.Eq{`id_scenario`: scenar.ID},
+	})
+}
+
+func loadScenarioMember(db gorp.SqlExecutor, where squirrel.Sqlizer) (*ScenarioMember, error) {
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"scenario_member"`).Where(where).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var m ScenarioMember
+
+	err = db.SelectOne(&m, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := LoadUserFromID(db, m.IDUser)
+	if err != nil {
+		return nil, err
+	}
+	m.Email = u.Email
+
+	return &m, nil
+}
+
+// Change the role of a member.
+// Ownership cannot be given or taken this way, see Scenario.TransferOwnership.
+func (m *ScenarioMember) Update(db gorp.SqlExecutor, Role string) error {
+	if db == nil {
+		return errors.New("Missing db parameter to update scenario member")
+	}
+	if m.Role == RoleOwner || Role == RoleOwner {
+		return errors.New("Cannot change ownership of a scenario, transfer it instead")
+	}
+
+	m.Role = Role
+
+	err := m.Valid()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Update(m)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such scenario member to update")
+	}
+
+	return nil
+}
+
+// Remove a member from a scenario. The owner cannot be removed.
+func (m *ScenarioMember) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete scenario member")
+	}
+	if m.Role == RoleOwner {
+		return errors.New("Cannot remove the owner of a scenario")
+	}
+
+	rows, err := db.Delete(m)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such scenario member to delete")
+	}
+
+	return nil
+}
+
+// Make the authors of scenarios created before members existed their owners.
+// Scenarios that already have an owner are left as-is.
+func BackfillScenarioOwners(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to backfill scenario owners")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"scenario"`).Where(
+		squirrel.Expr(`id NOT IN (SELECT id_scenario FROM "scenario_member" WHERE role = ?)`, RoleOwner),
+	).ToSql()
+	if err != nil {
+		return err
+	}
+
+	var scenarios []*Scenario
+
+	_, err = db.Select(&scenarios, query, args...)
+	if err != nil {
+		return err
+	}
+
+	for _, sc := range scenarios {
+		author := &User{ID: sc.IDAuthor}
+		m, err := LoadScenarioMemberFromUser(db, sc, author)
+		if err == sql.ErrNoRows {
+			_, err = CreateScenarioMember(db, sc, author, RoleOwner)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// The author is already a member with another role
+		m.Role = RoleOwner
+		_, err = db.Update(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Verify that a scenario member is valid before creating/updating it.
+func (m *ScenarioMember) Valid() error {
+	if _, ok := roleRanks[m.Role]; !ok {
+		return fmt.Errorf("Invalid role: %s", m.Role)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+const (
+	MISSION_SUCCESS_CARD_DESC = "Mission success"
+)
+
+// MissionSuccess represents the card read by the players when they complete the mission.
+// Condition describes what the players have to achieve to get to it.
+type MissionSuccess struct {
+	ID         int64  `json:"id" db:"id"`
+	IDScenario int64  `json:"-" db:"id_scenario"`
+	Condition  string `json:"condition" db:"condition"`
+	IDCard     int64  `json:"id_card" db:"id_card"`
+}
+
+// Create a new mission success.
+func CreateMissionSuccess(db gorp.SqlExecutor, scenar *Scenario, Condition string) (*MissionSuccess, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to create mission success")
+	}
+
+	card, err := CreateCard(db, scenar, CardTypeMissionSuccess, 0, MISSION_SUCCESS_CARD_DESC, &CardFace{}, &CardFace{}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := &MissionSuccess{
+		IDScenario: scenar.ID,
+		Condition:  Condition,
+		IDCard:     card.ID,
+	}
+
+	err = ms.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Insert(ms)
+	if err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// List mission successes, optionally filtered by scenario.
+func ListMissionSuccesses(db gorp.SqlExecutor, scenar *Scenario) ([]*MissionSuccess, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to list mission successes")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"mission_success"`)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var ms []*MissionSuccess
+
+	_, err = db.Select(&ms, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// Load mission success by ID. Optional scenario filter.
+func LoadMissionSuccessFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*MissionSuccess, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load mission success")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"mission_success"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var ms MissionSuccess
+
+	err = db.SelectOne(&ms, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ms, nil
+}
+
+// Update a mission success.
+func (ms *MissionSuccess) Update(db gorp.SqlExecutor, Condition string) error {
+	if db == nil {
+		return errors.New("Missing db parameter to update mission success")
+	}
+
+	ms.Condition = Condition
+
+	err := ms.Valid()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Update(ms)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such mission success to update")
+	}
+
+	return nil
+}
+
+// Delete a mission success, and its card.
+func (ms *MissionSuccess) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete mission success")
+	}
+
+	card, err := LoadCardFromID(db, nil, ms.IDCard)
+	if err != nil {
+		return err
+	}
+	err = card.Delete(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Delete(ms)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such mission success to delete")
+	}
+
+	return nil
+}
+
+func (ms *MissionSuccess) Valid() error {
+	if ms.Condition == "" {
+		return errors.New("Missing victory condition")
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+// Plan represents the card laid at the back of a location's deck, showing the players
+// where to lay out each card of the location (the panorama).
+type Plan struct {
+	ID         int64       `json:"id" db:"id"`
+	IDScenario int64       `json:"-" db:"id_scenario"`
+	IDLocation int64       `json:"id_location" db:"id_location"`
+	Layout     *PlanLayout `json:"layout" db:"layout"`
+	IDCard     int64       `json:"id_card" db:"id_card"`
+}
+
+// PlanLayout is the deck-back layout of a plan: a slot for each location card, by letter.
+// It is stored as JSON, like CardFace.
+type PlanLayout struct {
+	Slots []PlanSlot `json:"slots"`
+}
+
+// PlanSlot is the position of a location card on a plan.
+type PlanSlot struct {
+	Letter string `json:"letter"`
+	X      uint   `json:"x"`
+	Y      uint   `json:"y"`
+}
+
+// Create a new plan for a location.
+func CreatePlan(db gorp.SqlExecutor, scenar *Scenario, loc *Location, Layout *PlanLayout) (*Plan, error) {
+	if db == nil || scenar == nil || loc == nil {
+		return nil, errors.New("Missing parameters to create plan")
+	}
+
+	if Layout == nil {
+		Layout = &PlanLayout{}
+	}
+
+	card, err := CreateCard(db, scenar, CardTypePlan, 0, planCardDesc(loc), &CardFace{}, &CardFace{}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plan{
+		IDScenario: scenar.ID,
+		IDLocation: loc.ID,
+		Layout:     Layout,
+		IDCard:     card.ID,
+	}
+
+	err = p.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Insert(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func planCardDesc(loc *Location) string {
+	return fmt.Sprintf("Plan %s", loc.Name)
+}
+
+// List plans, optionally filtered by scenario.
+func ListPlans(db gorp.SqlExecutor, scenar *Scenario) ([]*Plan, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to list plans")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"plan"`)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var p []*Plan
+
+	_, err = db.Select(&p, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Load plan by ID. Optional scenario filter.
+func LoadPlanFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Plan, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load plan")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"plan"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var p Plan
+
+	err = db.SelectOne(&p, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Update a plan's location and layout.
+func (p *Plan) Update(db gorp.SqlExecutor, loc *Location, Layout *PlanLayout) error {
+	if db == nil || loc == nil {
+		return errors.New("Missing parameters to update plan")
+	}
+
+	if Layout == nil {
+		Layout = &PlanLayout{}
+	}
+
+	p.IDLocation = loc.ID
+	p.Layout = Layout
+
+	err := p.Valid()
+	if err != nil {
+		return err
+	}
+
+	// Update linked card description
+	card, err := LoadCardFromID(db, nil, p.IDCard)
+	if err != nil {
+		return err
+	}
+	err = card.Update(db, card.Number, planCardDesc(loc), card.Front, card.Back, card.TUCost)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Update(p)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such plan to update")
+	}
+
+	return nil
+}
+
+// Delete a plan, and its card.
+func (p *Plan) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete plan")
+	}
+
+	card, err := LoadCardFromID(db, nil, p.IDCard)
+	if err != nil {
+		return err
+	}
+	err = card.Delete(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Delete(p)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such plan to delete")
+	}
+
+	return nil
+}
+
+func (p *Plan) Valid() error {
+	if p.IDLocation == 0 {
+		return errors.New("Missing plan location")
+	}
+	letters := make(map[string]bool)
+	for i := range p.Layout.Slots {
+		sl := &p.Layout.Slots[i]
+		sl.Letter = strings.ToUpper(strings.TrimSpace(sl.Letter))
+		if sl.Letter == "" {
+			return errors.New("Missing letter in plan slot")
+		}
+		if letters[sl.Letter] {
+			return fmt.Errorf("Duplicate plan slot %s", sl.Letter)
+		}
+		letters[sl.Letter] = true
+		if sl.X > MAX_X_COORD {
+			return fmt.Errorf("X coord: %d too big (max %d)", sl.X, MAX_X_COORD)
+		}
+		if sl.Y > MAX_Y_COORD {
+			return fmt.Errorf("Y coord: %d too big (max %d)", sl.Y, MAX_Y_COORD)
+		}
+	}
+	return nil
+}
+
+func (pl *PlanLayout) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	s := value.([]byte)
+	return json.Unmarshal(s, &pl)
+}
+
+func (pl *PlanLayout) Value() (driver.Value, error) {
+	if pl == nil {
+		return nil, nil
+	}
+	j, err := json.Marshal(pl)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+// Playtest is a game session played by a user on a scenario, to dry-run its logic.
+// The rules are applied by the playtest package; the state of the game is stored as JSON.
+type Playtest struct {
+	ID         int64          `json:"id" db:"id"`
+	IDScenario int64          `json:"-" db:"id_scenario"`
+	IDUser     int64          `json:"-" db:"id_user"`
+	Created    time.Time      `json:"created" db:"created"`
+	Updated    time.Time      `json:"updated" db:"updated"`
+	State      *PlaytestState `json:"state" db:"state"`
+}
+
+// PlaytestState is what the players have achieved so far in a playtest.
+type PlaytestState struct {
+	Locations     []int64          `json:"revealed_locations"`
+	StateTokens   []int64          `json:"state_tokens"`
+	Elements      []int64          `json:"elements"` // In hand
+	UsedElements  []int64          `json:"used_elements"`
+	VisitedCards  []int64          `json:"visited_cards"`
+	PendingTests  []int64          `json:"pending_skill_tests"` // Of visited cards, not passed yet
+	PassedTests   []int64          `json:"passed_skill_tests"`
+	ResolvedCards []int64          `json:"resolved_cards"` // Visited cards whose effects were applied
+	Log           []*PlaytestEvent `json:"log"`
+}
+
+// PlaytestEvent is an entry of the log of a playtest.
+type PlaytestEvent struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	IDCard  int64     `json:"id_card,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Create a playtest of a scenario for a user, with an initial state.
+func CreatePlaytest(db gorp.SqlExecutor, scenar *Scenario, user *User, state *PlaytestState) (*Playtest, error) {
+	if db == nil || scenar == nil || user == nil || state == nil {
+		return nil, errors.New("Missing parameters to create playtest")
+	}
+
+	now := time.Now().UTC()
+
+	pt := &Playtest{
+		IDScenario: scenar.ID,
+		IDUser:     user.ID,
+		Created:    now,
+		Updated:    now,
+		State:      state,
+	}
+
+	err := db.Insert(pt)
+	if err != nil {
+		return nil, err
+	}
+
+	return pt, nil
+}
+
+// List playtests of a scenario. Optionally filtered by user.
+func ListPlaytests(db gorp.SqlExecutor, scenar *Scenario, user *User) ([]*Playtest, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to list playtests")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"playtest"`).Where(
+		squirrel.Eq{`id_scenario`: scenar.ID},
+	).OrderBy(`id`)
+
+	if user != nil {
+		selector = selector.Where(squirrel.Eq{`id_user`: user.ID})
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var pt []*Playtest
+
+	_, err = db.Select(&pt, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pt, nil
+}
+
+// Load a user's playtest of a scenario by ID.
+func LoadPlaytestFromID(db gorp.SqlExecutor, scenar *Scenario, user *User, ID int64) (*Playtest, error) {
+	if db == nil || scenar == nil || user == nil {
+		return nil, errors.New("Missing parameters to load playtest")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"playtest"`).Where(
+		squirrel.And{
+			squirrel.Eq{`id`: ID},
+			squirrel.Eq{`id_scenario`: scenar.ID},
+			squirrel.Eq{`id_user`: user.ID},
+		},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var pt Playtest
+
+	err = db.SelectOne(&pt, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pt, nil
+}
+
+// Save the current state of a playtest.
+func (pt *Playtest) Update(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to update playtest")
+	}
+
+	pt.Updated = time.Now().UTC()
+
+	rows, err := db.Update(pt)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such playtest to update")
+	}
+
+	return nil
+}
+
+// Delete a playtest.
+func (pt *Playtest) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete playtest")
+	}
+
+	rows, err := db.Delete(pt)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such playtest to delete")
+	}
+
+	return nil
+}
+
+func (ps *PlaytestState) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, ps)
+	case string:
+		return json.Unmarshal([]byte(v), ps)
+	}
+	return fmt.Errorf("Cannot scan %T into playtest state", value)
+}
+
+func (ps *PlaytestState) Value() (driver.Value, error) {
+	if ps == nil {
+		return nil, nil
+	}
+	j, err := json.Marshal(ps)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
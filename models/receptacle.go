@@ -0,0 +1,361 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+const (
+	MAX_STAT_VALUE  = 20 // Dice rolled in a skill test, see analysis.MAX_DICE
+	MAX_LIFE_POINTS = 99
+)
+
+// Receptacle represents a character card, that players embody during a run.
+// It has life points, a special ability, and a value for each of the scenario's Stats,
+// which is the number of dice rolled in skill tests of that Stat.
+// The code managing Receptacle objects will create CardIcon objects for each stat value
+// and link them to the Card, in a column on its Front with the value as annotation.
+type Receptacle struct {
+	ID         int64             `json:"id" db:"id"`
+	IDScenario int64             `json:"-" db:"id_scenario"`
+	Name       string            `json:"name" db:"name"`
+	LifePoints uint              `json:"life_points" db:"life_points"`
+	Ability    string            `json:"ability" db:"ability"`
+	IDCard     int64             `json:"id_card" db:"id_card"`
+	Stats      []*ReceptacleStat `json:"stats" db:"-"` // Filled when loading
+}
+
+// ReceptacleStat is the value of a Stat for a Receptacle.
+type ReceptacleStat struct {
+	ID           int64 `json:"-" db:"id"`
+	IDReceptacle int64 `json:"-" db:"id_receptacle"`
+	IDStat       int64 `json:"id_stat" db:"id_stat"`
+	Value        uint  `json:"value" db:"value"`
+}
+
+// Create a receptacle, with its stat values.
+// This will also create CardIcon objects on the Front of its Card, for each stat.
+func CreateReceptacle(db gorp.SqlExecutor, scenar *Scenario, Name string, LifePoints uint, Ability string, Stats []*ReceptacleStat) (*Receptacle, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to create receptacle")
+	}
+
+	card, err := CreateCard(db, scenar, CardTypeReceptacle, 0, receptacleCardDesc(Name), &CardFace{}, &CardFace{}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Receptacle{
+		IDScenario: scenar.ID,
+		Name:       Name,
+		LifePoints: LifePoints,
+		Ability:    Ability,
+		IDCard:     card.ID,
+	}
+
+	err = r.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Insert(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.setStats(db, card, Stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func receptacleCardDesc(Name string) string {
+	return fmt.Sprintf("Receptacle %s", Name)
+}
+
+// Create the stat values of a receptacle, and their CardIcons.
+func (r *Receptacle) setStats(db gorp.SqlExecutor, card *Card, Stats []*ReceptacleStat) error {
+
+	for _, rs := range Stats {
+		if rs == nil {
+			return errors.New("Missing receptacle stat value")
+		}
+		err := rs.Valid()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Place icons in a stable order
+	sort.Slice(Stats, func(i, j int) bool { return Stats[i].IDStat < Stats[j].IDStat })
+
+	r.Stats = []*ReceptacleStat{}
+
+	var offsetY uint
+	for _, rs := range Stats {
+		stat, err := LoadStatFromID(db, &Scenario{ID: r.IDScenario}, rs.IDStat)
+		if err != nil {
+			return err
+		}
+		for _, prev := range r.Stats {
+			if prev.IDStat == stat.ID {
+				return fmt.Errorf("Duplicate value for stat %s", stat.Name)
+			}
+		}
+
+		rs.ID = 0
+		rs.IDReceptacle = r.ID
+		err = db.Insert(rs)
+		if err != nil {
+			return err
+		}
+		r.Stats = append(r.Stats, rs)
+
+		ico, err := LoadIconFromID(db, nil, stat.IDIcon)
+		if err != nil {
+			return err
+		}
+		_, err = card.CreateCardIcon(db, ico, true, /* FRONT */
+			0, offsetY, DEFAULT_SIZE_X, DEFAULT_SIZE_Y,
+			strconv.FormatUint(uint64(rs.Value), 10), AnnotationTypeSquare, nil, nil, rs, nil)
+		if err != nil {
+			return err
+		}
+		offsetY += DEFAULT_SIZE_Y
+	}
+
+	return nil
+}
+
+// Delete the stat values of a receptacle, and their CardIcons.
+func (r *Receptacle) deleteStats(db gorp.SqlExecutor, card *Card) error {
+
+	stats, err := r.ListStats(db)
+	if err != nil {
+		return err
+	}
+
+	for _, rs := range stats {
+		icons, err := card.ListCardIcons(db, nil, nil, rs, nil)
+		if err != nil {
+			return err
+		}
+		for _, ci := range icons {
+			// Not ci.Delete(), which refuses to delete auto-generated icons
+			_, err := db.Delete(ci)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = db.Delete(rs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// List a receptacle's stat values.
+func (r *Receptacle) ListStats(db gorp.SqlExecutor) ([]*ReceptacleStat, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to list receptacle stats")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"receptacle_stat"`).Where(
+		squirrel.Eq{`id_receptacle`: r.ID},
+	).OrderBy(`id_stat`).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rs []*ReceptacleStat
+
+	_, err = db.Select(&rs, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// Value of a stat for a receptacle, 0 if it has none.
+func (r *Receptacle) StatValue(IDStat int64) uint {
+	for _, rs := range r.Stats {
+		if rs.IDStat == IDStat {
+			return rs.Value
+		}
+	}
+	return 0
+}
+
+// List receptacles, optionally filtered by scenario. Their stats are filled.
+func ListReceptacles(db gorp.SqlExecutor, scenar *Scenario) ([]*Receptacle, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to list receptacles")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"receptacle"`)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r []*Receptacle
+
+	_, err = db.Select(&r, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rec := range r {
+		rec.Stats, err = rec.ListStats(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Load receptacle by ID, with its stats. Optional scenario filter.
+func LoadReceptacleFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Receptacle, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load receptacle")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"receptacle"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r Receptacle
+
+	err = db.SelectOne(&r, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Stats, err = r.ListStats(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Update a receptacle. Its stat values are replaced, and their CardIcons recreated.
+func (r *Receptacle) Update(db gorp.SqlExecutor, Name string, LifePoints uint, Ability string, Stats []*ReceptacleStat) error {
+	if db == nil {
+		return errors.New("Missing db parameter to update receptacle")
+	}
+
+	r.Name = Name
+	r.LifePoints = LifePoints
+	r.Ability = Ability
+
+	err := r.Valid()
+	if err != nil {
+		return err
+	}
+
+	// Update linked card description
+	card, err := LoadCardFromID(db, nil, r.IDCard)
+	if err != nil {
+		return err
+	}
+	err = card.Update(db, card.Number, receptacleCardDesc(Name), card.Front, card.Back, card.TUCost)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Update(r)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such receptacle to update")
+	}
+
+	err = r.deleteStats(db, card)
+	if err != nil {
+		return err
+	}
+
+	return r.setStats(db, card, Stats)
+}
+
+// Delete a receptacle, with its stat values and its card.
+func (r *Receptacle) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete receptacle")
+	}
+
+	card, err := LoadCardFromID(db, nil, r.IDCard)
+	if err != nil {
+		return err
+	}
+
+	err = r.deleteStats(db, card)
+	if err != nil {
+		return err
+	}
+
+	err = card.Delete(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Delete(r)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such receptacle to delete")
+	}
+
+	return nil
+}
+
+func (r *Receptacle) Valid() error {
+	if r.Name == "" {
+		return errors.New("Missing receptacle name")
+	}
+	if r.LifePoints > MAX_LIFE_POINTS {
+		return fmt.Errorf("Too many life points: max %d", MAX_LIFE_POINTS)
+	}
+	return nil
+}
+
+func (rs *ReceptacleStat) Valid() error {
+	if rs.Value > MAX_STAT_VALUE {
+		return fmt.Errorf("Stat value too high: max %d", MAX_STAT_VALUE)
+	}
+	return nil
+}
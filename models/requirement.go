@@ -0,0 +1,840 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+const (
+	// Requirement expression operators
+	RequirementAnd     = "and"
+	RequirementOr      = "or"
+	RequirementNot     = "not"
+	RequirementToken   = "token"
+	RequirementElement = "element"
+
+	MAX_REQUIREMENT_DEPTH  = 8
+	MAX_REQUIREMENT_LEAVES = 12 // Satisfiability is checked on all the combinations of leaves
+
+	// Icons of a requirement are laid out in rows, wrapping at MAX_X_COORD
+	REQUIREMENT_ICONS_PER_ROW = MAX_X_COORD / DEFAULT_SIZE_X
+	MAX_REQUIREMENT_ROWS      = 3
+	MAX_REQUIREMENT_ICONS     = REQUIREMENT_ICONS_PER_ROW * MAX_REQUIREMENT_ROWS
+)
+
+// Requirement is a condition on state tokens and elements that must hold to access a card,
+// e.g. "token A and not token B", or "token A or element 12".
+// It complements StateTokenLink, which can only express a single required token.
+// The code managing Requirement objects will create CardIcon objects laying out the expression
+// on the Back of the card, on the rows below the state token icons.
+type Requirement struct {
+	ID         int64            `json:"id" db:"id"`
+	IDScenario int64            `json:"-" db:"id_scenario"`
+	IDCard     int64            `json:"id_card" db:"id_card"`
+	Expression *RequirementExpr `json:"expression" db:"expression"`
+}
+
+// RequirementExpr is a node of a requirement expression.
+// "and", "or" and "not" nodes have operands (exactly one for "not"),
+// "token" and "element" leaves reference a state token or an element.
+// It is stored as JSON, like CardFace.
+type RequirementExpr struct {
+	Op           string             `json:"op"`
+	Operands     []*RequirementExpr `json:"operands,omitempty"`
+	IDStateToken int64              `json:"id_state_token,omitempty"`
+	IDElement    int64              `json:"id_element,omitempty"`
+}
+
+// Create the requirement of a card. A card has at most one requirement.
+// The expression is checked against the scenario: it must only reference its state tokens
+// and elements, be satisfiable, and not depend on what the card itself gives.
+func CreateRequirement(db gorp.SqlExecutor, card *Card, Expression *RequirementExpr) (*Requirement, error) {
+	if db == nil || card == nil || Expression == nil {
+		return nil, errors.New("Missing parameters to create requirement")
+	}
+
+	_, err := LoadRequirementFromCard(db, card)
+	if err == nil {
+		return nil, errors.New("Card already has a requirement")
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	r := &Requirement{
+		IDScenario: card.IDScenario,
+		IDCard:     card.ID,
+		Expression: Expression,
+	}
+
+	err = r.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.check(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Insert(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.addIcons(db, card)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// List requirements, optionally filtered by scenario.
+func ListRequirements(db gorp.SqlExecutor, scenar *Scenario) ([]*Requirement, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to list requirements")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"requirement"`)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r []*Requirement
+
+	_, err = db.Select(&r, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// List the requirements referencing a state token or an element, optionally filtered by scenario.
+func listReferencingRequirements(db gorp.SqlExecutor, scenar *Scenario, op string, ID int64) ([]*Requirement, error) {
+	reqs, err := ListRequirements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Requirement{}
+	for _, r := range reqs {
+		for _, l := range r.Expression.leaves() {
+			if l.op == op && l.ID == ID {
+				ret = append(ret, r)
+				break
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// Load requirement by ID. Optional scenario filter.
+func LoadRequirementFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Requirement, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load requirement")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"requirement"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
+
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		)
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var r Requirement
+
+	err = db.SelectOne(&r, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Load the requirement of a card. Returns sql.ErrNoRows if it has none.
+func LoadRequirementFromCard(db gorp.SqlExecutor, card *Card) (*Requirement, error) {
+	if db == nil || card == nil {
+		return nil, errors.New("Missing parameters to load card requirement")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"requirement"`).Where(
+		squirrel.Eq{`id_card`: card.ID},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var r Requirement
+
+	err = db.SelectOne(&r, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Update the expression of a requirement. Its CardIcons are recreated.
+func (r *Requirement) Update(db gorp.SqlExecutor, Expression *RequirementExpr) error {
+	if db == nil || Expression == nil {
+		return errors.New("Missing parameters to update requirement")
+	}
+
+	r.Expression = Expression
+
+	err := r.Valid()
+	if err != nil {
+		return err
+	}
+
+	err = r.check(db)
+	if err != nil {
+		return err
+	}
+
+	card, err := LoadCardFromID(db, nil, r.IDCard)
+	if err != nil {
+		return err
+	}
+
+	err = r.deleteIcons(db, card)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Update(r)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such requirement to update")
+	}
+
+	return r.addIcons(db, card)
+}
+
+// Delete a requirement, and its CardIcons.
+func (r *Requirement) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete requirement")
+	}
+
+	card, err := LoadCardFromID(db, nil, r.IDCard)
+	if err != nil {
+		return err
+	}
+
+	err = r.deleteIcons(db, card)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Delete(r)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such requirement to delete")
+	}
+
+	return nil
+}
+
+// Verify the structure of the expression.
+func (r *Requirement) Valid() error {
+	if r.Expression == nil {
+		return errors.New("Missing requirement expression")
+	}
+	err := r.Expression.valid(1)
+	if err != nil {
+		return err
+	}
+	if len(r.Expression.leaves()) > MAX_REQUIREMENT_LEAVES {
+		return fmt.Errorf("Requirement too long (max %d tokens/elements)", MAX_REQUIREMENT_LEAVES)
+	}
+	if len(r.Expression.layout()) > MAX_REQUIREMENT_ICONS {
+		return fmt.Errorf("Requirement too long to lay out on the card (max %d icons)", MAX_REQUIREMENT_ICONS)
+	}
+	return nil
+}
+
+func (e *RequirementExpr) valid(depth int) error {
+	if e == nil {
+		return errors.New("Empty requirement expression")
+	}
+	if depth > MAX_REQUIREMENT_DEPTH {
+		return fmt.Errorf("Requirement too deep (max %d levels)", MAX_REQUIREMENT_DEPTH)
+	}
+
+	switch e.Op {
+	case RequirementAnd, RequirementOr:
+		if len(e.Operands) < 2 {
+			return fmt.Errorf("Requirement %q needs at least 2 operands", e.Op)
+		}
+	case RequirementNot:
+		if len(e.Operands) != 1 {
+			return errors.New("Requirement \"not\" needs exactly 1 operand")
+		}
+	case RequirementToken:
+		if e.IDStateToken == 0 || len(e.Operands) > 0 {
+			return errors.New("Requirement \"token\" needs a state token and no operand")
+		}
+		return nil
+	case RequirementElement:
+		if e.IDElement == 0 || len(e.Operands) > 0 {
+			return errors.New("Requirement \"element\" needs an element and no operand")
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unknown requirement operator %q", e.Op)
+	}
+
+	for _, o := range e.Operands {
+		err := o.valid(depth + 1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requirementLeaf is a state token or an element referenced by an expression.
+type requirementLeaf struct {
+	op string
+	ID int64
+}
+
+func (e *RequirementExpr) leaf() requirementLeaf {
+	if e.Op == RequirementToken {
+		return requirementLeaf{RequirementToken, e.IDStateToken}
+	}
+	return requirementLeaf{RequirementElement, e.IDElement}
+}
+
+// Distinct leaves of the expression, in reading order.
+func (e *RequirementExpr) leaves() []requirementLeaf {
+	var ret []requirementLeaf
+	seen := make(map[requirementLeaf]bool)
+
+	var walk func(*RequirementExpr)
+	walk = func(n *RequirementExpr) {
+		if n.Op == RequirementToken || n.Op == RequirementElement {
+			if l := n.leaf(); !seen[l] {
+				seen[l] = true
+				ret = append(ret, l)
+			}
+			return
+		}
+		for _, o := range n.Operands {
+			walk(o)
+		}
+	}
+	walk(e)
+
+	return ret
+}
+
+// State tokens referenced by the expression, in reading order.
+func (e *RequirementExpr) StateTokens() []int64 {
+	return e.leafIDs(RequirementToken)
+}
+
+// Elements referenced by the expression, in reading order.
+func (e *RequirementExpr) Elements() []int64 {
+	return e.leafIDs(RequirementElement)
+}
+
+func (e *RequirementExpr) leafIDs(op string) []int64 {
+	ret := []int64{}
+	for _, l := range e.leaves() {
+		if l.op == op {
+			ret = append(ret, l.ID)
+		}
+	}
+	return ret
+}
+
+// Evaluate the expression, with the state tokens and elements held.
+func (e *RequirementExpr) Eval(tokens, elements map[int64]bool) bool {
+	return e.eval(func(l requirementLeaf) bool {
+		if l.op == RequirementToken {
+			return tokens[l.ID]
+		}
+		return elements[l.ID]
+	})
+}
+
+func (e *RequirementExpr) eval(held func(requirementLeaf) bool) bool {
+	switch e.Op {
+	case RequirementAnd:
+		for _, o := range e.Operands {
+			if !o.eval(held) {
+				return false
+			}
+		}
+		return true
+	case RequirementOr:
+		for _, o := range e.Operands {
+			if o.eval(held) {
+				return true
+			}
+		}
+		return false
+	case RequirementNot:
+		return !e.Operands[0].eval(held)
+	}
+	return held(e.leaf())
+}
+
+// Whether some combination of the leaves satisfies the expression.
+// Leaves in forced are false in every combination.
+func (e *RequirementExpr) satisfiable(forced map[requirementLeaf]bool) bool {
+	var free []requirementLeaf
+	for _, l := range e.leaves() {
+		if !forced[l] {
+			free = append(free, l)
+		}
+	}
+
+	for mask := 0; mask < 1<<uint(len(free)); mask++ {
+		held := make(map[requirementLeaf]bool)
+		for i, l := range free {
+			held[l] = mask&(1<<uint(i)) != 0
+		}
+		if e.eval(func(l requirementLeaf) bool { return held[l] }) {
+			return true
+		}
+	}
+	return false
+}
+
+// Format the expression, naming its leaves, e.g. "key AND NOT (element 12 OR torch)".
+func (e *RequirementExpr) Format(tokenName, elementName func(int64) string) string {
+	switch e.Op {
+	case RequirementAnd, RequirementOr:
+		parts := make([]string, len(e.Operands))
+		for i, o := range e.Operands {
+			parts[i] = o.Format(tokenName, elementName)
+			if o.Op == RequirementAnd || o.Op == RequirementOr {
+				parts[i] = "(" + parts[i] + ")"
+			}
+		}
+		return strings.Join(parts, " "+strings.ToUpper(e.Op)+" ")
+	case RequirementNot:
+		s := e.Operands[0].Format(tokenName, elementName)
+		if o := e.Operands[0]; o.Op == RequirementAnd || o.Op == RequirementOr {
+			s = "(" + s + ")"
+		}
+		return "NOT " + s
+	case RequirementToken:
+		return tokenName(e.IDStateToken)
+	}
+	return elementName(e.IDElement)
+}
+
+// Check the expression against the scenario: referenced objects, satisfiability, and cycles.
+func (r *Requirement) check(db gorp.SqlExecutor) error {
+	scenar := &Scenario{ID: r.IDScenario}
+
+	for _, l := range r.Expression.leaves() {
+		var err error
+		if l.op == RequirementToken {
+			_, err = LoadStateTokenFromID(db, scenar, l.ID)
+		} else {
+			_, err = LoadElementFromID(db, scenar, l.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("No such %s %d in scenario", l.op, l.ID)
+		}
+	}
+
+	if !r.Expression.satisfiable(nil) {
+		return errors.New("Requirement can never be met")
+	}
+
+	rules, err := loadAccessRules(db, scenar)
+	if err != nil {
+		return err
+	}
+	if rules.cyclic(r.IDCard, r.Expression) {
+		return errors.New("Requirement can only be met after accessing the card (cyclic dependency)")
+	}
+
+	return nil
+}
+
+// Whether the requirement of a card can only be met with tokens and elements obtained after accessing it.
+// Those cannot be used to access the card: compare what is obtainable when the card is freely
+// accessible with what is obtainable without it. The rule of the card is replaced.
+func (rules accessRules) cyclic(IDCard int64, e *RequirementExpr) bool {
+	free := &accessRule{}
+	if rules[IDCard] != nil {
+		free.gives = rules[IDCard].gives
+	}
+	rules[IDCard] = free
+	all := rules.obtainable(0)
+	without := rules.obtainable(IDCard)
+	after := make(map[requirementLeaf]bool)
+	for l := range all {
+		if !without[l] {
+			after[l] = true
+		}
+	}
+	return !e.satisfiable(after)
+}
+
+// List the requirements of a scenario that can never be met, because the state tokens
+// and elements they need cannot all be obtained from its cards and combinations.
+func ListUnmeetableRequirements(db gorp.SqlExecutor, scenar *Scenario) ([]*Requirement, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to list unmeetable requirements")
+	}
+
+	rules, err := loadAccessRules(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	held := rules.obtainable(0)
+
+	reqs, err := ListRequirements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Requirement{}
+	for _, r := range reqs {
+		if !r.Expression.possible(held) {
+			ret = append(ret, r)
+		}
+	}
+
+	return ret, nil
+}
+
+// accessRule is what a card requires, and what it gives once resolved.
+type accessRule struct {
+	requires    []requirementLeaf // State tokens unlocking it, elements it uses, element of an element card
+	requirement *RequirementExpr
+	gives       []requirementLeaf
+}
+
+type accessRules map[int64]*accessRule // By card, or by negated ID for element combinations
+
+func loadAccessRules(db gorp.SqlExecutor, scenar *Scenario) (accessRules, error) {
+	rules := make(accessRules)
+	rule := func(IDCard int64) *accessRule {
+		if rules[IDCard] == nil {
+			rules[IDCard] = &accessRule{}
+		}
+		return rules[IDCard]
+	}
+
+	tkLinks, err := ListStateTokenLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, tl := range tkLinks {
+		l := requirementLeaf{RequirementToken, tl.IDStateToken}
+		if tl.UnlocksUnlocked {
+			rule(tl.IDCard).gives = append(rule(tl.IDCard).gives, l)
+		} else {
+			rule(tl.IDCard).requires = append(rule(tl.IDCard).requires, l)
+		}
+	}
+
+	elemLinks, err := ListElementLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, el := range elemLinks {
+		l := requirementLeaf{RequirementElement, el.IDElement}
+		if el.GivesUses {
+			rule(el.IDCard).gives = append(rule(el.IDCard).gives, l)
+		} else {
+			rule(el.IDCard).requires = append(rule(el.IDCard).requires, l)
+		}
+	}
+
+	elems, err := ListElements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elems {
+		rule(e.IDCard).requires = append(rule(e.IDCard).requires, requirementLeaf{RequirementElement, e.ID})
+	}
+
+	reqs, err := ListRequirements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range reqs {
+		rule(req.IDCard).requirement = req.Expression
+	}
+
+	// Combinations are rules without a card, keyed by their negated ID
+	combinations, err := ListElementCombinations(db, scenar, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, ec := range combinations {
+		r := rule(-ec.ID)
+		for _, in := range ec.Inputs {
+			r.requires = append(r.requires, requirementLeaf{RequirementElement, in.IDElement})
+		}
+		r.gives = append(r.gives, requirementLeaf{RequirementElement, ec.IDElement})
+	}
+
+	return rules, nil
+}
+
+// State tokens and elements that can be obtained without accessing a card (0: all cards).
+// Not holding something is always possible, so negations never block access.
+func (rules accessRules) obtainable(excluded int64) map[requirementLeaf]bool {
+	held := make(map[requirementLeaf]bool)
+	resolved := make(map[int64]bool)
+
+	for changed := true; changed; {
+		changed = false
+	rules:
+		for IDCard, rule := range rules {
+			if IDCard == excluded || resolved[IDCard] {
+				continue
+			}
+			for _, l := range rule.requires {
+				if !held[l] {
+					continue rules
+				}
+			}
+			if rule.requirement != nil && !rule.requirement.possible(held) {
+				continue
+			}
+			resolved[IDCard] = true
+			for _, l := range rule.gives {
+				if !held[l] {
+					held[l] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	return held
+}
+
+// Whether the expression can be true, holding at most the given state tokens and elements.
+// Unlike Eval, negations never block: not holding something is always possible.
+func (e *RequirementExpr) Possible(tokens, elements map[int64]bool) bool {
+	held := make(map[requirementLeaf]bool)
+	for _, l := range e.leaves() {
+		if l.op == RequirementToken {
+			held[l] = tokens[l.ID]
+		} else {
+			held[l] = elements[l.ID]
+		}
+	}
+	return e.possible(held)
+}
+
+// Whether the expression can be true, holding at most the given leaves.
+func (e *RequirementExpr) possible(held map[requirementLeaf]bool) bool {
+	switch e.Op {
+	case RequirementAnd:
+		for _, o := range e.Operands {
+			if !o.possible(held) {
+				return false
+			}
+		}
+		return true
+	case RequirementOr:
+		for _, o := range e.Operands {
+			if o.possible(held) {
+				return true
+			}
+		}
+		return false
+	case RequirementNot:
+		return !e.Operands[0].necessary(held)
+	}
+	return held[e.leaf()]
+}
+
+// Whether the expression is true, whatever is held among the given leaves.
+func (e *RequirementExpr) necessary(held map[requirementLeaf]bool) bool {
+	switch e.Op {
+	case RequirementAnd:
+		for _, o := range e.Operands {
+			if !o.necessary(held) {
+				return false
+			}
+		}
+		return true
+	case RequirementOr:
+		for _, o := range e.Operands {
+			if o.necessary(held) {
+				return true
+			}
+		}
+		return false
+	case RequirementNot:
+		return !e.Operands[0].possible(held)
+	}
+	return false
+}
+
+// requirementIcon is an icon of the layout of an expression: either a base icon (operators,
+// grouping), or a leaf.
+type requirementIcon struct {
+	base string
+	leaf *RequirementExpr
+}
+
+// Icons of the expression in reading order: state token icons, element icons,
+// a "not" icon before negated operands, "or" icons between alternatives, and
+// grouping icons around nested "and"/"or" operands, like the parentheses of Format.
+func (e *RequirementExpr) layout() []requirementIcon {
+	var ret []requirementIcon
+
+	var walk func(*RequirementExpr)
+	operand := func(o *RequirementExpr) {
+		if o.Op == RequirementAnd || o.Op == RequirementOr {
+			ret = append(ret, requirementIcon{base: GROUP_START_ICON})
+			walk(o)
+			ret = append(ret, requirementIcon{base: GROUP_END_ICON})
+			return
+		}
+		walk(o)
+	}
+	walk = func(e *RequirementExpr) {
+		switch e.Op {
+		case RequirementAnd, RequirementOr:
+			for i, o := range e.Operands {
+				if i > 0 && e.Op == RequirementOr {
+					ret = append(ret, requirementIcon{base: OR_ICON})
+				}
+				operand(o)
+			}
+		case RequirementNot:
+			ret = append(ret, requirementIcon{base: NOT_ICON})
+			operand(e.Operands[0])
+		default:
+			ret = append(ret, requirementIcon{leaf: e})
+		}
+	}
+	walk(e)
+
+	return ret
+}
+
+// Position of the i-th icon of a layout on the back of a card: rows of REQUIREMENT_ICONS_PER_ROW,
+// starting below the state token icons.
+func requirementIconPosition(i int) (uint, uint) {
+	return uint(i%REQUIREMENT_ICONS_PER_ROW) * DEFAULT_SIZE_X, uint(1+i/REQUIREMENT_ICONS_PER_ROW) * DEFAULT_SIZE_Y
+}
+
+// Lay out the expression as CardIcons on the back of the card (see layout).
+// Element icons are annotated with the element number.
+func (r *Requirement) addIcons(db gorp.SqlExecutor, card *Card) error {
+	scenar := &Scenario{ID: r.IDScenario}
+
+	for i, ri := range r.Expression.layout() {
+		var ico *Icon
+		var annot string
+		var annotType int
+		var err error
+
+		switch {
+		case ri.base != "":
+			ico, err = LoadBaseIconFromShortName(db, ri.base)
+		case ri.leaf.Op == RequirementToken:
+			var tk *StateToken
+			tk, err = LoadStateTokenFromID(db, scenar, ri.leaf.IDStateToken)
+			if err != nil {
+				return err
+			}
+			ico, err = LoadIconFromID(db, nil, tk.IDIcon)
+		default:
+			var elem *Element
+			elem, err = LoadElementFromID(db, scenar, ri.leaf.IDElement)
+			if err != nil {
+				return err
+			}
+			ico, err = LoadBaseIconFromShortName(db, ELEMENT_ICON)
+			annot, annotType = strconv.Itoa(elem.Number), AnnotationTypeSquare
+		}
+		if err != nil {
+			return err
+		}
+
+		x, y := requirementIconPosition(i)
+		_, err = card.CreateCardIcon(db, ico, false, /* BACK */
+			x, y, DEFAULT_SIZE_X, DEFAULT_SIZE_Y, annot, annotType, nil, nil, nil, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Requirement) deleteIcons(db gorp.SqlExecutor, card *Card) error {
+	icons, err := card.ListCardIcons(db, nil, nil, nil, r)
+	if err != nil {
+		return err
+	}
+	for _, ci := range icons {
+		// Not ci.Delete(), which refuses to delete auto-generated icons
+		_, err := db.Delete(ci)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *RequirementExpr) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	s := value.([]byte)
+	return json.Unmarshal(s, &e)
+}
+
+func (e *RequirementExpr) Value() (driver.Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	j, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
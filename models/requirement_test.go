@@ -0,0 +1,250 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func reqToken(ID int64) *RequirementExpr {
+	return &RequirementExpr{Op: RequirementToken, IDStateToken: ID}
+}
+
+func reqElement(ID int64) *RequirementExpr {
+	return &RequirementExpr{Op: RequirementElement, IDElement: ID}
+}
+
+func reqOp(op string, operands ...*RequirementExpr) *RequirementExpr {
+	return &RequirementExpr{Op: op, Operands: operands}
+}
+
+// An "or" of count tokens, each negated depth times.
+func reqNegatedTokens(count int, depth int) *RequirementExpr {
+	or := reqOp(RequirementOr)
+	for i := 1; i <= count; i++ {
+		e := reqToken(int64(i))
+		for j := 0; j < depth; j++ {
+			e = reqOp(RequirementNot, e)
+		}
+		or.Operands = append(or.Operands, e)
+	}
+	return or
+}
+
+func TestRequirementValid(t *testing.T) {
+	deep := reqToken(1)
+	for i := 0; i < MAX_REQUIREMENT_DEPTH; i++ {
+		deep = reqOp(RequirementNot, deep)
+	}
+
+	tests := []struct {
+		name string
+		expr *RequirementExpr
+		err  string // Expected error prefix, empty if valid
+	}{
+		{"token", reqToken(1), ""},
+		{"and", reqOp(RequirementAnd, reqToken(1), reqElement(2)), ""},
+		{"nested", reqOp(RequirementOr, reqToken(1), reqOp(RequirementAnd, reqToken(2), reqOp(RequirementNot, reqElement(3)))), ""},
+		{"missing expression", nil, "Missing requirement expression"},
+		{"unknown operator", &RequirementExpr{Op: "xor"}, "Unknown requirement operator"},
+		{"single operand", reqOp(RequirementAnd, reqToken(1)), "Requirement \"and\" needs at least 2 operands"},
+		{"not with two operands", reqOp(RequirementNot, reqToken(1), reqToken(2)), "Requirement \"not\" needs exactly 1 operand"},
+		{"token without ID", reqToken(0), "Requirement \"token\" needs a state token"},
+		{"element with operands", &RequirementExpr{Op: RequirementElement, IDElement: 1, Operands: []*RequirementExpr{reqToken(1)}}, "Requirement \"element\" needs an element"},
+		{"nil operand", reqOp(RequirementAnd, reqToken(1), nil), "Empty requirement expression"},
+		{"too deep", deep, "Requirement too deep"},
+		{"too many leaves", reqNegatedTokens(MAX_REQUIREMENT_LEAVES+1, 0), "Requirement too long (max"},
+		{"or of 9 tokens", reqNegatedTokens(9, 0), ""},
+		{"too many icons", reqNegatedTokens(MAX_REQUIREMENT_LEAVES, 3), "Requirement too long to lay out"},
+	}
+
+	for _, tt := range tests {
+		err := (&Requirement{Expression: tt.expr}).Valid()
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+			t.Errorf("%s: got error %v, expected %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRequirementLayout(t *testing.T) {
+	// Icons as text: t<ID>, e<ID>, or, not, ( and )
+	format := func(icons []requirementIcon) string {
+		var parts []string
+		for _, ri := range icons {
+			switch {
+			case ri.base == GROUP_START_ICON:
+				parts = append(parts, "(")
+			case ri.base == GROUP_END_ICON:
+				parts = append(parts, ")")
+			case ri.base != "":
+				parts = append(parts, ri.base)
+			case ri.leaf.Op == RequirementToken:
+				parts = append(parts, fmt.Sprintf("t%d", ri.leaf.IDStateToken))
+			default:
+				parts = append(parts, fmt.Sprintf("e%d", ri.leaf.IDElement))
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+
+	tests := []struct {
+		name   string
+		expr   *RequirementExpr
+		layout string
+	}{
+		{"token", reqToken(1), "t1"},
+		{"and", reqOp(RequirementAnd, reqToken(1), reqElement(2)), "t1 e2"},
+		{"or", reqOp(RequirementOr, reqToken(1), reqToken(2), reqToken(3)), "t1 or t2 or t3"},
+		{"not", reqOp(RequirementNot, reqToken(1)), "not t1"},
+		{"not of and", reqOp(RequirementNot, reqOp(RequirementAnd, reqToken(1), reqToken(2))), "not ( t1 t2 )"},
+		{"or of and", reqOp(RequirementOr, reqToken(1), reqOp(RequirementAnd, reqToken(2), reqToken(3))), "t1 or ( t2 t3 )"},
+		{"and of or", reqOp(RequirementAnd, reqOp(RequirementOr, reqToken(1), reqToken(2)), reqToken(3)), "( t1 or t2 ) t3"},
+		{"negated operands", reqOp(RequirementOr, reqOp(RequirementNot, reqToken(1)), reqElement(2)), "not t1 or e2"},
+	}
+
+	for _, tt := range tests {
+		if got := format(tt.expr.layout()); got != tt.layout {
+			t.Errorf("%s: got layout %q, expected %q", tt.name, got, tt.layout)
+		}
+	}
+
+	// Icons wrap onto further rows, below the state token icons
+	positions := []struct {
+		i    int
+		x, y uint
+	}{
+		{0, 0, DEFAULT_SIZE_Y},
+		{1, DEFAULT_SIZE_X, DEFAULT_SIZE_Y},
+		{REQUIREMENT_ICONS_PER_ROW - 1, MAX_X_COORD - DEFAULT_SIZE_X, DEFAULT_SIZE_Y},
+		{REQUIREMENT_ICONS_PER_ROW, 0, 2 * DEFAULT_SIZE_Y},
+		{MAX_REQUIREMENT_ICONS - 1, MAX_X_COORD - DEFAULT_SIZE_X, MAX_REQUIREMENT_ROWS * DEFAULT_SIZE_Y},
+	}
+	for _, p := range positions {
+		x, y := requirementIconPosition(p.i)
+		if x != p.x || y != p.y {
+			t.Errorf("icon %d: got position %d,%d, expected %d,%d", p.i, x, y, p.x, p.y)
+		}
+		if x+DEFAULT_SIZE_X > MAX_X_COORD || y+DEFAULT_SIZE_Y > MAX_Y_COORD {
+			t.Errorf("icon %d: position %d,%d out of the card", p.i, x, y)
+		}
+	}
+}
+
+func TestRequirementEval(t *testing.T) {
+	expr := reqOp(RequirementAnd, reqToken(1), reqOp(RequirementNot, reqOp(RequirementOr, reqToken(2), reqElement(3))))
+
+	tests := []struct {
+		name             string
+		tokens, elements map[int64]bool
+		eval, possible   bool
+	}{
+		{"nothing", nil, nil, false, false},
+		{"required token", map[int64]bool{1: true}, nil, true, true},
+		{"negated token", map[int64]bool{1: true, 2: true}, nil, false, true},
+		{"negated element", map[int64]bool{1: true}, map[int64]bool{3: true}, false, true},
+		{"negated only", map[int64]bool{2: true}, map[int64]bool{3: true}, false, false},
+	}
+
+	for _, tt := range tests {
+		if got := expr.Eval(tt.tokens, tt.elements); got != tt.eval {
+			t.Errorf("%s: got eval %v, expected %v", tt.name, got, tt.eval)
+		}
+		if got := expr.Possible(tt.tokens, tt.elements); got != tt.possible {
+			t.Errorf("%s: got possible %v, expected %v", tt.name, got, tt.possible)
+		}
+	}
+
+	if !reflect.DeepEqual(expr.StateTokens(), []int64{1, 2}) || !reflect.DeepEqual(expr.Elements(), []int64{3}) {
+		t.Errorf("got leaves %v %v", expr.StateTokens(), expr.Elements())
+	}
+}
+
+func TestRequirementSatisfiable(t *testing.T) {
+	tests := []struct {
+		name   string
+		expr   *RequirementExpr
+		forced []requirementLeaf
+		sat    bool
+	}{
+		{"token", reqToken(1), nil, true},
+		{"contradiction", reqOp(RequirementAnd, reqToken(1), reqOp(RequirementNot, reqToken(1))), nil, false},
+		{"tautology", reqOp(RequirementOr, reqToken(1), reqOp(RequirementNot, reqToken(1))), nil, true},
+		{"forced token", reqToken(1), []requirementLeaf{{RequirementToken, 1}}, false},
+		{"forced alternative", reqOp(RequirementOr, reqToken(1), reqElement(1)), []requirementLeaf{{RequirementToken, 1}}, true},
+		{"forced negation", reqOp(RequirementNot, reqToken(1)), []requirementLeaf{{RequirementToken, 1}}, true},
+	}
+
+	for _, tt := range tests {
+		forced := make(map[requirementLeaf]bool)
+		for _, l := range tt.forced {
+			forced[l] = true
+		}
+		if got := tt.expr.satisfiable(forced); got != tt.sat {
+			t.Errorf("%s: got satisfiable %v, expected %v", tt.name, got, tt.sat)
+		}
+	}
+}
+
+// Card 1 gives token 1, card 2 needs it and gives element 5, card 3 needs token 9 (never given)
+// and gives token 2, card 4 requires not holding token 1 and gives token 3.
+// Combining elements 5 and 6 (never given) gives element 7.
+func testAccessRules() accessRules {
+	tk := func(ID int64) requirementLeaf { return requirementLeaf{RequirementToken, ID} }
+	el := func(ID int64) requirementLeaf { return requirementLeaf{RequirementElement, ID} }
+	return accessRules{
+		1:  {gives: []requirementLeaf{tk(1)}},
+		2:  {requires: []requirementLeaf{tk(1)}, gives: []requirementLeaf{el(5)}},
+		3:  {requires: []requirementLeaf{tk(9)}, gives: []requirementLeaf{tk(2)}},
+		4:  {requirement: reqOp(RequirementNot, reqToken(1)), gives: []requirementLeaf{tk(3)}},
+		-1: {requires: []requirementLeaf{el(5), el(6)}, gives: []requirementLeaf{el(7)}},
+	}
+}
+
+func TestAccessRulesObtainable(t *testing.T) {
+	tests := []struct {
+		name     string
+		excluded int64
+		held     []requirementLeaf
+	}{
+		{"all cards", 0, []requirementLeaf{{RequirementToken, 1}, {RequirementToken, 3}, {RequirementElement, 5}}},
+		{"without the giving card", 1, []requirementLeaf{{RequirementToken, 3}}},
+		{"without a dependent card", 2, []requirementLeaf{{RequirementToken, 1}, {RequirementToken, 3}}},
+	}
+
+	for _, tt := range tests {
+		expected := make(map[requirementLeaf]bool)
+		for _, l := range tt.held {
+			expected[l] = true
+		}
+		if got := testAccessRules().obtainable(tt.excluded); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: got %v, expected %v", tt.name, got, expected)
+		}
+	}
+}
+
+func TestAccessRulesCyclic(t *testing.T) {
+	tests := []struct {
+		name   string
+		IDCard int64
+		expr   *RequirementExpr
+		cyclic bool
+	}{
+		{"token given by another card", 2, reqToken(1), false},
+		{"token given by the card", 1, reqToken(1), true},
+		{"element given after the card", 1, reqElement(5), true},
+		{"alternative given by another card", 1, reqOp(RequirementOr, reqElement(5), reqToken(3)), false},
+		{"negation of what the card gives", 1, reqOp(RequirementNot, reqToken(1)), false},
+		{"new card", 5, reqToken(1), false},
+		{"never given", 5, reqToken(9), false}, // Not obtainable at all: not a cycle
+	}
+
+	for _, tt := range tests {
+		if got := testAccessRules().cyclic(tt.IDCard, tt.expr); got != tt.cyclic {
+			t.Errorf("%s: got cyclic %v, expected %v", tt.name, got, tt.cyclic)
+		}
+	}
+}
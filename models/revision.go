@@ -0,0 +1,572 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/blobstore"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+const (
+	RevisionCreate = "create"
+	RevisionUpdate = "update"
+	RevisionDelete = "delete"
+
+	// Kinds of batches, see Undo/Redo
+	BatchEdit = "edit"
+	BatchUndo = "undo"
+	BatchRedo = "redo"
+)
+
+// Revision records a mutation of a scenario object: its state before and after,
+// as JSON objects of its database columns (null for creations/deletions).
+// All the revisions recorded during the same API request share a batch ID.
+// Undo/redo batches reference the batch they undo/redo as their target.
+type Revision struct {
+	ID         int64     `json:"id" db:"id"`
+	IDScenario int64     `json:"-" db:"id_scenario"`
+	IDUser     int64     `json:"-" db:"id_user"`
+	IDSession  int64     `json:"-" db:"id_session"`
+	Batch      string    `json:"batch" db:"batch"`
+	Kind       string    `json:"kind" db:"kind"`
+	Target     string    `json:"target,omitempty" db:"target"`
+	Created    time.Time `json:"created" db:"created"`
+	ObjectType string    `json:"object_type" db:"object_type"`
+	IDObject   int64     `json:"id_object" db:"id_object"`
+	Action     string    `json:"action" db:"action"`
+	Before     RowData   `json:"before" db:"before"`
+	After      RowData   `json:"after" db:"after"`
+	Author     string    `json:"author" db:"-"` // Email of the user, filled when listing
+}
+
+// RowData is the JSON state of an object in a revision. It is nil (NULL) when there is no state,
+// i.e. before a creation or after a deletion.
+type RowData []byte
+
+func (d *RowData) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = nil
+	case []byte:
+		*d = append(RowData{}, v...)
+	case string:
+		*d = RowData(v)
+	default:
+		return fmt.Errorf("Cannot scan %T into revision data", value)
+	}
+	return nil
+}
+
+func (d RowData) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	return string(d), nil
+}
+
+func (d RowData) MarshalJSON() ([]byte, error) {
+	if d == nil {
+		return []byte("null"), nil
+	}
+	return d, nil
+}
+
+// trackedType describes a model whose mutations are recorded.
+type trackedType struct {
+	table string
+	// Scenario an object belongs to. 0 means the object is not tracked (e.g. base game objects).
+	scenario func(db gorp.SqlExecutor, obj interface{}) (int64, error)
+}
+
+func ownScenario(db gorp.SqlExecutor, obj interface{}) (int64, error) {
+	return Columns(obj)["id_scenario"].Int(), nil
+}
+
+var trackedTypes = map[reflect.Type]*trackedType{
+	reflect.TypeOf(Card{}): {table: "card", scenario: ownScenario},
+	reflect.TypeOf(CardIcon{}): {table: "card_icon", scenario: func(db gorp.SqlExecutor, obj interface{}) (int64, error) {
+		c, err := LoadCardFromID(db, nil, obj.(*CardIcon).IDCard)
+		if err != nil {
+			return 0, err
+		}
+		return c.IDScenario, nil
+	}},
+	reflect.TypeOf(Location{}): {table: "location", scenario: ownScenario},
+	reflect.TypeOf(LocationCard{}): {table: "location_card", scenario: func(db gorp.SqlExecutor, obj interface{}) (int64, error) {
+		loc, err := LoadLocationFromID(db, nil, obj.(*LocationCard).IDLocation)
+		if err != nil {
+			return 0, err
+		}
+		return loc.IDScenario, nil
+	}},
+	reflect.TypeOf(Element{}):        {table: "element", scenario: ownScenario},
+	reflect.TypeOf(Receptacle{}):     {table: "receptacle", scenario: ownScenario},
+	reflect.TypeOf(Requirement{}):    {table: "requirement", scenario: ownScenario},
+	reflect.TypeOf(MissionSuccess{}): {table: "mission_success", scenario: ownScenario},
+	reflect.TypeOf(Codex{}):          {table: "codex", scenario: ownScenario},
+	reflect.TypeOf(Plan{}):           {table: "plan", scenario: ownScenario},
+	reflect.TypeOf(ReceptacleStat{}): {table: "receptacle_stat", scenario: func(db gorp.SqlExecutor, obj interface{}) (int64, error) {
+		r, err := LoadReceptacleFromID(db, nil, obj.(*ReceptacleStat).IDReceptacle)
+		if err != nil {
+			return 0, err
+		}
+		return r.IDScenario, nil
+	}},
+	reflect.TypeOf(ElementLink{}):        {table: "element_link", scenario: ownScenario},
+	reflect.TypeOf(ElementCombination{}): {table: "element_combination", scenario: ownScenario},
+	reflect.TypeOf(ElementCombinationInput{}): {table: "element_combination_input", scenario: func(db gorp.SqlExecutor, obj interface{}) (int64, error) {
+		ec, err := LoadElementCombinationFromID(db, nil, obj.(*ElementCombinationInput).IDCombination)
+		if err != nil {
+			return 0, err
+		}
+		return ec.IDScenario, nil
+	}},
+	reflect.TypeOf(LocationLink{}):   {table: "location_link", scenario: ownScenario},
+	reflect.TypeOf(StateTokenLink{}): {table: "state_token_link", scenario: ownScenario},
+	reflect.TypeOf(SkillTest{}):      {table: "skill_test", scenario: ownScenario},
+	reflect.TypeOf(StateToken{}): {table: "state_token", scenario: func(db gorp.SqlExecutor, obj interface{}) (int64, error) {
+		tk := obj.(*StateToken)
+		if tk.IDScenario == nil {
+			return 0, nil
+		}
+		return *tk.IDScenario, nil
+	}},
+	reflect.TypeOf(Stat{}): {table: "stat", scenario: ownScenario},
+}
+
+func trackedTypeOf(obj interface{}) *trackedType {
+	t := reflect.TypeOf(obj)
+	if t.Kind() != reflect.Ptr {
+		return nil
+	}
+	return trackedTypes[t.Elem()]
+}
+
+func trackedTypeFromTable(table string) (reflect.Type, *trackedType) {
+	for t, tt := range trackedTypes {
+		if tt.table == table {
+			return t, tt
+		}
+	}
+	return nil, nil
+}
+
+// RevisionRecorder wraps a SqlExecutor to record a revision for every insert, update and delete
+// of a tracked object. It should wrap a transaction, so that revisions are committed
+// or rolled back along with the objects.
+type RevisionRecorder struct {
+	gorp.SqlExecutor
+	Batch  string
+	Kind   string // BatchEdit if empty
+	Target string
+	// IDs of the user and session making the changes, resolved when recording
+	Author func() (IDUser int64, IDSession int64)
+	// Blob writes and deletes of the transaction, applied along with it (see Image)
+	Blobs *blobstore.Tx
+}
+
+func (rr *RevisionRecorder) Insert(list ...interface{}) error {
+	err := rr.SqlExecutor.Insert(list...)
+	if err != nil {
+		return err
+	}
+	for _, obj := range list {
+		rev, err := rr.revision(RevisionCreate, obj)
+		if err != nil {
+			return err
+		}
+		err = rr.save(rev, nil, obj)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rr *RevisionRecorder) Update(list ...interface{}) (int64, error) {
+	return rr.replace(RevisionUpdate, rr.SqlExecutor.Update, list)
+}
+
+func (rr *RevisionRecorder) Delete(list ...interface{}) (int64, error) {
+	return rr.replace(RevisionDelete, rr.SqlExecutor.Delete, list)
+}
+
+// Record updates/deletes: the previous state of the objects, and the scenario they belong to,
+// are read before applying the changes.
+func (rr *RevisionRecorder) replace(action string, apply func(...interface{}) (int64, error), list []interface{}) (int64, error) {
+	revs := make([]*Revision, len(list))
+	before := make([]interface{}, len(list))
+	for i, obj := range list {
+		rev, err := rr.revision(action, obj)
+		if err != nil {
+			return 0, err
+		}
+		if rev == nil {
+			continue
+		}
+		b, err := rr.SqlExecutor.Get(reflect.New(reflect.TypeOf(obj).Elem()).Interface(), rev.IDObject)
+		if err != nil {
+			return 0, err
+		}
+		if b == nil {
+			// No such object, nothing will change
+			continue
+		}
+		revs[i] = rev
+		before[i] = b
+	}
+
+	rows, err := apply(list...)
+	if err != nil {
+		return rows, err
+	}
+
+	for i, obj := range list {
+		if revs[i] == nil {
+			continue
+		}
+		after := obj
+		if action == RevisionDelete {
+			after = nil
+		}
+		err := rr.save(revs[i], before[i], after)
+		if err != nil {
+			return rows, err
+		}
+	}
+	return rows, nil
+}
+
+// Prepare the revision of a change to an object. Returns nil if the object is not tracked.
+func (rr *RevisionRecorder) revision(action string, obj interface{}) (*Revision, error) {
+	tt := trackedTypeOf(obj)
+	if tt == nil {
+		return nil, nil
+	}
+
+	IDScenario, err := tt.scenario(rr.SqlExecutor, obj)
+	if err != nil {
+		return nil, err
+	}
+	if IDScenario == 0 {
+		return nil, nil
+	}
+
+	rev := &Revision{
+		IDScenario: IDScenario,
+		Batch:      rr.Batch,
+		Kind:       rr.Kind,
+		Target:     rr.Target,
+		ObjectType: tt.table,
+		IDObject:   Columns(obj)["id"].Int(),
+		Action:     action,
+	}
+	if rev.Kind == "" {
+		rev.Kind = BatchEdit
+	}
+	if rr.Author != nil {
+		rev.IDUser, rev.IDSession = rr.Author()
+	}
+	return rev, nil
+}
+
+func (rr *RevisionRecorder) save(rev *Revision, before, after interface{}) error {
+	if rev == nil {
+		return nil
+	}
+
+	var err error
+
+	rev.Created = time.Now().UTC()
+	rev.Before, err = marshalRow(before)
+	if err != nil {
+		return err
+	}
+	rev.After, err = marshalRow(after)
+	if err != nil {
+		return err
+	}
+
+	return rr.SqlExecutor.Insert(rev)
+}
+
+// Serialize an object as a JSON object of its database columns.
+func marshalRow(obj interface{}) (RowData, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	row := make(map[string]interface{})
+	for col, v := range Columns(obj) {
+		row[col] = v.Interface()
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	return RowData(data), nil
+}
+
+// Deserialize an object of type t from a JSON object of its database columns.
+func unmarshalRow(t reflect.Type, data RowData) (interface{}, error) {
+	var row map[string]json.RawMessage
+	err := json.Unmarshal(data, &row)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := reflect.New(t).Interface()
+	for col, v := range Columns(obj) {
+		raw, ok := row[col]
+		if !ok {
+			continue
+		}
+		err := json.Unmarshal(raw, v.Addr().Interface())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", col, err)
+		}
+	}
+	return obj, nil
+}
+
+// List a scenario's revisions, most recent first. Optionally filtered by object.
+func ListRevisions(db gorp.SqlExecutor, scenar *Scenario, ObjectType string, IDObject int64) ([]*Revision, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to list revisions")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"revision"`).Where(
+		squirrel.Eq{`id_scenario`: scenar.ID},
+	).OrderBy(`id DESC`)
+
+	if ObjectType != "" {
+		selector = selector.Where(squirrel.Eq{`object_type`: ObjectType, `id_object`: IDObject})
+	}
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var revs []*Revision
+
+	_, err = db.Select(&revs, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fillRevisionAuthors(db, revs)
+	if err != nil {
+		return nil, err
+	}
+
+	return revs, nil
+}
+
+func fillRevisionAuthors(db gorp.SqlExecutor, revs []*Revision) error {
+	emails := make(map[int64]string)
+	for _, rev := range revs {
+		if rev.IDUser == 0 {
+			continue
+		}
+		email, ok := emails[rev.IDUser]
+		if !ok {
+			u, err := LoadUserFromID(db, rev.IDUser)
+			if err != nil {
+				return err
+			}
+			email = u.Email
+			emails[rev.IDUser] = email
+		}
+		rev.Author = email
+	}
+	return nil
+}
+
+// Load a revision by ID.
+func LoadRevisionFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Revision, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to load revision")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"revision"`).Where(
+		squirrel.And{
+			squirrel.Eq{`id`: ID},
+			squirrel.Eq{`id_scenario`: scenar.ID},
+		},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rev Revision
+
+	err = db.SelectOne(&rev, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fillRevisionAuthors(db, []*Revision{&rev})
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// Restore a scenario to its state right after a revision,
+// by reverting all the later revisions, most recent first.
+// When db is a RevisionRecorder, the restoration itself is recorded, and can be reverted too.
+func RestoreRevision(db gorp.SqlExecutor, scenar *Scenario, rev *Revision) error {
+	if db == nil || scenar == nil || rev == nil {
+		return errors.New("Missing parameters to restore revision")
+	}
+
+	later, err := ListRevisionsAfter(db, scenar, rev)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range later {
+		err := r.Revert(db)
+		if err != nil {
+			return fmt.Errorf("Reverting revision %d: %s", r.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// List the revisions of a scenario that came after a revision, most recent first.
+func ListRevisionsAfter(db gorp.SqlExecutor, scenar *Scenario, rev *Revision) ([]*Revision, error) {
+	if db == nil || scenar == nil || rev == nil {
+		return nil, errors.New("Missing parameters to list revisions")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"revision"`).Where(
+		squirrel.And{
+			squirrel.Eq{`id_scenario`: scenar.ID},
+			squirrel.Gt{`id`: rev.ID},
+		},
+	).OrderBy(`id DESC`).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var later []*Revision
+
+	_, err = db.Select(&later, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return later, nil
+}
+
+// Objects returns the state of the revised object before and after the revision,
+// as model objects (e.g. *Card). Either is nil for a creation/deletion.
+func (rev *Revision) Objects() (before interface{}, after interface{}, err error) {
+	t, tt := trackedTypeFromTable(rev.ObjectType)
+	if tt == nil {
+		return nil, nil, fmt.Errorf("Unknown object type: %s", rev.ObjectType)
+	}
+
+	if rev.Before != nil {
+		before, err = unmarshalRow(t, rev.Before)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if rev.After != nil {
+		after, err = unmarshalRow(t, rev.After)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return before, after, nil
+}
+
+// Apply the inverse of a revision: delete created objects, restore the previous state
+// of updated objects, and recreate deleted objects with their original ID.
+func (rev *Revision) Revert(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to revert revision")
+	}
+
+	t, tt := trackedTypeFromTable(rev.ObjectType)
+	if tt == nil {
+		return fmt.Errorf("Unknown object type: %s", rev.ObjectType)
+	}
+
+	switch rev.Action {
+	case RevisionCreate:
+		obj, err := unmarshalRow(t, rev.After)
+		if err != nil {
+			return err
+		}
+		rows, err := db.Delete(obj)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("No such %s to delete: %d", rev.ObjectType, rev.IDObject)
+		}
+		return nil
+	case RevisionUpdate:
+		obj, err := unmarshalRow(t, rev.Before)
+		if err != nil {
+			return err
+		}
+		rows, err := db.Update(obj)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("No such %s to update: %d", rev.ObjectType, rev.IDObject)
+		}
+		return nil
+	case RevisionDelete:
+		obj, err := unmarshalRow(t, rev.Before)
+		if err != nil {
+			return err
+		}
+		return insertWithID(db, tt.table, obj)
+	}
+
+	return fmt.Errorf("Unknown revision action: %s", rev.Action)
+}
+
+// Insert an object keeping its ID, which gorp would otherwise generate.
+func insertWithID(db gorp.SqlExecutor, table string, obj interface{}) error {
+	values := make(map[string]interface{})
+	for col, v := range Columns(obj) {
+		values[col] = v.Interface()
+	}
+
+	query, args, err := sqlgenerator.PGsql.Insert(`"` + table + `"`).SetMap(values).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	if rr, ok := db.(*RevisionRecorder); ok {
+		rev, err := rr.revision(RevisionCreate, obj)
+		if err != nil {
+			return err
+		}
+		return rr.save(rev, nil, obj)
+	}
+	return nil
+}
@@ -11,7 +11,8 @@ import (
 
 // Scenario is the highest-level object.
 // All other game objects belong to a scenario.
-// A scenario belongs to a user (author).
+// A scenario belongs to a user (author), its owner, and can be shared
+// with other users (see ScenarioMember).
 type Scenario struct {
 	ID       int64  `json:"id" db:"id"`
 	Name     string `json:"name" db:"name"`
@@ -19,7 +20,7 @@ type Scenario struct {
 }
 
 // Create a scenario.
-func CreateScenario(db *gorp.DbMap, name string, author *User) (*Scenario, error) {
+func CreateScenario(db gorp.SqlExecutor, name string, author *User) (*Scenario, error) {
 	if db == nil || author == nil {
 		return nil, errors.New("Missing parameters to create scenario")
 	}
@@ -39,20 +40,25 @@ func CreateScenario(db *gorp.DbMap, name string, author *User) (*Scenario, error
 		return nil, err
 	}
 
+	_, err = CreateScenarioMember(db, sc, author, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
 	return sc, nil
 }
 
-// List scenarios, optionally filtered by author.
-func ListScenarios(db *gorp.DbMap, author *User) ([]*Scenario, error) {
+// List scenarios, optionally filtered by member.
+func ListScenarios(db gorp.SqlExecutor, member *User) ([]*Scenario, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list scenarios")
 	}
 
 	selector := sqlgenerator.PGsql.Select(`*`).From(`"scenario"`)
 
-	if author != nil {
+	if member != nil {
 		selector = selector.Where(
-			squirrel.Eq{`id_author`: author.ID},
+			squirrel.Expr(`id IN (SELECT id_scenario FROM "scenario_member" WHERE id_user = ?)`, member.ID),
 		)
 	}
 
@@ -71,8 +77,8 @@ func ListScenarios(db *gorp.DbMap, author *User) ([]*Scenario, error) {
 	return s, nil
 }
 
-// Load a scenario by id, optionally filtered by author.
-func LoadScenarioFromID(db *gorp.DbMap, author *User, ID int64) (*Scenario, error) {
+// Load a scenario by id, optionally filtered by member.
+func LoadScenarioFromID(db gorp.SqlExecutor, member *User, ID int64) (*Scenario, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load scenario")
 	}
@@ -81,9 +87,9 @@ func LoadScenarioFromID(db *gorp.DbMap, author *User, ID int64) (*Scenario, erro
 		squirrel.Eq{`id`: ID},
 	)
 
-	if author != nil {
+	if member != nil {
 		selector = selector.Where(
-			squirrel.Eq{`id_author`: author.ID},
+			squirrel.Expr(`id IN (SELECT id_scenario FROM "scenario_member" WHERE id_user = ?)`, member.ID),
 		)
 	}
 
@@ -103,7 +109,7 @@ func LoadScenarioFromID(db *gorp.DbMap, author *User, ID int64) (*Scenario, erro
 }
 
 // Update a scenario.
-func (sc *Scenario) Update(db *gorp.DbMap, name string) error {
+func (sc *Scenario) Update(db gorp.SqlExecutor, name string) error {
 	if db == nil {
 		return errors.New("Missing db parameter to update scenario")
 	}
@@ -127,11 +133,33 @@ func (sc *Scenario) Update(db *gorp.DbMap, name string) error {
 }
 
 // Delete a scenario.
-func (sc *Scenario) Delete(db *gorp.DbMap) error {
+func (sc *Scenario) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete scenario")
 	}
 
+	members, err := ListScenarioMembers(db, sc)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		_, err := db.Delete(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	playtests, err := ListPlaytests(db, sc, nil)
+	if err != nil {
+		return err
+	}
+	for _, pt := range playtests {
+		_, err := db.Delete(pt)
+		if err != nil {
+			return err
+		}
+	}
+
 	rows, err := db.Delete(sc)
 	if err != nil {
 		return err
@@ -143,6 +171,42 @@ func (sc *Scenario) Delete(db *gorp.DbMap) error {
 	return nil
 }
 
+// Make another member the owner of a scenario.
+// The previous owner stays a member, as an editor.
+func (sc *Scenario) TransferOwnership(db gorp.SqlExecutor, newOwner *User) error {
+	if db == nil || newOwner == nil {
+		return errors.New("Missing parameters to transfer scenario")
+	}
+	if newOwner.ID == sc.IDAuthor {
+		return errors.New("User already owns the scenario")
+	}
+
+	owner, err := LoadScenarioMemberFromUser(db, sc, &User{ID: sc.IDAuthor})
+	if err != nil {
+		return err
+	}
+	member, err := LoadScenarioMemberFromUser(db, sc, newOwner)
+	if err != nil {
+		return errors.New("New owner must be a member of the scenario")
+	}
+
+	owner.Role = RoleEditor
+	member.Role = RoleOwner
+	sc.IDAuthor = newOwner.ID
+
+	for _, obj := range []interface{}{owner, member, sc} {
+		rows, err := db.Update(obj)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return errors.New("No such scenario to transfer")
+		}
+	}
+
+	return nil
+}
+
 // Verify that a scenario is valid before creating/updating it.
 func (sc *Scenario) Valid() error {
 	if sc.Name == "" {
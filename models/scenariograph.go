@@ -0,0 +1,265 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/go-gorp/gorp"
+)
+
+// ScenarioGraph is the full graph of a scenario's game logic. Unlike LocationGraph,
+// elements, state tokens and stats are nodes of their own, so the graph can be navigated
+// from any of them: which cards give a token, which cards it unlocks, and so on.
+type ScenarioGraph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+const (
+	GraphNodeLocation   = "location"
+	GraphNodeCard       = "card" // All card types, see GraphNode.CardType
+	GraphNodeElement    = "element"
+	GraphNodeStateToken = "state_token"
+	GraphNodeStat       = "stat"
+)
+
+var GraphNodeTypes = []string{GraphNodeLocation, GraphNodeCard, GraphNodeElement, GraphNodeStateToken, GraphNodeStat}
+
+const (
+	GraphEdgeCard        = "card"          // Location -> its cards
+	GraphEdgeElementCard = "element_card"  // Element -> its card
+	GraphEdgeReveals     = "reveals"       // Card -> location
+	GraphEdgeGives       = "gives"         // Card -> state token or element
+	GraphEdgeUnlocks     = "unlocks"       // State token -> card locked by it
+	GraphEdgeUsedOn      = "used_on"       // Element -> card using it
+	GraphEdgeCombines    = "combines_into" // Input element -> output element
+	GraphEdgeSkillTest   = "skill_test"    // Card -> stat
+	GraphEdgeRequirement = "requirement"   // State token or element -> card whose requirement references it
+)
+
+// GraphNode is an object of the scenario. Its ID is unique across node types: "<type>_<object ID>".
+type GraphNode struct {
+	ID          string           `json:"id"`
+	Type        string           `json:"type"`
+	IDObject    int64            `json:"id_object"`
+	Name        string           `json:"name"`
+	IDIcon      int64            `json:"id_icon,omitempty"`
+	Icon        string           `json:"icon,omitempty"`        // Short name of the icon
+	Hidden      bool             `json:"hidden,omitempty"`      // Locations
+	CardType    string           `json:"card_type,omitempty"`   // Cards
+	TUCost      uint             `json:"tu_cost,omitempty"`     // Cards
+	Requirement *RequirementExpr `json:"requirement,omitempty"` // Cards
+}
+
+type GraphEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Type   string `json:"type"`
+	TUCost uint   `json:"tu_cost,omitempty"` // Reveals
+}
+
+func GraphNodeID(Type string, ID int64) string {
+	return fmt.Sprintf("%s_%d", Type, ID)
+}
+
+func (g *ScenarioGraph) addNode(n *GraphNode) {
+	n.ID = GraphNodeID(n.Type, n.IDObject)
+	g.Nodes = append(g.Nodes, n)
+}
+
+func (g *ScenarioGraph) addEdge(fromType string, fromID int64, toType string, toID int64, Type string) *GraphEdge {
+	e := &GraphEdge{From: GraphNodeID(fromType, fromID), To: GraphNodeID(toType, toID), Type: Type}
+	g.Edges = append(g.Edges, e)
+	return e
+}
+
+// Build the full graph of a scenario. Only the nodes of the given types are kept,
+// along with the edges between them (all node types if none is given).
+func FullGraph(db gorp.SqlExecutor, scenar *Scenario, types ...string) (*ScenarioGraph, error) {
+
+	g := &ScenarioGraph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+
+	icons := make(map[int64]string)
+	ico, err := ListIcons(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range ico {
+		icons[i.ID] = i.ShortName
+	}
+
+	locations, err := ListLocations(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, loc := range locations {
+		g.addNode(&GraphNode{Type: GraphNodeLocation, IDObject: loc.ID, Name: loc.Name, Hidden: loc.Hidden})
+		locCards, err := loc.GetCards(db)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range locCards {
+			g.addEdge(GraphNodeLocation, loc.ID, GraphNodeCard, c.ID, GraphEdgeCard)
+		}
+	}
+
+	// Cards of all types: location, element, receptacle, mission success, codex and plan cards
+	cards, err := ListCards(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cards {
+		g.addNode(&GraphNode{Type: GraphNodeCard, IDObject: c.ID, Name: c.Description, CardType: c.CardType, TUCost: c.TUCost})
+	}
+
+	elemIcon, err := LoadBaseIconFromShortName(db, ELEMENT_ICON)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	elems, err := ListElements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elems {
+		n := &GraphNode{Type: GraphNodeElement, IDObject: e.ID, Name: fmt.Sprintf("Element %d", e.Number)}
+		if elemIcon != nil {
+			n.IDIcon, n.Icon = elemIcon.ID, elemIcon.ShortName
+		}
+		g.addNode(n)
+		g.addEdge(GraphNodeElement, e.ID, GraphNodeCard, e.IDCard, GraphEdgeElementCard)
+	}
+
+	tokens, err := ListStateTokens(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, tk := range tokens {
+		g.addNode(&GraphNode{Type: GraphNodeStateToken, IDObject: tk.ID, Name: tk.ShortName, IDIcon: tk.IDIcon, Icon: icons[tk.IDIcon]})
+	}
+
+	stats, err := ListStats(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range stats {
+		g.addNode(&GraphNode{Type: GraphNodeStat, IDObject: st.ID, Name: st.Name, IDIcon: st.IDIcon, Icon: icons[st.IDIcon]})
+	}
+
+	locLinks, err := ListLocationLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, ll := range locLinks {
+		e := g.addEdge(GraphNodeCard, ll.IDCard, GraphNodeLocation, ll.IDLocation, GraphEdgeReveals)
+		e.TUCost = ll.TUCost
+	}
+
+	tkLinks, err := ListStateTokenLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, tl := range tkLinks {
+		if tl.UnlocksUnlocked {
+			g.addEdge(GraphNodeCard, tl.IDCard, GraphNodeStateToken, tl.IDStateToken, GraphEdgeGives)
+		} else {
+			g.addEdge(GraphNodeStateToken, tl.IDStateToken, GraphNodeCard, tl.IDCard, GraphEdgeUnlocks)
+		}
+	}
+
+	elemLinks, err := ListElementLinks(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, el := range elemLinks {
+		if el.GivesUses {
+			g.addEdge(GraphNodeCard, el.IDCard, GraphNodeElement, el.IDElement, GraphEdgeGives)
+		} else {
+			g.addEdge(GraphNodeElement, el.IDElement, GraphNodeCard, el.IDCard, GraphEdgeUsedOn)
+		}
+	}
+
+	combinations, err := ListElementCombinations(db, scenar, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, ec := range combinations {
+		for _, in := range ec.Inputs {
+			g.addEdge(GraphNodeElement, in.IDElement, GraphNodeElement, ec.IDElement, GraphEdgeCombines)
+		}
+	}
+
+	skillTests, err := ListSkillTests(db, scenar, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range skillTests {
+		g.addEdge(GraphNodeCard, st.IDCard, GraphNodeStat, st.IDStat, GraphEdgeSkillTest)
+	}
+
+	requirements, err := ListRequirements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	cardNodes := make(map[string]*GraphNode)
+	for _, n := range g.Nodes {
+		if n.Type == GraphNodeCard {
+			cardNodes[n.ID] = n
+		}
+	}
+	for _, r := range requirements {
+		n, ok := cardNodes[GraphNodeID(GraphNodeCard, r.IDCard)]
+		if !ok {
+			continue
+		}
+		n.Requirement = r.Expression
+		for _, l := range r.Expression.leaves() {
+			if l.op == RequirementToken {
+				g.addEdge(GraphNodeStateToken, l.ID, GraphNodeCard, r.IDCard, GraphEdgeRequirement)
+			} else {
+				g.addEdge(GraphNodeElement, l.ID, GraphNodeCard, r.IDCard, GraphEdgeRequirement)
+			}
+		}
+	}
+
+	return g.filter(types), nil
+}
+
+// Keep the nodes of the given types, and the edges between them.
+func (g *ScenarioGraph) filter(types []string) *ScenarioGraph {
+	keep := make(map[string]bool)
+	for _, t := range types {
+		keep[t] = true
+	}
+
+	ret := &ScenarioGraph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+	nodes := make(map[string]bool)
+	for _, n := range g.Nodes {
+		if len(types) == 0 || keep[n.Type] {
+			ret.Nodes = append(ret.Nodes, n)
+			nodes[n.ID] = true
+		}
+	}
+	for _, e := range g.Edges {
+		if nodes[e.From] && nodes[e.To] {
+			ret.Edges = append(ret.Edges, e)
+		}
+	}
+
+	return ret
+}
+
+// Verify node types used to filter a graph.
+func ValidGraphNodeTypes(types []string) error {
+	for _, t := range types {
+		valid := false
+		for _, nt := range GraphNodeTypes {
+			if t == nt {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("Unknown node type: %s", t)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+// Session represents an authentication token given to a user.
+// Only a digest of the token is stored.
+type Session struct {
+	ID        int64     `json:"id" db:"id"`
+	IDUser    int64     `json:"-" db:"id_user"`
+	TokenHash string    `json:"-" db:"token_hash"`
+	Created   time.Time `json:"created" db:"created"`
+	LastUsed  time.Time `json:"last_used" db:"last_used"`
+	Current   bool      `json:"current" db:"-"` // Whether the session is the one making the request
+}
+
+// Create a session for a user, from the digest of its token.
+func CreateSession(db gorp.SqlExecutor, user *User, TokenHash string) (*Session, error) {
+	if db == nil || user == nil {
+		return nil, errors.New("Missing parameters to create session")
+	}
+
+	now := time.Now().UTC()
+
+	s := &Session{
+		IDUser:    user.ID,
+		TokenHash: TokenHash,
+		Created:   now,
+		LastUsed:  now,
+	}
+
+	err := db.Insert(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Load a session from the digest of its token.
+func LoadSessionFromTokenHash(db gorp.SqlExecutor, TokenHash string) (*Session, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load session")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"session"`).Where(
+		squirrel.Eq{`token_hash`: TokenHash},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var s Session
+
+	err = db.SelectOne(&s, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Load a user's session by ID.
+func LoadSessionFromID(db gorp.SqlExecutor, user *User, ID int64) (*Session, error) {
+	if db == nil || user == nil {
+		return nil, errors.New("Missing parameters to load session")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"session"`).Where(
+		squirrel.And{
+			squirrel.Eq{`id`: ID},
+			squirrel.Eq{`id_user`: user.ID},
+		},
+	).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var s Session
+
+	err = db.SelectOne(&s, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// List a user's sessions.
+func ListSessions(db gorp.SqlExecutor, user *User) ([]*Session, error) {
+	if db == nil || user == nil {
+		return nil, errors.New("Missing parameters to list sessions")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"session"`).Where(
+		squirrel.Eq{`id_user`: user.ID},
+	).OrderBy(`last_used DESC`).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var s []*Session
+
+	_, err = db.Select(&s, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Delete a user's sessions that have not been used since a given time.
+func DeleteSessionsUnusedSince(db gorp.SqlExecutor, user *User, since time.Time) error {
+	if db == nil || user == nil {
+		return errors.New("Missing parameters to delete sessions")
+	}
+
+	query, args, err := sqlgenerator.PGsql.Delete(`"session"`).Where(
+		squirrel.And{
+			squirrel.Eq{`id_user`: user.ID},
+			squirrel.Lt{`last_used`: since},
+		},
+	).ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(query, args...)
+	return err
+}
+
+// Mark a session as used now.
+func (s *Session) Touch(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to update session")
+	}
+
+	s.LastUsed = time.Now().UTC()
+
+	rows, err := db.Update(s)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such session to update")
+	}
+	return nil
+}
+
+// Delete a session.
+func (s *Session) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete session")
+	}
+
+	rows, err := db.Delete(s)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such session to delete")
+	}
+	return nil
+}
@@ -31,7 +31,7 @@ type SkillTest struct {
 
 // Create a skill test.
 // This will also create CardIcon objects on the Front of the Card, for the statistic itself and each of the present shields.
-func CreateSkillTest(db *gorp.DbMap, card *Card, linkedStat *Stat, NormalShields, SkullShields, HeartShields, UTShields, SpecialShields uint) (*SkillTest, error) {
+func CreateSkillTest(db gorp.SqlExecutor, card *Card, linkedStat *Stat, NormalShields, SkullShields, HeartShields, UTShields, SpecialShields uint) (*SkillTest, error) {
 	if db == nil || linkedStat == nil {
 		return nil, errors.New("Missing parameters to create skill test")
 	}
@@ -60,13 +60,13 @@ func CreateSkillTest(db *gorp.DbMap, card *Card, linkedStat *Stat, NormalShields
 	err = addSkillTestIcons(db, card, linkedStat, st,
 		NormalShields, SkullShields, HeartShields, UTShields, SpecialShields)
 	if err != nil {
-		return nil, err // TODO Tx
+		return nil, err
 	}
 
 	return st, nil
 }
 
-func addSkillTestIcons(db *gorp.DbMap, c *Card, linkedStat *Stat, st *SkillTest,
+func addSkillTestIcons(db gorp.SqlExecutor, c *Card, linkedStat *Stat, st *SkillTest,
 	NormalShields, SkullShields, HeartShields, UTShields, SpecialShields uint) error {
 	// Add shield CardIcons
 	offsetX, err := addShieldCardIcon(db, c, 0, NormalShields, NORMAL_SHIELD_ICON, st)
@@ -96,7 +96,7 @@ func addSkillTestIcons(db *gorp.DbMap, c *Card, linkedStat *Stat, st *SkillTest,
 		return err
 	}
 	_, err = c.CreateCardIcon(db, ico, true, /* FRONT */
-		offsetX, 0, DEFAULT_SIZE_X, DEFAULT_SIZE_Y, "", 0, st, nil)
+		offsetX, 0, DEFAULT_SIZE_X, DEFAULT_SIZE_Y, "", 0, st, nil, nil, nil)
 	if err != nil {
 		return err
 	}
@@ -105,7 +105,7 @@ func addSkillTestIcons(db *gorp.DbMap, c *Card, linkedStat *Stat, st *SkillTest,
 	return nil
 }
 
-func addShieldCardIcon(db *gorp.DbMap, c *Card, offsetX uint, shieldCount uint, shieldShortName string, st *SkillTest) (uint, error) {
+func addShieldCardIcon(db gorp.SqlExecutor, c *Card, offsetX uint, shieldCount uint, shieldShortName string, st *SkillTest) (uint, error) {
 	if shieldCount == 0 {
 		return offsetX, nil
 	}
@@ -122,16 +122,16 @@ func addShieldCardIcon(db *gorp.DbMap, c *Card, offsetX uint, shieldCount uint,
 		annotType = AnnotationTypeCircle
 	}
 	_, err = c.CreateCardIcon(db, ico, true, /* FRONT */
-		offsetX, 0, DEFAULT_SIZE_X, DEFAULT_SIZE_Y, annot, annotType, st, nil)
+		offsetX, 0, DEFAULT_SIZE_X, DEFAULT_SIZE_Y, annot, annotType, st, nil, nil, nil)
 	if err != nil {
-		return offsetX, err // TODO Tx
+		return offsetX, err
 	}
 
 	return offsetX + DEFAULT_SIZE_X, nil
 }
 
 // List skill tests with filters.
-func ListSkillTests(db *gorp.DbMap, scenar *Scenario, card *Card, s *Stat) ([]*SkillTest, error) {
+func ListSkillTests(db gorp.SqlExecutor, scenar *Scenario, card *Card, s *Stat) ([]*SkillTest, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load skill tests")
 	}
@@ -165,7 +165,7 @@ func ListSkillTests(db *gorp.DbMap, scenar *Scenario, card *Card, s *Stat) ([]*S
 }
 
 // Load a skill test, by ID. Optionally filtered by scenario.
-func LoadSkillTestFromID(db *gorp.DbMap, scenar *Scenario, IDSkillTest int64) (*SkillTest, error) {
+func LoadSkillTestFromID(db gorp.SqlExecutor, scenar *Scenario, IDSkillTest int64) (*SkillTest, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load skill test")
 	}
@@ -196,7 +196,7 @@ func LoadSkillTestFromID(db *gorp.DbMap, scenar *Scenario, IDSkillTest int64) (*
 // This will also create CardIcon objects on the Front of the Card, for the statistic itself and each of the present shields.
 // The card parameter CANNOT overwrite the card associated with the SkillTest, it is permanent.
 // It is passed only to be able to retrieve the associated CardIcon objects.
-func (st *SkillTest) Update(db *gorp.DbMap, card *Card, linkedStat *Stat, NormalShields, SkullShields, HeartShields, UTShields, SpecialShields uint) error {
+func (st *SkillTest) Update(db gorp.SqlExecutor, card *Card, linkedStat *Stat, NormalShields, SkullShields, HeartShields, UTShields, SpecialShields uint) error {
 	if db == nil || linkedStat == nil {
 		return errors.New("Missing parameters to update skill test")
 	}
@@ -220,16 +220,23 @@ func (st *SkillTest) Update(db *gorp.DbMap, card *Card, linkedStat *Stat, Normal
 		return errors.New("No such skill test to update")
 	}
 
-	// Ad-hoc delete of all previous CardIcons
-	_, err = db.Exec(`DELETE FROM "card_icon" WHERE id_skilltest = $1`, st.ID)
+	// Delete all previous CardIcons
+	icons, err := card.ListCardIcons(db, st, nil, nil, nil)
 	if err != nil {
-		return err // TODO Tx
+		return err
+	}
+	for _, ci := range icons {
+		// Not ci.Delete(), which refuses to delete auto-generated icons
+		_, err := db.Delete(ci)
+		if err != nil {
+			return err
+		}
 	}
 	// Recreate new icons
 	err = addSkillTestIcons(db, card, linkedStat, st,
 		NormalShields, SkullShields, HeartShields, UTShields, SpecialShields)
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 	// TODO smarter process to avoid unnecessarily deleting all CardIcons ?
 
@@ -237,7 +244,7 @@ func (st *SkillTest) Update(db *gorp.DbMap, card *Card, linkedStat *Stat, Normal
 }
 
 // Delete a skill test linked to a card.
-func (st *SkillTest) Delete(db *gorp.DbMap) error {
+func (st *SkillTest) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete skill test")
 	}
@@ -18,7 +18,7 @@ type Stat struct {
 }
 
 // Create a stat object.
-func CreateStat(db *gorp.DbMap, scenar *Scenario, ico *Icon, name string, description string) (*Stat, error) {
+func CreateStat(db gorp.SqlExecutor, scenar *Scenario, ico *Icon, name string, description string) (*Stat, error) {
 	if db == nil || scenar == nil || ico == nil {
 		return nil, errors.New("Missing parameters to create stat")
 	}
@@ -44,7 +44,7 @@ func CreateStat(db *gorp.DbMap, scenar *Scenario, ico *Icon, name string, descri
 }
 
 // List stats, optionally filtered by scenario.
-func ListStats(db *gorp.DbMap, scenar *Scenario) ([]*Stat, error) {
+func ListStats(db gorp.SqlExecutor, scenar *Scenario) ([]*Stat, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list stats")
 	}
@@ -71,12 +71,14 @@ func ListStats(db *gorp.DbMap, scenar *Scenario) ([]*Stat, error) {
 }
 
 // Load stat by id, optionally filtered by scenario.
-func LoadStatFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Stat, error) {
+func LoadStatFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*Stat, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load stat")
 	}
 
-	selector := sqlgenerator.PGsql.Select(`*`).From(`"stat"`)
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"stat"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
 
 	if scenar != nil {
 		selector = selector.Where(squirrel.Eq{`id_scenario`: scenar.ID})
@@ -98,7 +100,7 @@ func LoadStatFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Stat, error) {
 }
 
 // Update stat object.
-func (st *Stat) Update(db *gorp.DbMap, ico *Icon, name string, description string) error {
+func (st *Stat) Update(db gorp.SqlExecutor, ico *Icon, name string, description string) error {
 	if db == nil || ico == nil {
 		return errors.New("Missing parameters to update stat")
 	}
@@ -124,7 +126,7 @@ func (st *Stat) Update(db *gorp.DbMap, ico *Icon, name string, description strin
 }
 
 // Delete a stat object.
-func (st *Stat) Delete(db *gorp.DbMap) error {
+func (st *Stat) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete stat")
 	}
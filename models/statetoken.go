@@ -2,30 +2,71 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
 )
 
-// StateToken represents base game tokens with different icons
+// StateToken represents tokens with different icons
 // that maintain game state (e.g. unlock access to cards)
-// These are bootstrapped in DB, only need Load functions.
+// Base game tokens are bootstrapped in DB, with a NULL IDScenario.
+// Scenarios can define their own tokens, with a description of what they mean in the story.
 type StateToken struct {
-	ID        int64  `json:"id" db:"id"`
-	ShortName string `json:"short_name" db:"short_name"`
-	IDIcon    int64  `json:"id_icon" db:"id_icon"`
+	ID          int64  `json:"id" db:"id"`
+	IDScenario  *int64 `json:"id_scenario" db:"id_scenario"`
+	ShortName   string `json:"short_name" db:"short_name"`
+	IDIcon      int64  `json:"id_icon" db:"id_icon"`
+	Description string `json:"description" db:"description"`
 }
 
-// Loads a state token by ID
-func LoadStateTokenFromID(db *gorp.DbMap, ID int64) (*StateToken, error) {
+// Create a state token. The icon must be a base game icon or an icon of the scenario.
+func CreateStateToken(db gorp.SqlExecutor, scenar *Scenario, ShortName string, ico *Icon, Description string) (*StateToken, error) {
+	if db == nil || ico == nil {
+		return nil, errors.New("Missing parameters to create state token")
+	}
+
+	tk := &StateToken{
+		ShortName:   strings.TrimSpace(ShortName),
+		IDIcon:      ico.ID,
+		Description: Description,
+	}
+
+	if scenar != nil {
+		tk.IDScenario = &scenar.ID
+	}
+
+	err := tk.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Insert(tk)
+	if err != nil {
+		return nil, err
+	}
+
+	return tk, nil
+}
+
+// Loads a state token by ID. If scenar parameter is non-nil it acts as a filter:
+// only base game tokens and tokens of the scenario will be returned.
+func LoadStateTokenFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*StateToken, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load state token")
 	}
 
-	query, args, err := squirrel.Select(`*`).From(`"state_token"`).Where(
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"state_token"`).Where(
 		squirrel.Eq{`id`: ID},
-	).ToSql()
+	)
+
+	if scenar != nil {
+		selector = selector.Where(squirrel.Or{squirrel.Eq{`id_scenario`: nil}, squirrel.Eq{`id_scenario`: scenar.ID}})
+	}
 
+	query, args, err := selector.ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -40,14 +81,25 @@ func LoadStateTokenFromID(db *gorp.DbMap, ID int64) (*StateToken, error) {
 	return &st, nil
 }
 
-// List all state tokens
-func ListStateTokens(db *gorp.DbMap) ([]*StateToken, error) {
+// List state tokens. If scenar parameter is non-nil, only base game tokens
+// and tokens of the scenario are listed.
+func ListStateTokens(db gorp.SqlExecutor, scenar *Scenario) ([]*StateToken, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to list state tokens")
 	}
 
-	query, args, err := squirrel.Select(`*`).From(`"state_token"`).ToSql()
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"state_token"`)
 
+	if scenar != nil {
+		selector = selector.Where(
+			squirrel.Or{
+				squirrel.Eq{`id_scenario`: nil},
+				squirrel.Eq{`id_scenario`: scenar.ID},
+			},
+		)
+	}
+
+	query, args, err := selector.ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -61,3 +113,75 @@ func ListStateTokens(db *gorp.DbMap) ([]*StateToken, error) {
 
 	return st, nil
 }
+
+// Update a state token.
+func (tk *StateToken) Update(db gorp.SqlExecutor, ShortName string, ico *Icon, Description string) error {
+	if db == nil || ico == nil {
+		return errors.New("Missing parameters to update state token")
+	}
+
+	tk.ShortName = strings.TrimSpace(ShortName)
+	tk.IDIcon = ico.ID
+	tk.Description = Description
+
+	err := tk.Valid()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Update(tk)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such state token to update")
+	}
+
+	return nil
+}
+
+// Delete a state token. Tokens still linked to cards cannot be deleted.
+func (tk *StateToken) Delete(db gorp.SqlExecutor) error {
+	if db == nil {
+		return errors.New("Missing db parameter to delete state token")
+	}
+
+	links, err := ListStateTokenLinks(db, nil, nil, tk)
+	if err != nil {
+		return err
+	}
+	if len(links) > 0 {
+		return fmt.Errorf("State token %s is linked to %d card(s)", tk.ShortName, len(links))
+	}
+
+	// Base game tokens can be referenced by any scenario
+	var scenar *Scenario
+	if tk.IDScenario != nil {
+		scenar = &Scenario{ID: *tk.IDScenario}
+	}
+	reqs, err := listReferencingRequirements(db, scenar, RequirementToken, tk.ID)
+	if err != nil {
+		return err
+	}
+	if len(reqs) > 0 {
+		return fmt.Errorf("State token %s is referenced by the requirement of %d card(s)", tk.ShortName, len(reqs))
+	}
+
+	rows, err := db.Delete(tk)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No such state token to delete")
+	}
+
+	return nil
+}
+
+// Verify that a state token is valid before creating/updating it.
+func (tk *StateToken) Valid() error {
+	if tk.ShortName == "" {
+		return errors.New("Empty state token short name")
+	}
+	return nil
+}
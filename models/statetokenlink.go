@@ -28,10 +28,13 @@ type StateTokenLink struct {
 // Create a link between a card and a state token.
 // This will also create a CardIcon object representing the state token
 // on either the front or the back of the card (depending on if it unlocks / is unlocked).
-func CreateStateTokenLink(db *gorp.DbMap, card *Card, tk *StateToken, UnlocksUnlocked bool) (*StateTokenLink, error) {
+func CreateStateTokenLink(db gorp.SqlExecutor, card *Card, tk *StateToken, UnlocksUnlocked bool) (*StateTokenLink, error) {
 	if db == nil || tk == nil || card == nil {
 		return nil, errors.New("Missing parameters to create card link")
 	}
+	if tk.IDScenario != nil && *tk.IDScenario != card.IDScenario {
+		return nil, errors.New("State token belongs to another scenario")
+	}
 
 	cl := &StateTokenLink{
 		IDScenario:      card.IDScenario,
@@ -48,21 +51,21 @@ func CreateStateTokenLink(db *gorp.DbMap, card *Card, tk *StateToken, UnlocksUnl
 	// Load state token icon
 	ico, err := LoadIconFromID(db, nil, tk.IDIcon)
 	if err != nil {
-		return nil, err // TODO Tx
+		return nil, err
 	}
 
 	// Create CardIcon of state token icon, on front or back
 	_, err = card.CreateCardIcon(db, ico, UnlocksUnlocked, // Unlocks = Front, Unlocked = back
-		0, 0, DEFAULT_SIZE_X, DEFAULT_SIZE_Y, "", 0, nil, cl)
+		0, 0, DEFAULT_SIZE_X, DEFAULT_SIZE_Y, "", 0, nil, cl, nil, nil)
 	if err != nil {
-		return nil, err // TODO Tx
+		return nil, err
 	}
 
 	return cl, nil
 }
 
 // List state token links, with filters.
-func ListStateTokenLinks(db *gorp.DbMap, scenar *Scenario, card *Card, tk *StateToken) ([]*StateTokenLink, error) {
+func ListStateTokenLinks(db gorp.SqlExecutor, scenar *Scenario, card *Card, tk *StateToken) ([]*StateTokenLink, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load state token links")
 	}
@@ -95,7 +98,7 @@ func ListStateTokenLinks(db *gorp.DbMap, scenar *Scenario, card *Card, tk *State
 }
 
 // Loads a state token link by ID. Optionally filtered by scenario.
-func LoadStateTokenLinkFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*StateTokenLink, error) {
+func LoadStateTokenLinkFromID(db gorp.SqlExecutor, scenar *Scenario, ID int64) (*StateTokenLink, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load card links")
 	}
@@ -129,7 +132,7 @@ func LoadStateTokenLinkFromID(db *gorp.DbMap, scenar *Scenario, ID int64) (*Stat
 // on either the front or the back of the card (depending on if it unlocks / is unlocked).
 // The card parameter CANNOT overwrite the card associated with the StateTokenLink, it is permanent.
 // It is passed only to be able to retrieve the associated CardIcon object.
-func (cl *StateTokenLink) Update(db *gorp.DbMap, card *Card, tk *StateToken, UnlocksUnlocked bool) error {
+func (cl *StateTokenLink) Update(db gorp.SqlExecutor, card *Card, tk *StateToken, UnlocksUnlocked bool) error {
 	if db == nil || tk == nil {
 		return errors.New("Missing parameters to create card link")
 	}
@@ -146,35 +149,35 @@ func (cl *StateTokenLink) Update(db *gorp.DbMap, card *Card, tk *StateToken, Unl
 	}
 
 	// Retrieve the CardIcons linked to this card + StateTokenLink
-	ciList, err := card.ListCardIcons(db, nil, cl)
+	ciList, err := card.ListCardIcons(db, nil, cl, nil, nil)
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 	// There should only ever be 1: the state token icon
 	if len(ciList) != 1 {
 		// Something very wrong happened
-		return fmt.Errorf("Invalid state: %d card icons linked to StateTokenLink") // TODO Tx
+		return fmt.Errorf("Invalid state: %d card icons linked to StateTokenLink", len(ciList))
 	}
 
 	ci := ciList[0]
 	// Load state token icon
 	ico, err := LoadIconFromID(db, nil, tk.IDIcon)
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 
 	// Update the CardIcon, changing only the ico parameter
 	err = ci.Update(db, ico, ci.FrontBack, ci.X, ci.Y, ci.SizeX, ci.SizeY, ci.Annotation,
 		ci.AnnotationType)
 	if err != nil {
-		return err // TODO Tx
+		return err
 	}
 
 	return nil
 }
 
 // Delete a state token link.
-func (cl *StateTokenLink) Delete(db *gorp.DbMap) error {
+func (cl *StateTokenLink) Delete(db gorp.SqlExecutor) error {
 	if db == nil {
 		return errors.New("Missing db parameter to delete state token link")
 	}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/utils/sqlgenerator"
+)
+
+// Undo/redo work on the batches of revisions recorded for a session on a scenario:
+// each API request is one compound operation (e.g. a skill test and its card icons).
+// The undo and redo stacks are rebuilt from the history of the session:
+//   - edit batches are pushed on the undo stack, and clear the redo stack
+//   - undo batches move their target from the undo stack to the redo stack
+//   - redo batches remove their target from the redo stack, and are pushed on the undo stack
+//     (undoing a redo reverts the redo batch itself)
+
+var (
+	ErrNothingToUndo = errors.New("Nothing to undo")
+	ErrNothingToRedo = errors.New("Nothing to redo")
+)
+
+// Undo the last operation of a session on a scenario.
+// Returns the revisions that were reverted.
+func Undo(rr *RevisionRecorder, scenar *Scenario, IDSession int64) ([]*Revision, error) {
+	if rr == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to undo")
+	}
+
+	h, err := loadSessionHistory(rr, scenar, IDSession)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(h.undo) == 0 {
+		return nil, ErrNothingToUndo
+	}
+	target := h.undo[len(h.undo)-1]
+
+	rr.Kind = BatchUndo
+	rr.Target = target
+
+	return revertBatch(rr, h.batches[target])
+}
+
+// Redo the last undone operation of a session on a scenario.
+// Returns the revisions of the undo batch that were reverted.
+func Redo(rr *RevisionRecorder, scenar *Scenario, IDSession int64) ([]*Revision, error) {
+	if rr == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to redo")
+	}
+
+	h, err := loadSessionHistory(rr, scenar, IDSession)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(h.redo) == 0 {
+		return nil, ErrNothingToRedo
+	}
+	target := h.redo[len(h.redo)-1]
+
+	rr.Kind = BatchRedo
+	rr.Target = target
+
+	return revertBatch(rr, h.batches[h.undoneBy[target]])
+}
+
+type sessionHistory struct {
+	batches  map[string][]*Revision // Revisions by batch, in order
+	undo     []string               // Stack of batches that can be undone
+	redo     []string               // Stack of batches that can be redone
+	undoneBy map[string]string      // Last undo batch of each batch
+}
+
+func loadSessionHistory(db gorp.SqlExecutor, scenar *Scenario, IDSession int64) (*sessionHistory, error) {
+
+	query, args, err := sqlgenerator.PGsql.Select(`*`).From(`"revision"`).Where(
+		squirrel.And{
+			squirrel.Eq{`id_scenario`: scenar.ID},
+			squirrel.Eq{`id_session`: IDSession},
+		},
+	).OrderBy(`id`).ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var revs []*Revision
+
+	_, err = db.Select(&revs, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildSessionHistory(revs), nil
+}
+
+// Rebuild the undo and redo stacks from the revisions of a session, in order.
+func buildSessionHistory(revs []*Revision) *sessionHistory {
+	h := &sessionHistory{
+		batches:  make(map[string][]*Revision),
+		undoneBy: make(map[string]string),
+	}
+
+	for _, rev := range revs {
+		_, seen := h.batches[rev.Batch]
+		h.batches[rev.Batch] = append(h.batches[rev.Batch], rev)
+		if seen {
+			continue
+		}
+
+		switch rev.Kind {
+		case BatchUndo:
+			h.undo = remove(h.undo, rev.Target)
+			h.redo = append(h.redo, rev.Target)
+			h.undoneBy[rev.Target] = rev.Batch
+		case BatchRedo:
+			h.redo = remove(h.redo, rev.Target)
+			h.undo = append(h.undo, rev.Batch)
+		default:
+			h.undo = append(h.undo, rev.Batch)
+			h.redo = nil
+		}
+	}
+
+	return h
+}
+
+func remove(stack []string, batch string) []string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == batch {
+			return append(stack[:i:i], stack[i+1:]...)
+		}
+	}
+	return stack
+}
+
+// Revert the revisions of a batch, most recent first.
+// Fails if any of the objects was modified since, e.g. by another user,
+// or if an image they would reference again no longer exists.
+func revertBatch(db gorp.SqlExecutor, batch []*Revision) ([]*Revision, error) {
+
+	// Only the last revision of each object in the batch gives its expected current state
+	checked := make(map[string]bool)
+	for i := len(batch) - 1; i >= 0; i-- {
+		rev := batch[i]
+		key := fmt.Sprintf("%s/%d", rev.ObjectType, rev.IDObject)
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
+		ok, err := rev.isCurrent(db)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s %d was modified since", rev.ObjectType, rev.IDObject)
+		}
+	}
+
+	for _, rev := range batch {
+		err := rev.checkImages(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := len(batch) - 1; i >= 0; i-- {
+		err := batch[i].Revert(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return batch, nil
+}
+
+// Verify that the images referenced by the state a revision restores still exist.
+func (rev *Revision) checkImages(db gorp.SqlExecutor) error {
+	before, _, err := rev.Objects()
+	if err != nil {
+		return err
+	}
+
+	loc, ok := before.(*Location)
+	if !ok || loc.IDBackground == nil {
+		return nil
+	}
+
+	_, err = LoadImageFromID(db, nil, *loc.IDBackground)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("Background image %d of location %d no longer exists", *loc.IDBackground, loc.ID)
+	}
+	return err
+}
+
+// Whether an object is still in the state a revision left it in.
+func (rev *Revision) isCurrent(db gorp.SqlExecutor) (bool, error) {
+	t, tt := trackedTypeFromTable(rev.ObjectType)
+	if tt == nil {
+		return false, fmt.Errorf("Unknown object type: %s", rev.ObjectType)
+	}
+
+	obj, err := db.Get(reflect.New(t).Interface(), rev.IDObject)
+	if err != nil {
+		return false, err
+	}
+
+	if rev.Action == RevisionDelete {
+		return obj == nil, nil
+	}
+	if obj == nil {
+		return false, nil
+	}
+
+	current, err := marshalRow(obj)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(current, rev.After), nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSessionHistory(t *testing.T) {
+	edit := func(batch string) *Revision {
+		return &Revision{Batch: batch, Kind: BatchEdit}
+	}
+	undo := func(batch, target string) *Revision {
+		return &Revision{Batch: batch, Kind: BatchUndo, Target: target}
+	}
+	redo := func(batch, target string) *Revision {
+		return &Revision{Batch: batch, Kind: BatchRedo, Target: target}
+	}
+
+	tests := []struct {
+		name       string
+		revs       []*Revision
+		undo, redo []string
+	}{
+		{"empty", nil, nil, nil},
+		{"edits", []*Revision{edit("e1"), edit("e2")}, []string{"e1", "e2"}, nil},
+		{"batch with several revisions", []*Revision{edit("e1"), edit("e1"), edit("e2")}, []string{"e1", "e2"}, nil},
+		{"undo", []*Revision{edit("e1"), edit("e2"), undo("u1", "e2")}, []string{"e1"}, []string{"e2"}},
+		{"undo all", []*Revision{edit("e1"), edit("e2"), undo("u1", "e2"), undo("u2", "e1")}, nil, []string{"e2", "e1"}},
+		{"redo", []*Revision{edit("e1"), undo("u1", "e1"), redo("r1", "e1")}, []string{"r1"}, nil},
+		{"undo a redo", []*Revision{edit("e1"), undo("u1", "e1"), redo("r1", "e1"), undo("u2", "r1")}, nil, []string{"r1"}},
+		{"edit clears redo", []*Revision{edit("e1"), edit("e2"), undo("u1", "e2"), edit("e3")}, []string{"e1", "e3"}, nil},
+	}
+
+	for _, tt := range tests {
+		h := buildSessionHistory(tt.revs)
+		if len(h.undo) != len(tt.undo) || (len(tt.undo) > 0 && !reflect.DeepEqual(h.undo, tt.undo)) {
+			t.Errorf("%s: undo stack %v, want %v", tt.name, h.undo, tt.undo)
+		}
+		if len(h.redo) != len(tt.redo) || (len(tt.redo) > 0 && !reflect.DeepEqual(h.redo, tt.redo)) {
+			t.Errorf("%s: redo stack %v, want %v", tt.name, h.redo, tt.redo)
+		}
+	}
+
+	// Redoing reverts the last undo batch of its target
+	h := buildSessionHistory([]*Revision{edit("e1"), undo("u1", "e1"), redo("r1", "e1"), undo("u2", "r1")})
+	if h.undoneBy["e1"] != "u1" || h.undoneBy["r1"] != "u2" {
+		t.Errorf("undone by %v", h.undoneBy)
+	}
+}
@@ -26,7 +26,7 @@ type User struct {
 }
 
 // Create a user.
-func CreateUser(db *gorp.DbMap, email string, password string) (*User, error) {
+func CreateUser(db gorp.SqlExecutor, email string, password string) (*User, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to create user")
 	}
@@ -58,7 +58,7 @@ func CreateUser(db *gorp.DbMap, email string, password string) (*User, error) {
 }
 
 // Load a user by email.
-func LoadUserFromEmail(db *gorp.DbMap, email string) (*User, error) {
+func LoadUserFromEmail(db gorp.SqlExecutor, email string) (*User, error) {
 	if db == nil {
 		return nil, errors.New("Missing db parameter to load user")
 	}
@@ -82,8 +82,33 @@ func LoadUserFromEmail(db *gorp.DbMap, email string) (*User, error) {
 	return &u, nil
 }
 
+// Load a user by ID.
+func LoadUserFromID(db gorp.SqlExecutor, ID int64) (*User, error) {
+	if db == nil {
+		return nil, errors.New("Missing db parameter to load user")
+	}
+
+	selector := sqlgenerator.PGsql.Select(`*`).From(`"user"`).Where(
+		squirrel.Eq{`id`: ID},
+	)
+
+	query, args, err := selector.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var u User
+
+	err = db.SelectOne(&u, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
 // Update a user.
-func (u *User) Update(db *gorp.DbMap, email string, password string) error {
+func (u *User) Update(db gorp.SqlExecutor, email string, password string) error {
 	if db == nil {
 		return errors.New("Missing db parameter to update user")
 	}
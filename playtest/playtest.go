@@ -0,0 +1,387 @@
+package playtest
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp"
+	"github.com/juju/errors"
+	"github.com/loopfz/scecret/models"
+)
+
+// A playtest dry-runs the logic of a scenario, following the metadata of its cards:
+//   - visible locations are revealed from the start, hidden ones by a location link
+//   - a card can be visited if its location is revealed (or its element is held, for element cards),
+//     and if the players hold the state tokens that unlock it, and meet its requirement if it has one
+//   - a visited card is resolved once all its skill tests are passed and all the elements it uses
+//     are used on it: the players then get its state tokens, elements and revealed locations
+// Actions the rules do not allow are refused with a BadRequest error, and leave the playtest untouched.
+
+const (
+	ActionStart     = "start"
+	ActionVisit     = "visit"
+	ActionSkillTest = "skill_test"
+	ActionUse       = "use_element"
+	ActionResolve   = "resolve"
+)
+
+// Start a playtest of a scenario.
+func Start(db gorp.SqlExecutor, scenar *models.Scenario, user *models.User) (*models.Playtest, error) {
+	if db == nil || scenar == nil || user == nil {
+		return nil, errors.New("Missing parameters to start playtest")
+	}
+
+	state := &models.PlaytestState{}
+
+	locs, err := models.ListLocations(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, loc := range locs {
+		if !loc.Hidden {
+			state.Locations = append(state.Locations, loc.ID)
+		}
+	}
+
+	logEvent(state, ActionStart, 0, fmt.Sprintf("%d location(s) revealed", len(state.Locations)))
+
+	return models.CreatePlaytest(db, scenar, user, state)
+}
+
+// Visit a card. Its effects are applied right away if it has no skill test
+// and does not use any element.
+func Visit(db gorp.SqlExecutor, scenar *models.Scenario, pt *models.Playtest, card *models.Card) error {
+	if db == nil || scenar == nil || pt == nil || card == nil {
+		return errors.New("Missing parameters to visit card")
+	}
+
+	s := pt.State
+
+	cd, err := loadCardData(db, scenar, card)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case cd.location != nil:
+		if !contains(s.Locations, cd.location.IDLocation) {
+			return errors.NewBadRequest(nil, "Location not revealed")
+		}
+	case cd.element != nil:
+		if !contains(s.Elements, cd.element.ID) && !contains(s.UsedElements, cd.element.ID) {
+			return errors.NewBadRequest(nil, "Element not held")
+		}
+	default:
+		return errors.NewBadRequest(nil, "Card is neither a location card nor an element card")
+	}
+
+	var missing []string
+	for _, tl := range cd.tokenLinks {
+		if !tl.UnlocksUnlocked && !contains(s.StateTokens, tl.IDStateToken) {
+			tk, err := models.LoadStateTokenFromID(db, scenar, tl.IDStateToken)
+			if err != nil {
+				return err
+			}
+			missing = append(missing, tk.ShortName)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.NewBadRequest(nil, "Card is locked, missing state token(s): "+strings.Join(missing, ", "))
+	}
+
+	if cd.requirement != nil && !requirementMet(s, cd.requirement) {
+		desc, err := formatRequirement(db, scenar, cd.requirement)
+		if err != nil {
+			return err
+		}
+		return errors.NewBadRequest(nil, "Card requirement not met: "+desc)
+	}
+
+	if contains(s.VisitedCards, card.ID) {
+		logEvent(s, ActionVisit, card.ID, "Card visited again")
+		return pt.Update(db)
+	}
+
+	s.VisitedCards = append(s.VisitedCards, card.ID)
+	for _, st := range cd.skillTests {
+		if !contains(s.PassedTests, st.ID) {
+			s.PendingTests = append(s.PendingTests, st.ID)
+		}
+	}
+	logEvent(s, ActionVisit, card.ID, fmt.Sprintf("Card visited, %d skill test(s) to resolve", len(cd.skillTests)))
+
+	err = tryResolve(db, s, card, cd)
+	if err != nil {
+		return err
+	}
+
+	return pt.Update(db)
+}
+
+// Resolve a pending skill test, with the outcome chosen by the players.
+// A failed skill test stays pending, and can be resolved again.
+func ResolveSkillTest(db gorp.SqlExecutor, scenar *models.Scenario, pt *models.Playtest, st *models.SkillTest, passed bool) error {
+	if db == nil || scenar == nil || pt == nil || st == nil {
+		return errors.New("Missing parameters to resolve skill test")
+	}
+
+	s := pt.State
+
+	if !contains(s.PendingTests, st.ID) {
+		return errors.NewBadRequest(nil, "Skill test is not pending: visit its card first")
+	}
+
+	if !passed {
+		logEvent(s, ActionSkillTest, st.IDCard, "Skill test failed")
+		return pt.Update(db)
+	}
+
+	s.PendingTests = without(s.PendingTests, st.ID)
+	s.PassedTests = append(s.PassedTests, st.ID)
+	logEvent(s, ActionSkillTest, st.IDCard, "Skill test passed")
+
+	card, err := models.LoadCardFromID(db, scenar, st.IDCard)
+	if err != nil {
+		return err
+	}
+	cd, err := loadCardData(db, scenar, card)
+	if err != nil {
+		return err
+	}
+	err = tryResolve(db, s, card, cd)
+	if err != nil {
+		return err
+	}
+
+	return pt.Update(db)
+}
+
+// Use an element in hand on a visited card that uses it. The element is discarded.
+func UseElement(db gorp.SqlExecutor, scenar *models.Scenario, pt *models.Playtest, elem *models.Element, card *models.Card) error {
+	if db == nil || scenar == nil || pt == nil || elem == nil || card == nil {
+		return errors.New("Missing parameters to use element")
+	}
+
+	s := pt.State
+
+	if !contains(s.Elements, elem.ID) {
+		return errors.NewBadRequest(nil, "Element not held")
+	}
+	if !contains(s.VisitedCards, card.ID) {
+		return errors.NewBadRequest(nil, "Card not visited")
+	}
+
+	cd, err := loadCardData(db, scenar, card)
+	if err != nil {
+		return err
+	}
+
+	uses := false
+	for _, el := range cd.elementLinks {
+		if !el.GivesUses && el.IDElement == elem.ID {
+			uses = true
+		}
+	}
+	if !uses {
+		return errors.NewBadRequest(nil, "Card does not use this element")
+	}
+
+	s.Elements = without(s.Elements, elem.ID)
+	s.UsedElements = append(s.UsedElements, elem.ID)
+	logEvent(s, ActionUse, card.ID, fmt.Sprintf("Element %d used", elem.Number))
+
+	err = tryResolve(db, s, card, cd)
+	if err != nil {
+		return err
+	}
+
+	return pt.Update(db)
+}
+
+// cardData holds what the rules need to know about a card.
+type cardData struct {
+	location     *models.LocationCard // If it is a location card
+	element      *models.Element      // If it is an element card
+	tokenLinks   []*models.StateTokenLink
+	locLinks     []*models.LocationLink
+	elementLinks []*models.ElementLink
+	skillTests   []*models.SkillTest
+	requirement  *models.Requirement // If it has one
+}
+
+func loadCardData(db gorp.SqlExecutor, scenar *models.Scenario, card *models.Card) (*cardData, error) {
+	cd := &cardData{}
+
+	lc, err := models.LoadLocationCardFromCardID(db, card.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		cd.location = lc
+	}
+
+	elems, err := models.ListElements(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elems {
+		if e.IDCard == card.ID {
+			cd.element = e
+		}
+	}
+
+	cd.tokenLinks, err = models.ListStateTokenLinks(db, scenar, card, nil)
+	if err != nil {
+		return nil, err
+	}
+	cd.locLinks, err = models.ListLocationLinks(db, scenar, card, nil)
+	if err != nil {
+		return nil, err
+	}
+	cd.elementLinks, err = models.ListElementLinks(db, scenar, card, nil)
+	if err != nil {
+		return nil, err
+	}
+	cd.skillTests, err = models.ListSkillTests(db, scenar, card, nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := models.LoadRequirementFromCard(db, card)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		cd.requirement = req
+	}
+
+	return cd, nil
+}
+
+// Whether the players meet a card requirement, with the state tokens and the elements in hand.
+func requirementMet(s *models.PlaytestState, req *models.Requirement) bool {
+	tokens := make(map[int64]bool)
+	for _, ID := range s.StateTokens {
+		tokens[ID] = true
+	}
+	elements := make(map[int64]bool)
+	for _, ID := range s.Elements {
+		elements[ID] = true
+	}
+	return req.Expression.Eval(tokens, elements)
+}
+
+// Readable form of a card requirement, naming state tokens and elements.
+func formatRequirement(db gorp.SqlExecutor, scenar *models.Scenario, req *models.Requirement) (string, error) {
+	tokens := make(map[int64]string)
+	tks, err := models.ListStateTokens(db, scenar)
+	if err != nil {
+		return "", err
+	}
+	for _, tk := range tks {
+		tokens[tk.ID] = tk.ShortName
+	}
+	elements := make(map[int64]string)
+	elems, err := models.ListElements(db, scenar)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range elems {
+		elements[e.ID] = fmt.Sprintf("element %d", e.Number)
+	}
+	return req.Expression.Format(
+		func(ID int64) string { return tokens[ID] },
+		func(ID int64) string { return elements[ID] },
+	), nil
+}
+
+// Apply the effects of a visited card, if all its skill tests are passed
+// and all the elements it uses were used.
+func tryResolve(db gorp.SqlExecutor, s *models.PlaytestState, card *models.Card, cd *cardData) error {
+	if contains(s.ResolvedCards, card.ID) {
+		return nil
+	}
+
+	for _, st := range cd.skillTests {
+		if !contains(s.PassedTests, st.ID) {
+			return nil
+		}
+	}
+	for _, el := range cd.elementLinks {
+		if !el.GivesUses && !contains(s.UsedElements, el.IDElement) {
+			return nil
+		}
+	}
+
+	var gained []string
+
+	for _, ll := range cd.locLinks {
+		if !contains(s.Locations, ll.IDLocation) {
+			loc, err := models.LoadLocationFromID(db, nil, ll.IDLocation)
+			if err != nil {
+				return err
+			}
+			s.Locations = append(s.Locations, ll.IDLocation)
+			gained = append(gained, "location "+loc.Name)
+		}
+	}
+	for _, tl := range cd.tokenLinks {
+		if tl.UnlocksUnlocked && !contains(s.StateTokens, tl.IDStateToken) {
+			tk, err := models.LoadStateTokenFromID(db, nil, tl.IDStateToken)
+			if err != nil {
+				return err
+			}
+			s.StateTokens = append(s.StateTokens, tl.IDStateToken)
+			gained = append(gained, "state token "+tk.ShortName)
+		}
+	}
+	for _, el := range cd.elementLinks {
+		if el.GivesUses && !contains(s.Elements, el.IDElement) && !contains(s.UsedElements, el.IDElement) {
+			e, err := models.LoadElementFromID(db, nil, el.IDElement)
+			if err != nil {
+				return err
+			}
+			s.Elements = append(s.Elements, el.IDElement)
+			gained = append(gained, fmt.Sprintf("element %d", e.Number))
+		}
+	}
+
+	s.ResolvedCards = append(s.ResolvedCards, card.ID)
+
+	msg := "Card resolved"
+	if len(gained) > 0 {
+		msg += ", gained " + strings.Join(gained, ", ")
+	}
+	logEvent(s, ActionResolve, card.ID, msg)
+
+	return nil
+}
+
+func logEvent(s *models.PlaytestState, action string, IDCard int64, msg string) {
+	s.Log = append(s.Log, &models.PlaytestEvent{
+		Time:    time.Now().UTC(),
+		Action:  action,
+		IDCard:  IDCard,
+		Message: msg,
+	})
+}
+
+func contains(ids []int64, ID int64) bool {
+	for _, i := range ids {
+		if i == ID {
+			return true
+		}
+	}
+	return false
+}
+
+func without(ids []int64, ID int64) []int64 {
+	ret := []int64{}
+	for _, i := range ids {
+		if i != ID {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
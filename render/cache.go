@@ -0,0 +1,87 @@
+package render
+
+import (
+	"container/list"
+	"image"
+	"sync"
+
+	"github.com/loopfz/scecret/models"
+)
+
+const (
+	// Decoded panoramas kept in memory, in pixels (about 4 bytes each)
+	MAX_CACHED_PIXELS = 50 << 20
+)
+
+// imageCache keeps decoded images, so that panoramas are not decoded again
+// each time one of their cards is rendered. Image rows are never updated,
+// so an image ID always designates the same data.
+// Least recently used images are evicted past MAX_CACHED_PIXELS.
+type imageCache struct {
+	mutex  sync.Mutex
+	pixels int
+	lru    *list.List // Of *cachedImage, most recently used first
+	byID   map[int64]*list.Element
+}
+
+type cachedImage struct {
+	ID  int64
+	img image.Image
+}
+
+var decodedImages = &imageCache{
+	lru:  list.New(),
+	byID: make(map[int64]*list.Element),
+}
+
+// Decode an image, or get it from the cache.
+func (c *imageCache) decode(img *models.Image) (image.Image, error) {
+	c.mutex.Lock()
+	e, ok := c.byID[img.ID]
+	if ok {
+		c.lru.MoveToFront(e)
+	}
+	c.mutex.Unlock()
+	if ok {
+		return e.Value.(*cachedImage).img, nil
+	}
+
+	// Decode outside of the lock, an image might be decoded twice concurrently
+	i, err := img.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	c.add(img.ID, i)
+
+	return i, nil
+}
+
+func (c *imageCache) add(ID int64, img image.Image) {
+	size := pixels(img)
+	if size > MAX_CACHED_PIXELS {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.byID[ID]; ok {
+		return
+	}
+
+	for c.pixels+size > MAX_CACHED_PIXELS {
+		last := c.lru.Back()
+		ci := c.lru.Remove(last).(*cachedImage)
+		delete(c.byID, ci.ID)
+		c.pixels -= pixels(ci.img)
+	}
+
+	c.byID[ID] = c.lru.PushFront(&cachedImage{ID: ID, img: img})
+	c.pixels += size
+}
+
+func pixels(img image.Image) int {
+	b := img.Bounds()
+	return b.Dx() * b.Dy()
+}
@@ -0,0 +1,49 @@
+package render
+
+import (
+	"container/list"
+	"image"
+	"testing"
+)
+
+func TestImageCache(t *testing.T) {
+	side := 1 << 12 // 16M pixels per image
+
+	tests := []struct {
+		name   string
+		add    []int64 // Image IDs, in order
+		cached []int64
+		evict  []int64
+	}{
+		{"single", []int64{1}, []int64{1}, nil},
+		{"under limit", []int64{1, 2, 3}, []int64{1, 2, 3}, nil},
+		{"evict oldest", []int64{1, 2, 3, 4}, []int64{2, 3, 4}, []int64{1}},
+		{"re-add is a no-op", []int64{1, 2, 1, 3, 4}, []int64{2, 3, 4}, []int64{1}},
+	}
+
+	for _, tt := range tests {
+		c := &imageCache{lru: list.New(), byID: make(map[int64]*list.Element)}
+		for _, ID := range tt.add {
+			c.add(ID, image.NewGray(image.Rect(0, 0, side, side)))
+		}
+		for _, ID := range tt.cached {
+			if _, ok := c.byID[ID]; !ok {
+				t.Errorf("%s: image %d not cached", tt.name, ID)
+			}
+		}
+		for _, ID := range tt.evict {
+			if _, ok := c.byID[ID]; ok {
+				t.Errorf("%s: image %d not evicted", tt.name, ID)
+			}
+		}
+		if c.pixels > MAX_CACHED_PIXELS || c.pixels != len(c.byID)*side*side {
+			t.Errorf("%s: %d cached pixels for %d images", tt.name, c.pixels, len(c.byID))
+		}
+	}
+
+	c := &imageCache{lru: list.New(), byID: make(map[int64]*list.Element)}
+	c.add(1, image.NewGray(image.Rect(0, 0, 8<<10, 8<<10)))
+	if len(c.byID) != 0 {
+		t.Errorf("image larger than the cache was cached")
+	}
+}
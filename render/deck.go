@@ -0,0 +1,184 @@
+package render
+
+import (
+	"errors"
+	"image"
+	"sort"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+)
+
+const (
+	// Physical card size, in millimeters.
+	CARD_WIDTH_MM  = 63.5
+	CARD_HEIGHT_MM = 88.9
+
+	FONT_SIZE       = 7  // In points
+	ANNOT_FONT_SIZE = 6  // In points
+	ANNOT_RADIUS_MM = 2. // Size of the circle/square annotations
+)
+
+// Deck is the set of objects needed to render a scenario's cards.
+// IconImages holds the decoded images of the icons that have one.
+type Deck struct {
+	Cards      []*DeckCard
+	Icons      map[int64]*models.Icon
+	IconImages map[int64]image.Image
+}
+
+// DeckCard is a card along with all the CardIcon objects placed on it.
+// Panorama is the slice of its location background drawn on its back, if any.
+// Its bounds are in the coordinates of the whole background, kept in panoramaSrc
+// to extend the slice into the bleed area.
+type DeckCard struct {
+	Card        *models.Card
+	Icons       []*models.CardIcon
+	Panorama    image.Image
+	panoramaSrc image.Image
+}
+
+// Load all the cards of a scenario, ready to be rendered.
+// Cards are sorted by number, then by description.
+func LoadDeck(db gorp.SqlExecutor, scenar *models.Scenario) (*Deck, error) {
+	if db == nil || scenar == nil {
+		return nil, errors.New("Missing parameters to load deck")
+	}
+
+	cards, err := models.ListCards(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	cardIcons, err := models.ListScenarioCardIcons(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := newDeck(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	byCard := make(map[int64]*DeckCard)
+	for _, c := range cards {
+		dc := &DeckCard{Card: c}
+		byCard[c.ID] = dc
+		d.Cards = append(d.Cards, dc)
+	}
+	for _, ci := range cardIcons {
+		dc, ok := byCard[ci.IDCard]
+		if !ok {
+			continue
+		}
+		dc.Icons = append(dc.Icons, ci)
+	}
+
+	panoramas, err := loadPanoramas(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+	for IDCard, ps := range panoramas {
+		dc, ok := byCard[IDCard]
+		if !ok {
+			continue
+		}
+		dc.Panorama, dc.panoramaSrc = ps.img, ps.src
+	}
+
+	sort.Sort(byNumber(d.Cards))
+
+	return d, nil
+}
+
+// Load a single card of a scenario, ready to be rendered.
+func LoadDeckCard(db gorp.SqlExecutor, scenar *models.Scenario, card *models.Card) (*Deck, *DeckCard, error) {
+	if db == nil || scenar == nil || card == nil {
+		return nil, nil, errors.New("Missing parameters to load deck card")
+	}
+
+	cardIcons, err := card.ListCardIcons(db, nil, nil, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	panorama, err := loadCardPanorama(db, scenar, card)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d, err := newDeck(db, scenar)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dc := &DeckCard{Card: card, Icons: cardIcons}
+	if panorama != nil {
+		dc.Panorama, dc.panoramaSrc = panorama.img, panorama.src
+	}
+	d.Cards = []*DeckCard{dc}
+
+	return d, dc, nil
+}
+
+func newDeck(db gorp.SqlExecutor, scenar *models.Scenario) (*Deck, error) {
+	icons, err := models.ListIcons(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	iconImages, err := loadIconImages(db, icons)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Deck{
+		Icons:      make(map[int64]*models.Icon),
+		IconImages: iconImages,
+	}
+	for _, ico := range icons {
+		d.Icons[ico.ID] = ico
+	}
+
+	return d, nil
+}
+
+// Return the text fields and icons of one face of the card.
+func (dc *DeckCard) face(front bool) (*models.CardFace, []*models.CardIcon) {
+	face := dc.Card.Back
+	if front {
+		face = dc.Card.Front
+	}
+	if face == nil {
+		face = &models.CardFace{}
+	}
+
+	var icons []*models.CardIcon
+	for _, ci := range dc.Icons {
+		if ci.FrontBack == front {
+			icons = append(icons, ci)
+		}
+	}
+
+	return face, icons
+}
+
+// Convert card coordinates (see models.MAX_X_COORD/MAX_Y_COORD) to millimeters.
+func mmX(x int) float64 {
+	return float64(x) * CARD_WIDTH_MM / models.MAX_X_COORD
+}
+
+func mmY(y int) float64 {
+	return float64(y) * CARD_HEIGHT_MM / models.MAX_Y_COORD
+}
+
+type byNumber []*DeckCard
+
+func (b byNumber) Len() int      { return len(b) }
+func (b byNumber) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byNumber) Less(i, j int) bool {
+	if b[i].Card.Number != b[j].Card.Number {
+		return b[i].Card.Number < b[j].Card.Number
+	}
+	return b[i].Card.Description < b[j].Card.Description
+}
@@ -0,0 +1,132 @@
+package render
+
+import (
+	"image"
+	"strings"
+
+	"github.com/loopfz/scecret/models"
+)
+
+// canvas is implemented by every output format (PDF, SVG, PNG).
+// Coordinates and lengths are in millimeters, font sizes in points,
+// text is positioned by its baseline.
+// The card layout itself is only written once, against this interface.
+type canvas interface {
+	rect(x, y, w, h float64, fill bool)
+	circle(x, y, r float64, fill bool)
+	text(x, y float64, size float64, bold bool, s string)
+	textWidth(s string, size float64, bold bool) float64
+	drawImage(img image.Image, x, y, w, h float64)
+}
+
+// Draw one face of a card, with its top-left corner at (x0, y0).
+// The artwork (panorama slice) is extended by bleed millimeters around the card,
+// for print-and-play sheets.
+func drawFace(cv canvas, d *Deck, dc *DeckCard, front bool, x0, y0, bleed float64) {
+	face, cardIcons := dc.face(front)
+
+	if !front && dc.Panorama != nil {
+		if bleed > 0 {
+			cv.drawImage(dc.bleedPanorama(bleed), x0-bleed, y0-bleed, CARD_WIDTH_MM+2*bleed, CARD_HEIGHT_MM+2*bleed)
+		} else {
+			cv.drawImage(dc.Panorama, x0, y0, CARD_WIDTH_MM, CARD_HEIGHT_MM)
+		}
+	}
+
+	cv.rect(x0, y0, CARD_WIDTH_MM, CARD_HEIGHT_MM, false)
+
+	for _, ci := range cardIcons {
+		drawCardIcon(cv, d, ci, x0, y0)
+	}
+
+	for _, tf := range face.TextFields {
+		x := x0 + mmX(tf.X)
+		// Text fields span from their X coordinate to the right edge of the card
+		width := CARD_WIDTH_MM - mmX(tf.X)
+		if width <= 0 {
+			continue
+		}
+		y := y0 + mmY(tf.Y)
+		for _, line := range wrapText(cv, tf.Text, FONT_SIZE, false, width) {
+			y += TEXT_LINE_HEIGHT_MM
+			if y > y0+CARD_HEIGHT_MM {
+				break
+			}
+			cv.text(x, y, FONT_SIZE, false, line)
+		}
+	}
+}
+
+// Draw a CardIcon, relative to a card whose top-left corner is at (x0, y0).
+// Icons without an uploaded image are drawn as a frame containing their short name.
+func drawCardIcon(cv canvas, d *Deck, ci *models.CardIcon, x0, y0 float64) {
+	x := x0 + mmX(int(ci.X))
+	y := y0 + mmY(int(ci.Y))
+	w := mmX(int(ci.SizeX))
+	h := mmY(int(ci.SizeY))
+
+	ico := d.Icons[ci.IDIcon]
+
+	if img, ok := d.IconImages[ci.IDIcon]; ok {
+		cv.drawImage(img, x, y, w, h)
+	} else if ico != nil && ico.ShortName != "" {
+		cv.rect(x, y, w, h, false)
+		name := strings.Replace(ico.ShortName, "_", " ", -1)
+		lineHeight := ANNOT_FONT_SIZE * PT_TO_MM
+		lineY := y
+		for _, line := range wrapText(cv, name, ANNOT_FONT_SIZE, false, w) {
+			lineY += lineHeight
+			if lineY > y+h {
+				break
+			}
+			cv.text(x+(w-cv.textWidth(line, ANNOT_FONT_SIZE, false))/2, lineY, ANNOT_FONT_SIZE, false, line)
+		}
+	} else {
+		cv.rect(x, y, w, h, false)
+	}
+
+	if ci.AnnotationType != 0 || ci.Annotation != "" {
+		drawAnnotation(cv, ci.Annotation, ci.AnnotationType, x+w, y)
+	}
+}
+
+// Draw a CardIcon annotation centered on (x, y), i.e. on the top-right corner of the icon.
+func drawAnnotation(cv canvas, text string, annotType int, x, y float64) {
+	r := ANNOT_RADIUS_MM
+
+	switch annotType {
+	case models.AnnotationTypeCircle:
+		cv.circle(x, y, r, true)
+	case models.AnnotationTypeSquare:
+		cv.rect(x-r, y-r, 2*r, 2*r, true)
+	}
+
+	// Baseline offset to vertically center digits/capitals
+	baseline := y + ANNOT_FONT_SIZE*PT_TO_MM*0.35
+	cv.text(x-cv.textWidth(text, ANNOT_FONT_SIZE, true)/2, baseline, ANNOT_FONT_SIZE, true, text)
+}
+
+// Split a text into lines that fit in width, breaking on spaces and newlines.
+// Words wider than the line are kept whole.
+func wrapText(cv canvas, s string, size float64, bold bool, width float64) []string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && cv.textWidth(candidate, size, bold) > width {
+				lines = append(lines, line)
+				line = word
+			} else {
+				line = candidate
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
@@ -0,0 +1,74 @@
+package render
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+const (
+	// SVG icons are rasterized at this size (in pixels) before being drawn.
+	ICON_RASTER_SIZE = 256
+)
+
+// Load and decode the uploaded images of icons, indexed by icon ID.
+// Icons without an uploaded image are skipped.
+func loadIconImages(db gorp.SqlExecutor, icons []*models.Icon) (map[int64]image.Image, error) {
+	ret := make(map[int64]image.Image)
+
+	for _, ico := range icons {
+		img, err := ico.LoadImage(db)
+		if err != nil {
+			return nil, err
+		}
+		if img == nil {
+			continue
+		}
+
+		var decoded image.Image
+		if img.Format == models.ImageFormatSVG {
+			decoded, err = rasterizeSVG(img)
+		} else {
+			decoded, err = img.Decode()
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret[ico.ID] = decoded
+	}
+
+	return ret, nil
+}
+
+func rasterizeSVG(img *models.Image) (image.Image, error) {
+	data, err := img.Content()
+	if err != nil {
+		return nil, err
+	}
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the aspect ratio, largest side at ICON_RASTER_SIZE
+	w, h := ICON_RASTER_SIZE, ICON_RASTER_SIZE
+	if img.Width > img.Height {
+		h = ICON_RASTER_SIZE * img.Height / img.Width
+	} else if img.Height > img.Width {
+		w = ICON_RASTER_SIZE * img.Width / img.Height
+	}
+	if w == 0 || h == 0 {
+		w, h = ICON_RASTER_SIZE, ICON_RASTER_SIZE
+	}
+
+	icon.SetTarget(0, 0, float64(w), float64(h))
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	icon.Draw(rasterx.NewDasher(w, h, rasterx.NewScannerGV(w, h, rgba, rgba.Bounds())), 1)
+
+	return rgba, nil
+}
@@ -0,0 +1,185 @@
+package render
+
+import (
+	"database/sql"
+	"image"
+	"image/draw"
+	"sort"
+
+	"github.com/go-gorp/gorp"
+	"github.com/loopfz/scecret/models"
+)
+
+// panoramaSlice is the part of a location panorama drawn on a card back.
+// The slice keeps the coordinates of the whole panorama.
+type panoramaSlice struct {
+	img image.Image
+	src image.Image
+}
+
+// Slice a location panorama across its cards, in letter order.
+// The panorama is split in as many vertical slices as there are distinct letters:
+// cards sharing a letter (e.g. several "A" cards) get the same slice.
+// Returns the slices indexed by card ID.
+func slicePanorama(img image.Image, locCards []*models.LocationCard) map[int64]*panoramaSlice {
+	ret := make(map[int64]*panoramaSlice)
+
+	var letters []string
+	seen := make(map[string]bool)
+	for _, lc := range locCards {
+		if !seen[lc.Letter] {
+			seen[lc.Letter] = true
+			letters = append(letters, lc.Letter)
+		}
+	}
+	if len(letters) == 0 {
+		return ret
+	}
+	sort.Strings(letters)
+
+	b := img.Bounds()
+	sliceW := b.Dx() / len(letters)
+	if sliceW == 0 {
+		return ret
+	}
+
+	slices := make(map[string]*panoramaSlice)
+	for i, l := range letters {
+		r := image.Rect(b.Min.X+i*sliceW, b.Min.Y, b.Min.X+(i+1)*sliceW, b.Max.Y)
+		slices[l] = &panoramaSlice{img: subImage(img, r), src: img}
+	}
+
+	for _, lc := range locCards {
+		ret[lc.IDCard] = slices[lc.Letter]
+	}
+
+	return ret
+}
+
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if si, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return si.SubImage(r)
+	}
+	// Same coordinates as the sub-images of the standard image types
+	dst := image.NewRGBA(r)
+	draw.Draw(dst, r, img, r.Min, draw.Src)
+	return dst
+}
+
+// Extend a panorama slice into the bleed area, bleed millimeters around the card.
+// The slice is widened with the neighbouring pixels of the panorama, and the edge pixels
+// are repeated past its bounds (top and bottom, and the ends of the panorama).
+func (dc *DeckCard) bleedPanorama(bleed float64) image.Image {
+	r := dc.Panorama.Bounds()
+	src := dc.panoramaSrc
+	if src == nil {
+		src = dc.Panorama
+	}
+
+	bleedX := int(bleed*float64(r.Dx())/CARD_WIDTH_MM + 0.5)
+	bleedY := int(bleed*float64(r.Dy())/CARD_HEIGHT_MM + 0.5)
+
+	return extendImage(src, image.Rect(r.Min.X-bleedX, r.Min.Y-bleedY, r.Max.X+bleedX, r.Max.Y+bleedY))
+}
+
+// Copy the r area of an image, repeating its edge pixels where r is out of its bounds.
+func extendImage(src image.Image, r image.Rectangle) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+
+	inner := r.Intersect(b)
+	draw.Draw(dst, inner.Sub(r.Min), src, inner.Min, draw.Src)
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if (image.Point{x, y}).In(inner) {
+				// Skip to the right of the copied area
+				x = inner.Max.X - 1
+				continue
+			}
+			dst.Set(x-r.Min.X, y-r.Min.Y, src.At(clamp(x, b.Min.X, b.Max.X-1), clamp(y, b.Min.Y, b.Max.Y-1)))
+		}
+	}
+
+	return dst
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// Load the panorama slices of all the locations of a scenario, indexed by card ID.
+func loadPanoramas(db gorp.SqlExecutor, scenar *models.Scenario) (map[int64]*panoramaSlice, error) {
+	ret := make(map[int64]*panoramaSlice)
+
+	locs, err := models.ListLocations(db, scenar)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, loc := range locs {
+		slices, err := loadLocationPanorama(db, loc)
+		if err != nil {
+			return nil, err
+		}
+		for IDCard, ps := range slices {
+			ret[IDCard] = ps
+		}
+	}
+
+	return ret, nil
+}
+
+// Load the panorama slice of a single card. Returns nil if the card
+// is not a location card, or if its location has no background.
+func loadCardPanorama(db gorp.SqlExecutor, scenar *models.Scenario, card *models.Card) (*panoramaSlice, error) {
+	lc, err := models.LoadLocationCardFromCardID(db, card.ID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := models.LoadLocationFromID(db, scenar, lc.IDLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	slices, err := loadLocationPanorama(db, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices[card.ID], nil
+}
+
+func loadLocationPanorama(db gorp.SqlExecutor, loc *models.Location) (map[int64]*panoramaSlice, error) {
+	bg, err := loc.LoadBackground(db)
+	if err != nil {
+		return nil, err
+	}
+	if bg == nil {
+		return nil, nil
+	}
+
+	img, err := decodedImages.decode(bg)
+	if err != nil {
+		return nil, err
+	}
+
+	locCards, err := loc.ListLocationCards(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return slicePanorama(img, locCards), nil
+}
@@ -0,0 +1,123 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	TEXT_LINE_HEIGHT_MM = 3.
+	PT_TO_MM            = 25.4 / 72
+)
+
+// pdfWriter wraps a gofpdf document with the deck-level information
+// needed to draw card faces at arbitrary positions on a page.
+type pdfWriter struct {
+	pdf    *gofpdf.Fpdf
+	tr     func(string) string
+	deck   *Deck
+	images map[image.Image]string // Registered images, by name
+}
+
+// Write the deck as a PDF document, one page per card face (front, then back).
+// Pages have the exact size of a card.
+func (d *Deck) WritePDF(w io.Writer) error {
+
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		UnitStr: "mm",
+		Size:    gofpdf.SizeType{Wd: CARD_WIDTH_MM, Ht: CARD_HEIGHT_MM},
+	})
+
+	pw := d.newPDFWriter(pdf)
+
+	for _, dc := range d.Cards {
+		for _, front := range []bool{true, false} {
+			pdf.AddPage()
+			pw.drawFace(dc, front, 0, 0, 0)
+		}
+	}
+
+	return pdf.Output(w)
+}
+
+func (d *Deck) newPDFWriter(pdf *gofpdf.Fpdf) *pdfWriter {
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCellMargin(0)
+	pdf.SetFont("Helvetica", "", FONT_SIZE)
+
+	return &pdfWriter{
+		pdf:    pdf,
+		tr:     pdf.UnicodeTranslatorFromDescriptor(""),
+		deck:   d,
+		images: make(map[image.Image]string),
+	}
+}
+
+// Draw one face of a card, with its top-left corner at (x0, y0), and its artwork
+// extended by bleed millimeters around it.
+func (pw *pdfWriter) drawFace(dc *DeckCard, front bool, x0, y0, bleed float64) {
+	pw.pdf.SetDrawColor(0, 0, 0)
+	pw.pdf.SetFillColor(255, 255, 255)
+	pw.pdf.SetLineWidth(0.1)
+	drawFace(pw, pw.deck, dc, front, x0, y0, bleed)
+}
+
+func (pw *pdfWriter) rect(x, y, w, h float64, fill bool) {
+	pw.pdf.Rect(x, y, w, h, pdfStyle(fill))
+}
+
+func (pw *pdfWriter) circle(x, y, r float64, fill bool) {
+	pw.pdf.Circle(x, y, r, pdfStyle(fill))
+}
+
+func (pw *pdfWriter) text(x, y float64, size float64, bold bool, s string) {
+	pw.setFont(size, bold)
+	pw.pdf.Text(x, y, pw.tr(s))
+}
+
+func (pw *pdfWriter) textWidth(s string, size float64, bold bool) float64 {
+	pw.setFont(size, bold)
+	return pw.pdf.GetStringWidth(pw.tr(s))
+}
+
+func (pw *pdfWriter) setFont(size float64, bold bool) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	pw.pdf.SetFont("Helvetica", style, size)
+}
+
+// Images are registered in the document once, and can then be drawn several times
+// (e.g. fronts/backs sheets).
+func (pw *pdfWriter) drawImage(img image.Image, x, y, w, h float64) {
+	opts := gofpdf.ImageOptions{ImageType: "PNG"}
+
+	name, ok := pw.images[img]
+	if !ok {
+		var buf bytes.Buffer
+		err := png.Encode(&buf, img)
+		if err != nil {
+			pw.pdf.SetError(err)
+			return
+		}
+		name = fmt.Sprintf("img%d", len(pw.images))
+		pw.pdf.RegisterImageOptionsReader(name, opts, &buf)
+		pw.images[img] = name
+	}
+
+	pw.pdf.ImageOptions(name, x, y, w, h, false, opts, 0, "")
+}
+
+func pdfStyle(fill bool) string {
+	if fill {
+		return "FD"
+	}
+	return "D"
+}
@@ -0,0 +1,139 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	PNG_DPI = 150
+)
+
+var (
+	regularFont *opentype.Font
+	boldFont    *opentype.Font
+)
+
+func init() {
+	var err error
+	regularFont, err = opentype.Parse(goregular.TTF)
+	if err != nil {
+		panic(err)
+	}
+	boldFont, err = opentype.Parse(gobold.TTF)
+	if err != nil {
+		panic(err)
+	}
+}
+
+type pngWriter struct {
+	img   *image.RGBA
+	faces map[float64]map[bool]font.Face
+}
+
+// Render one face of a card as a PNG image (PNG_DPI resolution).
+func (d *Deck) WritePNG(w io.Writer, dc *DeckCard, front bool) error {
+	pw := &pngWriter{
+		img:   image.NewRGBA(image.Rect(0, 0, px(CARD_WIDTH_MM), px(CARD_HEIGHT_MM))),
+		faces: make(map[float64]map[bool]font.Face),
+	}
+	draw.Draw(pw.img, pw.img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	drawFace(pw, d, dc, front, 0, 0, 0)
+
+	for _, byWeight := range pw.faces {
+		for _, f := range byWeight {
+			f.Close()
+		}
+	}
+
+	return png.Encode(w, pw.img)
+}
+
+// Convert millimeters to pixels.
+func px(mm float64) int {
+	return int(math.Floor(mm*PNG_DPI/25.4 + 0.5))
+}
+
+func (pw *pngWriter) rect(x, y, w, h float64, fill bool) {
+	x0, y0, x1, y1 := px(x), px(y), px(x+w)-1, px(y+h)-1
+	if fill {
+		draw.Draw(pw.img, image.Rect(x0, y0, x1, y1), image.White, image.Point{}, draw.Src)
+	}
+	for i := x0; i <= x1; i++ {
+		pw.img.Set(i, y0, color.Black)
+		pw.img.Set(i, y1, color.Black)
+	}
+	for j := y0; j <= y1; j++ {
+		pw.img.Set(x0, j, color.Black)
+		pw.img.Set(x1, j, color.Black)
+	}
+}
+
+func (pw *pngWriter) circle(x, y, r float64, fill bool) {
+	cx, cy, rad := float64(px(x)), float64(px(y)), float64(px(r))
+	for j := int(cy - rad - 1); j <= int(cy+rad+1); j++ {
+		for i := int(cx - rad - 1); i <= int(cx+rad+1); i++ {
+			d := math.Hypot(float64(i)-cx, float64(j)-cy)
+			if math.Abs(d-rad) <= 0.5 {
+				pw.img.Set(i, j, color.Black)
+			} else if fill && d < rad {
+				pw.img.Set(i, j, color.White)
+			}
+		}
+	}
+}
+
+func (pw *pngWriter) text(x, y float64, size float64, bold bool, s string) {
+	d := &font.Drawer{
+		Dst:  pw.img,
+		Src:  image.Black,
+		Face: pw.face(size, bold),
+		Dot:  fixed.P(px(x), px(y)),
+	}
+	d.DrawString(s)
+}
+
+func (pw *pngWriter) textWidth(s string, size float64, bold bool) float64 {
+	w := font.MeasureString(pw.face(size, bold), s)
+	return float64(w) / 64 * 25.4 / PNG_DPI
+}
+
+func (pw *pngWriter) drawImage(img image.Image, x, y, w, h float64) {
+	r := image.Rect(px(x), px(y), px(x+w), px(y+h))
+	xdraw.ApproxBiLinear.Scale(pw.img, r, img, img.Bounds(), xdraw.Over, nil)
+}
+
+func (pw *pngWriter) face(size float64, bold bool) font.Face {
+	if pw.faces[size] == nil {
+		pw.faces[size] = make(map[bool]font.Face)
+	}
+	f, ok := pw.faces[size][bold]
+	if ok {
+		return f
+	}
+
+	fnt := regularFont
+	if bold {
+		fnt = boldFont
+	}
+	f, err := opentype.NewFace(fnt, &opentype.FaceOptions{Size: size, DPI: PNG_DPI, Hinting: font.HintingFull})
+	if err != nil {
+		// Only fails on invalid options, which are constant here
+		panic(err)
+	}
+	pw.faces[size][bold] = f
+
+	return f
+}
@@ -0,0 +1,169 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	PAPER_A4     = "A4"
+	PAPER_LETTER = "LETTER"
+
+	MAX_MARGIN_MM = 50
+	MAX_BLEED_MM  = 10
+
+	CROP_MARK_LEN_MM = 4.
+	CROP_MARK_GAP_MM = 1.
+)
+
+var paperSizes = map[string]gofpdf.SizeType{
+	PAPER_A4:     {Wd: 210, Ht: 297},
+	PAPER_LETTER: {Wd: 215.9, Ht: 279.4},
+}
+
+// SheetOptions describes how cards are imposed on print-and-play sheets.
+type SheetOptions struct {
+	Paper      string
+	MarginMM   float64
+	BleedMM    float64
+	PrintBacks bool
+}
+
+// sheetLayout is the grid computed from SheetOptions.
+type sheetLayout struct {
+	paper        gofpdf.SizeType
+	cols, rows   int
+	cellW, cellH float64
+	originX      float64
+	originY      float64
+	bleed        float64
+}
+
+// Verify that sheet options are valid before using them.
+func (o *SheetOptions) Valid() error {
+	if _, ok := paperSizes[strings.ToUpper(o.Paper)]; !ok {
+		return fmt.Errorf("Unknown paper size: %s", o.Paper)
+	}
+	if math.IsNaN(o.MarginMM) || o.MarginMM < 0 || o.MarginMM > MAX_MARGIN_MM {
+		return fmt.Errorf("Invalid margin: %.1fmm (max %dmm)", o.MarginMM, MAX_MARGIN_MM)
+	}
+	if math.IsNaN(o.BleedMM) || o.BleedMM < 0 || o.BleedMM > MAX_BLEED_MM {
+		return fmt.Errorf("Invalid bleed: %.1fmm (max %dmm)", o.BleedMM, MAX_BLEED_MM)
+	}
+	return nil
+}
+
+func (o *SheetOptions) layout() (*sheetLayout, error) {
+	err := o.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &sheetLayout{
+		paper: paperSizes[strings.ToUpper(o.Paper)],
+		cellW: CARD_WIDTH_MM + 2*o.BleedMM,
+		cellH: CARD_HEIGHT_MM + 2*o.BleedMM,
+		bleed: o.BleedMM,
+	}
+
+	l.cols = int((l.paper.Wd - 2*o.MarginMM) / l.cellW)
+	l.rows = int((l.paper.Ht - 2*o.MarginMM) / l.cellH)
+	if l.cols <= 0 || l.rows <= 0 {
+		return nil, errors.New("Margins and bleed too large: no card fits on the sheet")
+	}
+
+	// Center the grid on the sheet
+	l.originX = (l.paper.Wd - float64(l.cols)*l.cellW) / 2
+	l.originY = (l.paper.Ht - float64(l.rows)*l.cellH) / 2
+
+	return l, nil
+}
+
+// Top-left corner of the card (bleed excluded) in a grid cell.
+func (l *sheetLayout) cardPosition(col, row int) (float64, float64) {
+	return l.originX + float64(col)*l.cellW + l.bleed, l.originY + float64(row)*l.cellH + l.bleed
+}
+
+// Write the deck as print-and-play sheets: as many cards as fit on each sheet,
+// with crop marks. If backs are printed, each sheet of fronts is followed by a sheet
+// of backs, mirrored horizontally so that they line up when printed duplex (long edge).
+func (d *Deck) WriteSheetsPDF(w io.Writer, opts *SheetOptions) error {
+	if opts == nil {
+		return errors.New("Missing sheet options")
+	}
+
+	l, err := opts.layout()
+	if err != nil {
+		return err
+	}
+
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		UnitStr: "mm",
+		Size:    l.paper,
+	})
+
+	pw := d.newPDFWriter(pdf)
+
+	perSheet := l.cols * l.rows
+	for start := 0; start < len(d.Cards); start += perSheet {
+		end := start + perSheet
+		if end > len(d.Cards) {
+			end = len(d.Cards)
+		}
+		sheet := d.Cards[start:end]
+
+		pdf.AddPage()
+		pw.drawSheet(l, sheet, true)
+
+		if opts.PrintBacks {
+			pdf.AddPage()
+			pw.drawSheet(l, sheet, false)
+		}
+	}
+
+	return pdf.Output(w)
+}
+
+func (pw *pdfWriter) drawSheet(l *sheetLayout, cards []*DeckCard, front bool) {
+	for i, dc := range cards {
+		col := i % l.cols
+		row := i / l.cols
+		if !front {
+			col = l.cols - 1 - col
+		}
+		x, y := l.cardPosition(col, row)
+		pw.drawFace(dc, front, x, y, l.bleed)
+	}
+	pw.drawCropMarks(l)
+}
+
+// Draw crop marks outside of the grid, in line with every card edge.
+func (pw *pdfWriter) drawCropMarks(l *sheetLayout) {
+	pw.pdf.SetDrawColor(0, 0, 0)
+	pw.pdf.SetLineWidth(0.1)
+
+	top := l.originY - CROP_MARK_GAP_MM
+	bottom := l.originY + float64(l.rows)*l.cellH + CROP_MARK_GAP_MM
+	left := l.originX - CROP_MARK_GAP_MM
+	right := l.originX + float64(l.cols)*l.cellW + CROP_MARK_GAP_MM
+
+	for col := 0; col < l.cols; col++ {
+		x, _ := l.cardPosition(col, 0)
+		for _, cutX := range []float64{x, x + CARD_WIDTH_MM} {
+			pw.pdf.Line(cutX, top-CROP_MARK_LEN_MM, cutX, top)
+			pw.pdf.Line(cutX, bottom, cutX, bottom+CROP_MARK_LEN_MM)
+		}
+	}
+	for row := 0; row < l.rows; row++ {
+		_, y := l.cardPosition(0, row)
+		for _, cutY := range []float64{y, y + CARD_HEIGHT_MM} {
+			pw.pdf.Line(left-CROP_MARK_LEN_MM, cutY, left, cutY)
+			pw.pdf.Line(right, cutY, right+CROP_MARK_LEN_MM, cutY)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestSheetOptionsValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  SheetOptions
+		valid bool
+	}{
+		{"default", SheetOptions{Paper: PAPER_A4}, true},
+		{"letter lower case", SheetOptions{Paper: "letter", MarginMM: 10, BleedMM: 3}, true},
+		{"unknown paper", SheetOptions{Paper: "A3"}, false},
+		{"max margin", SheetOptions{Paper: PAPER_A4, MarginMM: MAX_MARGIN_MM}, true},
+		{"margin too large", SheetOptions{Paper: PAPER_A4, MarginMM: MAX_MARGIN_MM + 1}, false},
+		{"negative margin", SheetOptions{Paper: PAPER_A4, MarginMM: -1}, false},
+		{"NaN margin", SheetOptions{Paper: PAPER_A4, MarginMM: math.NaN()}, false},
+		{"+Inf margin", SheetOptions{Paper: PAPER_A4, MarginMM: math.Inf(1)}, false},
+		{"-Inf margin", SheetOptions{Paper: PAPER_A4, MarginMM: math.Inf(-1)}, false},
+		{"max bleed", SheetOptions{Paper: PAPER_A4, BleedMM: MAX_BLEED_MM}, true},
+		{"bleed too large", SheetOptions{Paper: PAPER_A4, BleedMM: MAX_BLEED_MM + 1}, false},
+		{"negative bleed", SheetOptions{Paper: PAPER_A4, BleedMM: -1}, false},
+		{"NaN bleed", SheetOptions{Paper: PAPER_A4, BleedMM: math.NaN()}, false},
+		{"+Inf bleed", SheetOptions{Paper: PAPER_A4, BleedMM: math.Inf(1)}, false},
+		{"-Inf bleed", SheetOptions{Paper: PAPER_A4, BleedMM: math.Inf(-1)}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.opts.Valid()
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: Valid() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestSheetLayout(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       SheetOptions
+		cols, rows int
+	}{
+		{"A4 no margin", SheetOptions{Paper: PAPER_A4}, 3, 3},
+		{"A4 with bleed", SheetOptions{Paper: PAPER_A4, MarginMM: 5, BleedMM: 3}, 2, 3},
+		{"letter", SheetOptions{Paper: PAPER_LETTER, MarginMM: 10}, 3, 2},
+		{"max margin and bleed", SheetOptions{Paper: PAPER_A4, MarginMM: MAX_MARGIN_MM, BleedMM: MAX_BLEED_MM}, 1, 1},
+		{"NaN margin", SheetOptions{Paper: PAPER_A4, MarginMM: math.NaN()}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		l, err := tt.opts.layout()
+		if tt.cols <= 0 || tt.rows <= 0 {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %dx%d", tt.name, l.cols, l.rows)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if l.cols != tt.cols || l.rows != tt.rows {
+			t.Errorf("%s: got %dx%d, want %dx%d", tt.name, l.cols, l.rows, tt.cols, tt.rows)
+		}
+		// The grid is centered and fits on the sheet
+		x, y := l.cardPosition(0, 0)
+		if x-l.bleed < 0 || y-l.bleed < 0 {
+			t.Errorf("%s: grid starts outside of the sheet at %.1f,%.1f", tt.name, x, y)
+		}
+		x, y = l.cardPosition(l.cols-1, l.rows-1)
+		if x+CARD_WIDTH_MM+l.bleed > l.paper.Wd+1e-9 || y+CARD_HEIGHT_MM+l.bleed > l.paper.Ht+1e-9 {
+			t.Errorf("%s: grid ends outside of the sheet at %.1f,%.1f", tt.name, x, y)
+		}
+	}
+}
+
+func TestExtendImage(t *testing.T) {
+	// 4x2 image, each pixel's red value is its x coordinate, green its y
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			src.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+
+	tests := []struct {
+		name string
+		r    image.Rectangle
+		// Expected source pixel at each corner of the result
+		topLeft, bottomRight image.Point
+	}{
+		{"inside", image.Rect(1, 0, 3, 2), image.Pt(1, 0), image.Pt(2, 1)},
+		{"neighbouring pixels", image.Rect(0, 0, 4, 2), image.Pt(0, 0), image.Pt(3, 1)},
+		{"clamped left and top", image.Rect(-2, -2, 2, 2), image.Pt(0, 0), image.Pt(1, 1)},
+		{"clamped everywhere", image.Rect(-1, -1, 5, 3), image.Pt(0, 0), image.Pt(3, 1)},
+	}
+
+	for _, tt := range tests {
+		dst := extendImage(src, tt.r)
+		b := dst.Bounds()
+		if b.Dx() != tt.r.Dx() || b.Dy() != tt.r.Dy() {
+			t.Errorf("%s: got size %v, want %v", tt.name, b.Size(), tt.r.Size())
+			continue
+		}
+		corners := []struct{ got, want image.Point }{
+			{b.Min, tt.topLeft},
+			{b.Max.Sub(image.Pt(1, 1)), tt.bottomRight},
+		}
+		for _, c := range corners {
+			r, g, _, _ := dst.At(c.got.X, c.got.Y).RGBA()
+			if int(r>>8) != c.want.X || int(g>>8) != c.want.Y {
+				t.Errorf("%s: pixel %v comes from %d,%d, want %v", tt.name, c.got, r>>8, g>>8, c.want)
+			}
+		}
+	}
+}
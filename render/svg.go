@@ -0,0 +1,84 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+)
+
+const (
+	// Average glyph width relative to font size, used to wrap text
+	// since SVG documents carry no font metrics.
+	SVG_GLYPH_WIDTH_RATIO = 0.5
+)
+
+type svgWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// Render one face of a card as an SVG document.
+func (d *Deck) WriteSVG(w io.Writer, dc *DeckCard, front bool) error {
+	sw := &svgWriter{w: bufio.NewWriter(w)}
+
+	fmt.Fprintf(sw.w, `<svg xmlns="http://www.w3.org/2000/svg" width="%gmm" height="%gmm" viewBox="0 0 %g %g">`+"\n",
+		CARD_WIDTH_MM, CARD_HEIGHT_MM, CARD_WIDTH_MM, CARD_HEIGHT_MM)
+	fmt.Fprintf(sw.w, `<rect x="0" y="0" width="%g" height="%g" fill="white"/>`+"\n", CARD_WIDTH_MM, CARD_HEIGHT_MM)
+
+	drawFace(sw, d, dc, front, 0, 0, 0)
+
+	fmt.Fprint(sw.w, "</svg>\n")
+
+	if sw.err != nil {
+		return sw.err
+	}
+
+	return sw.w.Flush()
+}
+
+func (sw *svgWriter) rect(x, y, w, h float64, fill bool) {
+	fmt.Fprintf(sw.w, `<rect x="%g" y="%g" width="%g" height="%g" %s/>`+"\n", x, y, w, h, svgStyle(fill))
+}
+
+func (sw *svgWriter) circle(x, y, r float64, fill bool) {
+	fmt.Fprintf(sw.w, `<circle cx="%g" cy="%g" r="%g" %s/>`+"\n", x, y, r, svgStyle(fill))
+}
+
+func (sw *svgWriter) text(x, y float64, size float64, bold bool, s string) {
+	weight := "normal"
+	if bold {
+		weight = "bold"
+	}
+	fmt.Fprintf(sw.w, `<text x="%g" y="%g" font-family="Helvetica, Arial, sans-serif" font-size="%g" font-weight="%s">`,
+		x, y, size*PT_TO_MM, weight)
+	xml.EscapeText(sw.w, []byte(s))
+	fmt.Fprint(sw.w, "</text>\n")
+}
+
+func (sw *svgWriter) textWidth(s string, size float64, bold bool) float64 {
+	return float64(len([]rune(s))) * size * PT_TO_MM * SVG_GLYPH_WIDTH_RATIO
+}
+
+// Images are embedded as PNG data URIs.
+func (sw *svgWriter) drawImage(img image.Image, x, y, w, h float64) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		sw.err = err
+		return
+	}
+	fmt.Fprintf(sw.w, `<image x="%g" y="%g" width="%g" height="%g" preserveAspectRatio="none" href="data:image/png;base64,%s"/>`+"\n",
+		x, y, w, h, base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+func svgStyle(fill bool) string {
+	if fill {
+		return `fill="white" stroke="black" stroke-width="0.1"`
+	}
+	return `fill="none" stroke="black" stroke-width="0.1"`
+}
@@ -168,7 +168,7 @@ func createLocCard(db *gorp.DbMap, loc *models.Location, scenar *models.Scenario
 }
 
 func createLocLink(db *gorp.DbMap, card *models.Card, loc *models.Location) {
-	_, err := models.CreateLocationLink(db, card, loc)
+	_, err := models.CreateLocationLink(db, card, loc, models.DEFAULT_TRAVEL_TU_COST)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,56 @@
+package blobstore
+
+// Tx follows a database transaction: blobs stay consistent with the rows referencing them.
+// Deletes are deferred until Commit, and blobs written during the transaction
+// are deleted on Rollback.
+type Tx struct {
+	store   Store
+	written []string
+	deleted []string
+}
+
+func NewTx(s Store) *Tx {
+	return &Tx{store: s}
+}
+
+func (tx *Tx) Put(key string, data []byte) error {
+	err := tx.store.Put(key, data)
+	if err != nil {
+		return err
+	}
+	tx.written = append(tx.written, key)
+	return nil
+}
+
+func (tx *Tx) Get(key string) ([]byte, error) {
+	return tx.store.Get(key)
+}
+
+func (tx *Tx) Delete(key string) error {
+	tx.deleted = append(tx.deleted, key)
+	return nil
+}
+
+// Apply the deferred deletes, once the transaction is committed.
+// All deletes are attempted, the first error is returned.
+func (tx *Tx) Commit() error {
+	return tx.deleteAll(tx.deleted)
+}
+
+// Delete the blobs written during the transaction, once it is rolled back.
+// All deletes are attempted, the first error is returned.
+func (tx *Tx) Rollback() error {
+	return tx.deleteAll(tx.written)
+}
+
+func (tx *Tx) deleteAll(keys []string) error {
+	var ret error
+	for _, key := range keys {
+		err := tx.store.Delete(key)
+		if err != nil && ret == nil {
+			ret = err
+		}
+	}
+	tx.written, tx.deleted = nil, nil
+	return ret
+}
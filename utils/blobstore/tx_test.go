@@ -0,0 +1,56 @@
+package blobstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit bool
+		// Blobs present after the transaction
+		existing, written, deleted bool
+	}{
+		{"commit", true, true, true, false},
+		{"rollback", false, true, false, true},
+	}
+
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "blobstore")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		store, err := NewLocal(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Put("existing", []byte("a"))
+		store.Put("deleted", []byte("b"))
+
+		tx := NewTx(store)
+		tx.Put("written", []byte("c"))
+		tx.Delete("deleted")
+		if _, err := store.Get("deleted"); err != nil {
+			t.Errorf("%s: blob deleted before the end of the transaction", tt.name)
+		}
+
+		if tt.commit {
+			err = tx.Commit()
+		} else {
+			err = tx.Rollback()
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+
+		for key, want := range map[string]bool{"existing": tt.existing, "written": tt.written, "deleted": tt.deleted} {
+			_, err := store.Get(key)
+			if (err == nil) != want {
+				t.Errorf("%s: blob %s present: %v, want %v", tt.name, key, err == nil, want)
+			}
+		}
+	}
+}